@@ -0,0 +1,431 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	p "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+func runLogin(cli *cli, args []string) error {
+	flags := cli.newFlagSet("login")
+	method := flags.String("method", "", "the login method to use (defaults to the method of the profile)")
+	if err := cli.parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+
+	session, err := cli.connect()
+	if err != nil {
+		return err
+	}
+
+	// Unless a user is given explicitly, the credentials configured for the profile are tried before prompting for them
+	user, password := flags.Arg(0), ""
+	if user == "" {
+		user, password, _ = cli.profile.LoginCredentials()
+	}
+	if user == "" {
+		value, err := cli.prompt("Username: ", false)
+		if err != nil {
+			return err
+		}
+		user = strings.TrimSpace(value)
+	}
+	if password == "" {
+		password = os.Getenv(envPassword)
+	}
+	if password == "" {
+		value, err := cli.prompt("Password: ", true)
+		if err != nil {
+			return err
+		}
+		password = value
+	}
+
+	if *method == "" {
+		*method = cli.profile.LoginMethod
+	}
+	if strings.EqualFold(*method, "basic") {
+		err = session.BasicLogin(user, password)
+	} else {
+		err = session.Login(*method, user, password)
+	}
+	if err != nil {
+		return err
+	}
+
+	host := cli.profile.Gateway
+	if err := cli.saveSession(&sessionState{Host: host, User: user, Token: session.Token()}); err != nil {
+		return err
+	}
+	return cli.print(messageResult(fmt.Sprintf("Logged into %v as %v", host, user), map[string]string{"host": host, "user": user}))
+}
+
+func runLogout(cli *cli, args []string) error {
+	if err := cli.parseFlags(cli.newFlagSet("logout"), args, 0, 0); err != nil {
+		return err
+	}
+	if err := cli.removeSession(); err != nil {
+		return err
+	}
+	return cli.print(messageResult("Logged out", map[string]string{}))
+}
+
+func runWhoAmI(cli *cli, args []string) error {
+	if err := cli.parseFlags(cli.newFlagSet("whoami"), args, 0, 0); err != nil {
+		return err
+	}
+
+	user, err := cli.session.WhoAmI()
+	if err != nil {
+		return err
+	}
+	fields := map[string]string{"username": user.Username, "displayName": user.DisplayName, "mail": user.Mail}
+	if user.Id != nil {
+		fields["id"] = user.Id.OpaqueId
+	}
+	return cli.print(messageResult(fmt.Sprintf("%v (%v) <%v>", user.Username, user.DisplayName, user.Mail), fields))
+}
+
+func runList(cli *cli, args []string) error {
+	flags := cli.newFlagSet("ls")
+	recursive := flags.Bool("R", false, "list all subdirectories recursively")
+	if err := cli.parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+
+	path := cli.remotePath(flags.Arg(0))
+	infos, err := action.MustNewEnumFilesAction(cli.session).ListAll(path, *recursive)
+	if err != nil {
+		return err
+	}
+	return cli.print(fileEntriesResult(action.NewFileEntries(infos)))
+}
+
+func runStat(cli *cli, args []string) error {
+	flags := cli.newFlagSet("stat")
+	if err := cli.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	info, err := action.MustNewFileOperationsAction(cli.session).Stat(cli.remotePath(flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+	return cli.print(fileEntryResult(action.NewFileEntry(info)))
+}
+
+func runMakeDir(cli *cli, args []string) error {
+	flags := cli.newFlagSet("mkdir")
+	parents := flags.Bool("p", false, "create missing parent directories; don't fail if the directory exists")
+	if err := cli.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	path := cli.remotePath(flags.Arg(0))
+	fileOpsAct := action.MustNewFileOperationsAction(cli.session)
+	if !*parents {
+		if fileOpsAct.ResourceExists(path) {
+			return fmt.Errorf("'%v' already exists", path)
+		}
+		if !fileOpsAct.DirExists(p.Dir(path)) {
+			return fmt.Errorf("the parent directory of '%v' doesn't exist; use -p to create it", path)
+		}
+	}
+	if err := fileOpsAct.MakePath(path); err != nil {
+		return err
+	}
+	return cli.printResource(path)
+}
+
+func runPut(cli *cli, args []string) error {
+	flags := cli.newFlagSet("put")
+	enableTUS := flags.Bool("tus", false, "use TUS if the server doesn't support WebDAV")
+	workers := flags.Int("workers", action.DefaultWorkers, "the number of files uploaded in parallel")
+	if err := cli.parseFlags(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	uploadAct := action.MustNewUploadAction(cli.session)
+	uploadAct.EnableTUS = *enableTUS
+	uploadAct.Workers = *workers
+
+	local := flags.Arg(0)
+	if local == "-" {
+		if flags.NArg() < 2 {
+			return &usageError{err: fmt.Errorf("a remote path is required when uploading from stdin")}
+		}
+		target := cli.remotePath(flags.Arg(1))
+		info, checksums, err := uploadAct.UploadWithChecksums(cli.stdin, -1, target)
+		if err != nil {
+			return err
+		}
+		return cli.print(transferEntryResult(action.NewTransferEntry(action.TransferResult{RemotePath: target, Size: int64(info.Size), Info: info, Checksums: checksums})))
+	}
+
+	localInfo, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	target := cli.remoteTarget(flags.Arg(1), filepath.Base(local))
+
+	if localInfo.IsDir() {
+		results, err := uploadAct.UploadDirectory(local, target)
+		if printErr := cli.print(transferEntriesResult(action.NewTransferEntries(results))); err == nil {
+			err = printErr
+		}
+		return err
+	}
+
+	file, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, checksums, err := uploadAct.UploadWithChecksums(file, localInfo.Size(), target)
+	if err != nil {
+		return err
+	}
+	return cli.print(transferEntryResult(action.NewTransferEntry(action.TransferResult{LocalPath: local, RemotePath: target, Size: localInfo.Size(), Info: info, Checksums: checksums})))
+}
+
+func runGet(cli *cli, args []string) error {
+	flags := cli.newFlagSet("get")
+	workers := flags.Int("workers", action.DefaultWorkers, "the number of files downloaded in parallel")
+	if err := cli.parseFlags(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	source := cli.remotePath(flags.Arg(0))
+	info, err := action.MustNewFileOperationsAction(cli.session).Stat(source)
+	if err != nil {
+		return err
+	}
+
+	downloadAct := action.MustNewDownloadAction(cli.session)
+	downloadAct.Workers = *workers
+
+	// When writing the data to stdout, no result is printed
+	local := flags.Arg(1)
+	if local == "-" {
+		_, err := downloadAct.DownloadTo(info, cli.stdout)
+		return err
+	}
+	if local == "" {
+		local = "."
+	}
+	if localInfo, err := os.Stat(local); err == nil && localInfo.IsDir() {
+		local = filepath.Join(local, p.Base(source))
+	}
+
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		results, err := downloadAct.DownloadDirectory(source, local)
+		if printErr := cli.print(transferEntriesResult(action.NewTransferEntries(results))); err == nil {
+			err = printErr
+		}
+		return err
+	}
+
+	// Download into a temporary file first, so that a failed download doesn't destroy an existing file
+	file, err := ioutil.TempFile(filepath.Dir(local), "."+filepath.Base(local)+".*.download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	size, err := downloadAct.DownloadTo(info, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), local); err != nil {
+		return err
+	}
+	return cli.print(transferEntryResult(action.NewTransferEntry(action.TransferResult{LocalPath: local, RemotePath: source, Size: size, Info: info})))
+}
+
+func runMove(cli *cli, args []string) error {
+	flags := cli.newFlagSet("mv")
+	if err := cli.parseFlags(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	source := cli.remotePath(flags.Arg(0))
+	target := cli.remoteTarget(flags.Arg(1), p.Base(source))
+	if err := action.MustNewFileOperationsAction(cli.session).Move(source, target); err != nil {
+		return err
+	}
+	return cli.printResource(target)
+}
+
+func runCopy(cli *cli, args []string) error {
+	flags := cli.newFlagSet("cp")
+	if err := cli.parseFlags(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	source := cli.remotePath(flags.Arg(0))
+	target := cli.remoteTarget(flags.Arg(1), p.Base(source))
+	if err := action.MustNewFileOperationsAction(cli.session).Copy(source, target); err != nil {
+		return err
+	}
+	return cli.printResource(target)
+}
+
+func runRemove(cli *cli, args []string) error {
+	flags := cli.newFlagSet("rm")
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	if err := cli.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	path := cli.remotePath(flags.Arg(0))
+	fileOpsAct := action.MustNewFileOperationsAction(cli.session)
+	info, err := fileOpsAct.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER && !*recursive {
+		return fmt.Errorf("'%v' is a directory; use -r to remove it", path)
+	}
+	if err := fileOpsAct.Remove(path); err != nil {
+		return err
+	}
+	return cli.print(messageResult(fmt.Sprintf("Removed %v", path), map[string]string{"removed": path}))
+}
+
+func runShare(cli *cli, args []string) error {
+	flags := cli.newFlagSet("share")
+	roleName := flags.String("role", string(action.ShareRoleViewer), "the permissions granted by the share (viewer or editor)")
+	public := flags.Bool("public", false, "create a public link instead of sharing with a user")
+	password := flags.Bool("password", false, "protect the public link with a password (read from "+envLinkPassword+" or prompted for)")
+	passwordStdin := flags.Bool("password-stdin", false, "protect the public link with a password read from the standard input")
+	expires := flags.Duration("expires", 0, "the validity of a public link (e.g., 72h)")
+	if err := cli.parseFlags(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	role, err := action.ParseShareRole(*roleName)
+	if err != nil {
+		return &usageError{err: err}
+	}
+
+	path := cli.remotePath(flags.Arg(0))
+	shareAct := action.MustNewShareAction(cli.session)
+	if *public {
+		var expiration time.Time
+		if *expires > 0 {
+			expiration = time.Now().Add(*expires)
+		}
+		// The password is never passed as an argument, so that it doesn't show up in process lists or the shell history
+		linkPassword := ""
+		if *passwordStdin {
+			if linkPassword, err = cli.prompt("", false); err != nil {
+				return err
+			}
+		} else if *password {
+			if linkPassword = os.Getenv(envLinkPassword); linkPassword == "" {
+				if linkPassword, err = cli.prompt("Link password: ", true); err != nil {
+					return err
+				}
+			}
+		}
+		if (*password || *passwordStdin) && linkPassword == "" {
+			return &usageError{err: fmt.Errorf("the password of the public link must not be empty")}
+		}
+
+		share, err := shareAct.CreatePublicLink(path, role, linkPassword, expiration)
+		if err != nil {
+			return err
+		}
+		return cli.print(shareEntryResult(action.NewPublicShareEntry(share), path))
+	}
+
+	if flags.NArg() < 2 {
+		return &usageError{err: fmt.Errorf("a user is required unless -public is used")}
+	}
+	share, err := shareAct.ShareWithUser(path, flags.Arg(1), role)
+	if err != nil {
+		return err
+	}
+
+	// The share only references the user ID, so show the name the user was given by instead
+	entry := action.NewShareEntry(share)
+	entry.Grantee = flags.Arg(1)
+	return cli.print(shareEntryResult(entry, path))
+}
+
+// workingDir returns the remote directory that relative paths refer to.
+func (cli *cli) workingDir() string {
+	if cli.cwd != "" {
+		return cli.cwd
+	}
+	return cli.profile.Home
+}
+
+// remotePath converts a path given on the command line into an absolute remote path; relative paths refer to the working directory.
+func (cli *cli) remotePath(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return p.Clean(path)
+	}
+	return p.Join(cli.workingDir(), path)
+}
+
+// remoteTarget determines the target of a transfer; if the target is an existing directory (or empty), the name of the source is appended.
+func (cli *cli) remoteTarget(target string, name string) string {
+	if target == "" {
+		return p.Join(cli.workingDir(), name)
+	}
+
+	path := cli.remotePath(target)
+	if strings.HasSuffix(target, "/") || action.MustNewFileOperationsAction(cli.session).DirExists(path) {
+		return p.Join(path, name)
+	}
+	return path
+}
+
+// printResource prints the entry of a resource affected by a command.
+func (cli *cli) printResource(path string) error {
+	info, err := action.MustNewFileOperationsAction(cli.session).Stat(path)
+	if err != nil {
+		return err
+	}
+	entry := action.NewFileEntry(info)
+	res := fileEntriesResult([]*action.FileEntry{entry})
+	res.value = entry
+	return cli.print(res)
+}
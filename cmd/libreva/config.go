@@ -0,0 +1,220 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+const (
+	envHost         = "LIBREVA_HOST"
+	envInsecure     = "LIBREVA_INSECURE"
+	envRemote       = "LIBREVA_REMOTE"
+	envConfigDir    = "LIBREVA_CONFIG_DIR"
+	envUser         = "LIBREVA_USER"
+	envPassword     = "LIBREVA_PASSWORD"
+	envLinkPassword = "LIBREVA_LINK_PASSWORD"
+
+	profilesFileName = "profiles.yaml"
+	sessionFileName  = "session.json"
+)
+
+// sessionState stores the token of the last login, so that subsequent invocations don't need to log in again.
+type sessionState struct {
+	Host  string `json:"host"`
+	User  string `json:"user"`
+	Token string `json:"token"`
+}
+
+var errNotLoggedIn = errors.New("not logged in; run 'libreva login' or set " + envUser + " and " + envPassword)
+
+// loadConfig determines the profile to connect with: A host given via flags or the environment is used directly;
+// otherwise, the selected (or default) remote is read from the profiles file.
+func (cli *cli) loadConfig() error {
+	if cli.configDir == "" {
+		cli.configDir = trimmedEnv(envConfigDir)
+	}
+	if cli.configDir == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return fmt.Errorf("unable to determine the configuration directory: %v", err)
+		}
+		cli.configDir = filepath.Join(dir, "libreva")
+	}
+
+	// Flags take precedence over environment variables, which take precedence over the profiles file
+	if cli.host == "" {
+		cli.host = trimmedEnv(envHost)
+	}
+	if cli.remote == "" {
+		cli.remote = trimmedEnv(envRemote)
+	}
+	if !cli.insecure {
+		if value := trimmedEnv(envInsecure); value != "" {
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return &usageError{err: fmt.Errorf("invalid value for %v: %v", envInsecure, value)}
+			}
+			cli.insecure = insecure
+		}
+	}
+
+	if cli.host != "" {
+		if cli.remote != "" {
+			return &usageError{err: fmt.Errorf("a host and a remote can't be used at the same time")}
+		}
+		cli.profile = &reva.Profile{
+			Name:        cli.host,
+			Gateway:     cli.host,
+			TLS:         reva.TLSSettings{Insecure: cli.insecure},
+			LoginMethod: reva.DefaultLoginMethod,
+			Credentials: reva.CredentialSettings{Source: reva.CredentialSourceEnv},
+			Home:        reva.DefaultHomePath,
+		}
+		return nil
+	}
+
+	path := os.Getenv(reva.ProfilesEnvVar)
+	if path == "" {
+		path = filepath.Join(cli.configDir, profilesFileName)
+	}
+	profiles, err := reva.LoadProfiles(path)
+	if errors.Is(err, os.ErrNotExist) && cli.remote == "" {
+		// Commands that don't need a connection work without any configuration
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cli.profile, err = profiles.Profile(cli.remote); err != nil {
+		return &usageError{err: err}
+	}
+	return nil
+}
+
+// connect creates a new session connected to the gateway of the profile; it isn't logged in yet.
+func (cli *cli) connect() (*reva.Session, error) {
+	if cli.profile == nil {
+		return nil, &usageError{err: fmt.Errorf("no host specified; use -host, -remote, %v or the profiles file", envHost)}
+	}
+	return cli.profile.Connect(cli.sessionOptions()...)
+}
+
+// openSession connects to the host and logs in using the stored token or, if there is none, the credentials from the environment.
+func (cli *cli) openSession() (*reva.Session, error) {
+	session, err := cli.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &sessionState{}
+	if err := readJSONFile(filepath.Join(cli.configDir, sessionFileName), state); err != nil {
+		return nil, err
+	}
+	if state.Token != "" && state.Host == cli.profile.Gateway {
+		return session, session.LoginWithToken(state.Token)
+	}
+
+	// Without a stored token, the credentials configured for the profile (by default, the environment) are used
+	if err := cli.profile.Login(session); errors.Is(err, reva.ErrNoCredentials) {
+		return nil, errNotLoggedIn
+	} else if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (cli *cli) saveSession(state *sessionState) error {
+	if err := os.MkdirAll(cli.configDir, 0700); err != nil {
+		return fmt.Errorf("unable to create the configuration directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The token grants access to the user's files, so only the user may read it
+	if err := ioutil.WriteFile(filepath.Join(cli.configDir, sessionFileName), data, 0600); err != nil {
+		return fmt.Errorf("unable to store the session: %v", err)
+	}
+	return nil
+}
+
+func (cli *cli) removeSession() error {
+	if err := os.Remove(filepath.Join(cli.configDir, sessionFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove the stored session: %v", err)
+	}
+	return nil
+}
+
+// prompt asks the user for a value; if hidden is set and the input is a terminal, the input isn't echoed.
+func (cli *cli) prompt(text string, hidden bool) (string, error) {
+	fmt.Fprint(cli.stderr, text)
+
+	if file, ok := cli.stdin.(*os.File); ok && hidden && term.IsTerminal(int(file.Fd())) {
+		value, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(cli.stderr)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the input: %v", err)
+		}
+		return string(value), nil
+	}
+
+	if cli.input == nil {
+		cli.input = bufio.NewReader(cli.stdin)
+	}
+	value, err := cli.input.ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("unable to read the input: %v", err)
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unable to parse '%v': %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"errors"
+	stdnet "net"
+	"net/http"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+// The exit codes of the command-line client; scripts may rely on them, so existing codes must never change.
+const (
+	exitOK               = 0
+	exitFailure          = 1
+	exitUsage            = 2
+	exitNotFound         = 3
+	exitAlreadyExists    = 4
+	exitPermissionDenied = 5
+	exitUnauthenticated  = 6
+	exitUnavailable      = 7
+	exitChecksumMismatch = 8
+)
+
+var exitCodeDescriptions = map[int]string{
+	exitOK:               "success",
+	exitFailure:          "general failure",
+	exitUsage:            "invalid usage",
+	exitNotFound:         "resource not found",
+	exitAlreadyExists:    "resource already exists",
+	exitPermissionDenied: "permission denied",
+	exitUnauthenticated:  "not logged in or session expired",
+	exitUnavailable:      "server unavailable",
+	exitChecksumMismatch: "checksum mismatch",
+}
+
+// usageError is returned if a command has been invoked incorrectly.
+type usageError struct {
+	err error
+}
+
+func (err *usageError) Error() string {
+	return err.err.Error()
+}
+
+func (err *usageError) Unwrap() error {
+	return err.err
+}
+
+// exitCode maps an error to the exit code of the client, based on the typed errors returned by the library.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		return exitUsage
+	}
+	if errors.Is(err, errNotLoggedIn) {
+		return exitUnauthenticated
+	}
+	if errors.Is(err, action.ErrChecksumMismatch) {
+		return exitChecksumMismatch
+	}
+
+	var rpcErr *net.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcExitCode(rpcErr.Code)
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcExitCode(grpcErr.GRPCStatus().Code())
+	}
+
+	var httpErr *net.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpExitCode(httpErr)
+	}
+
+	var netErr stdnet.Error
+	if errors.As(err, &netErr) {
+		return exitUnavailable
+	}
+
+	return exitFailure
+}
+
+func rpcExitCode(code rpc.Code) int {
+	switch code {
+	case rpc.Code_CODE_NOT_FOUND:
+		return exitNotFound
+	case rpc.Code_CODE_ALREADY_EXISTS:
+		return exitAlreadyExists
+	case rpc.Code_CODE_PERMISSION_DENIED:
+		return exitPermissionDenied
+	case rpc.Code_CODE_UNAUTHENTICATED:
+		return exitUnauthenticated
+	case rpc.Code_CODE_UNAVAILABLE, rpc.Code_CODE_DEADLINE_EXCEEDED:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+func grpcExitCode(code codes.Code) int {
+	switch code {
+	case codes.NotFound:
+		return exitNotFound
+	case codes.AlreadyExists:
+		return exitAlreadyExists
+	case codes.PermissionDenied:
+		return exitPermissionDenied
+	case codes.Unauthenticated:
+		return exitUnauthenticated
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+func httpExitCode(err *net.HTTPError) int {
+	switch {
+	case err.IsChecksumMismatch():
+		return exitChecksumMismatch
+	case err.StatusCode == http.StatusNotFound:
+		return exitNotFound
+	case err.StatusCode == http.StatusForbidden:
+		return exitPermissionDenied
+	case err.StatusCode == http.StatusUnauthorized:
+		return exitUnauthenticated
+	case err.StatusCode == http.StatusServiceUnavailable || err.StatusCode == http.StatusBadGateway || err.StatusCode == http.StatusGatewayTimeout:
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+
+	// needsSession specifies whether the command requires a logged-in session
+	needsSession bool
+	run          func(cli *cli, args []string) error
+}
+
+// commands lists all commands; it is filled in init, since the shell refers to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"login", "login [-method name] [username]", "Logs into Reva and stores the session token", false, runLogin},
+		{"logout", "logout", "Discards the stored session token", false, runLogout},
+		{"whoami", "whoami", "Shows the currently logged-in user", true, runWhoAmI},
+		{"ls", "ls [-R] [path]", "Lists the contents of a directory", true, runList},
+		{"stat", "stat path", "Shows information about a file or directory", true, runStat},
+		{"mkdir", "mkdir [-p] path", "Creates a directory", true, runMakeDir},
+		{"put", "put [-tus] [-workers n] local [remote]", "Uploads a file or directory ('-' reads from stdin)", true, runPut},
+		{"get", "get [-workers n] remote [local]", "Downloads a file or directory ('-' writes to stdout)", true, runGet},
+		{"mv", "mv source target", "Moves or renames a file or directory", true, runMove},
+		{"cp", "cp source target", "Copies a file", true, runCopy},
+		{"rm", "rm [-r] path", "Removes a file or directory", true, runRemove},
+		{"share", "share [-role viewer|editor] [-public] [-password|-password-stdin] [-expires duration] path [user]", "Shares a file or directory with a user or via a public link", true, runShare},
+		{"shell", "shell", "Starts an interactive shell with a current working directory", true, runShell},
+		{"serve", "serve [-addr address] [-root path] webdav|s3", "Serves a remote directory locally via WebDAV or an S3-compatible API", true, runServe},
+	}
+}
+
+// cli holds the global options and state of a single invocation.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	input  *bufio.Reader
+
+	host      string
+	insecure  bool
+	remote    string
+	configDir string
+	verbose   bool
+
+	profile *reva.Profile
+	session *reva.Session
+	command *command
+	output  outputFormat
+
+	// cwd is the remote working directory of the shell; if empty, the home directory is used.
+	cwd string
+}
+
+func (cli *cli) usage(flags *flag.FlagSet) {
+	fmt.Fprintf(cli.stderr, "Usage: libreva [options] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(cli.stderr, "  %-8s %v\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(cli.stderr, "\nAll commands accept -output json|table|plain to select the output format.\n")
+	fmt.Fprintf(cli.stderr, "\nOptions:\n")
+	flags.PrintDefaults()
+	fmt.Fprintf(cli.stderr, "\nEnvironment variables:\n")
+	for _, name := range []string{envHost, envInsecure, envRemote, envConfigDir, envUser, envPassword, envLinkPassword, reva.ProfilesEnvVar} {
+		fmt.Fprintf(cli.stderr, "  %v\n", name)
+	}
+	fmt.Fprintf(cli.stderr, "\nExit codes:\n")
+	codes := make([]int, 0, len(exitCodeDescriptions))
+	for code := range exitCodeDescriptions {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(cli.stderr, "  %v  %v\n", code, exitCodeDescriptions[code])
+	}
+}
+
+func (cli *cli) run(args []string) int {
+	flags := flag.NewFlagSet("libreva", flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	flags.StringVar(&cli.host, "host", "", "address of the Reva gateway (host:port)")
+	flags.BoolVar(&cli.insecure, "insecure", false, "connect to the gateway without TLS")
+	flags.StringVar(&cli.remote, "remote", "", "name of the remote in the profiles file to connect to")
+	flags.StringVar(&cli.configDir, "config-dir", "", "directory holding the configuration file and the session token")
+	flags.BoolVar(&cli.verbose, "verbose", false, "log details about all operations")
+	flags.Usage = func() { cli.usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		cli.usage(flags)
+		return exitUsage
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == flags.Arg(0) {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(cli.stderr, "libreva: unknown command '%v'\n", flags.Arg(0))
+		cli.usage(flags)
+		return exitUsage
+	}
+
+	if err := cli.execute(cmd, flags.Args()[1:]); err != nil {
+		fmt.Fprintf(cli.stderr, "libreva %v: %v\n", cmd.name, reva.Redact(err.Error()))
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+func (cli *cli) execute(cmd *command, args []string) error {
+	cli.command = cmd
+	if err := cli.loadConfig(); err != nil {
+		return err
+	}
+
+	if cmd.needsSession {
+		session, err := cli.openSession()
+		if err != nil {
+			return err
+		}
+		cli.session = session
+	}
+
+	return cmd.run(cli, args)
+}
+
+func (cli *cli) sessionOptions() []reva.SessionOption {
+	if !cli.verbose {
+		return nil
+	}
+	return []reva.SessionOption{reva.WithLogger(reva.NewStdLogger(log.New(cli.stderr, "", log.LstdFlags), reva.LogLevelDebug))}
+}
+
+// newFlagSet creates the flag set of the current command; its usage is printed on errors.
+func (cli *cli) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(cli.stderr)
+	flags.Var(&cli.output, "output", "the output format (json, table or plain)")
+	flags.Usage = func() {
+		if cli.command != nil {
+			fmt.Fprintf(cli.stderr, "Usage: libreva %v\n", cli.command.usage)
+		}
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the command arguments, making sure that the number of remaining arguments is within the given bounds.
+func (cli *cli) parseFlags(flags *flag.FlagSet, args []string, minArgs int, maxArgs int) error {
+	if err := flags.Parse(args); err != nil {
+		return &usageError{err: err}
+	}
+	if flags.NArg() < minArgs || flags.NArg() > maxArgs {
+		flags.Usage()
+		return &usageError{err: fmt.Errorf("invalid number of arguments")}
+	}
+	return nil
+}
+
+func newCLI(stdin io.Reader, stdout io.Writer, stderr io.Writer) *cli {
+	return &cli{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		output: outputPlain,
+	}
+}
+
+func main() {
+	os.Exit(newCLI(os.Stdin, os.Stdout, os.Stderr).run(os.Args[1:]))
+}
+
+func trimmedEnv(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
@@ -0,0 +1,359 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{fmt.Errorf("something failed"), exitFailure},
+		{&usageError{err: fmt.Errorf("invalid number of arguments")}, exitUsage},
+		{errNotLoggedIn, exitUnauthenticated},
+		{fmt.Errorf("stat failed: %w", &net.RPCError{Code: rpc.Code_CODE_NOT_FOUND}), exitNotFound},
+		{&net.RPCError{Code: rpc.Code_CODE_ALREADY_EXISTS}, exitAlreadyExists},
+		{&net.RPCError{Code: rpc.Code_CODE_PERMISSION_DENIED}, exitPermissionDenied},
+		{&net.HTTPError{StatusCode: 401}, exitUnauthenticated},
+		{&net.HTTPError{StatusCode: 503}, exitUnavailable},
+		{&net.HTTPError{StatusCode: 460}, exitChecksumMismatch},
+		{&action.ChecksumMismatchError{Path: "/home/file.txt"}, exitChecksumMismatch},
+	}
+
+	for _, test := range tests {
+		if code := exitCode(test.err); code != test.code {
+			t.Errorf(testintl.FormatTestResult("exitCode", test.code, code, test.err))
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	t.Setenv(envUser, "")
+	t.Setenv(envPassword, "")
+	t.Setenv(envLinkPassword, "env secret")
+	configDir := t.TempDir()
+	localDir := t.TempDir()
+	localFile := filepath.Join(localDir, "upload.txt")
+	if err := ioutil.WriteFile(localFile, []byte("HELLO CLI WORLD!\n"), 0600); err != nil {
+		t.Fatalf(testintl.FormatTestError("ioutil.WriteFile", err, localFile))
+	}
+	gw.WriteFile("/home/existing.txt", []byte("EXISTING\n"), time.Now())
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		output string
+	}{
+		{[]string{"ls"}, "", exitUnauthenticated, ""},
+		{[]string{"login"}, testintl.TestGatewayUser + "\nwrong\n", exitUnauthenticated, ""},
+		{[]string{"login", "-method", "Basic"}, testintl.TestGatewayUser + "\n" + testintl.TestGatewayPassword + "\n", exitOK, "Logged into"},
+		{[]string{"login"}, testintl.TestGatewayUser + "\n" + testintl.TestGatewayPassword + "\n", exitOK, "Logged into"},
+		{[]string{"whoami"}, "", exitOK, testintl.TestGatewayUser},
+		{[]string{"mkdir", "docs/sub"}, "", exitFailure, ""},
+		{[]string{"mkdir", "-p", "docs/sub"}, "", exitOK, ""},
+		{[]string{"put", localFile, "docs"}, "", exitOK, ""},
+		{[]string{"put", "-", "/home/stdin.txt"}, "FROM STDIN\n", exitOK, ""},
+		{[]string{"ls", "-R"}, "", exitOK, "/home/docs/upload.txt"},
+		{[]string{"stat", "/home/docs/upload.txt"}, "", exitOK, "Size:        17"},
+		{[]string{"stat", "--output", "json", "docs/upload.txt"}, "", exitOK, `"size": 17`},
+		{[]string{"ls", "--output", "json", "docs"}, "", exitOK, `"path": "/home/docs/upload.txt"`},
+		{[]string{"ls", "--output", "table", "docs"}, "", exitOK, "TYPE"},
+		{[]string{"ls", "--output", "xml", "docs"}, "", exitUsage, ""},
+		{[]string{"stat", "missing.txt"}, "", exitNotFound, ""},
+		{[]string{"get", "stdin.txt", "-"}, "", exitOK, "FROM STDIN\n"},
+		{[]string{"get", "docs/upload.txt", filepath.Join(localDir, "download.txt")}, "", exitOK, ""},
+		{[]string{"cp", "existing.txt", "docs"}, "", exitOK, ""},
+		{[]string{"mv", "stdin.txt", "moved.txt"}, "", exitOK, ""},
+		{[]string{"rm", "docs"}, "", exitFailure, ""},
+		{[]string{"rm", "-r", "docs/sub"}, "", exitOK, ""},
+		{[]string{"share", "-role", "editor", "existing.txt", testintl.TestGatewayGuest}, "", exitOK, "Shared"},
+		{[]string{"share", "-public", "-expires", "24h", "existing.txt"}, "", exitOK, "public-"},
+		{[]string{"share", "--output", "json", "-public", "existing.txt"}, "", exitOK, `"public": true`},
+		{[]string{"share", "--output", "json", "-public", "-password-stdin", "existing.txt"}, "link secret\n", exitOK, `"passwordProtected": true`},
+		{[]string{"share", "--output", "json", "-public", "-password", "existing.txt"}, "", exitOK, `"passwordProtected": true`},
+		{[]string{"share", "-public", "-password-stdin", "existing.txt"}, "\n", exitUsage, ""},
+		{[]string{"share", "-role", "owner", "existing.txt", testintl.TestGatewayGuest}, "", exitUsage, ""},
+		{[]string{"serve", "ftp"}, "", exitUsage, ""},
+		{[]string{"serve", "-addr", "localhost:-1", "webdav"}, "", exitFailure, ""},
+		{[]string{"serve", "-addr", "localhost:-1", "s3"}, "", exitFailure, ""},
+		{[]string{"serve", "-addr", "0.0.0.0:-1", "webdav"}, "", exitUsage, ""},
+		{[]string{"serve", "-addr", ":-1", "s3"}, "", exitUsage, ""},
+		{[]string{"serve", "-addr", "0.0.0.0:-1", "-insecure-listen", "webdav"}, "", exitFailure, ""},
+		{[]string{"frobnicate"}, "", exitUsage, ""},
+		{[]string{"logout"}, "", exitOK, ""},
+		{[]string{"whoami"}, "", exitUnauthenticated, ""},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		args := append([]string{"-host", gw.Address(), "-insecure", "-config-dir", configDir}, test.args...)
+		cli := newCLI(strings.NewReader(test.stdin), &stdout, &stderr)
+		if code := cli.run(args); code != test.code {
+			t.Errorf(testintl.FormatTestResult("cli.run", test.code, code, test.args, stderr.String()))
+		} else if !strings.Contains(stdout.String(), test.output) {
+			t.Errorf(testintl.FormatTestResult("cli.run", test.output, stdout.String(), test.args))
+		}
+	}
+
+	if data, _ := gw.ReadFile("/home/docs/existing.txt"); string(data) != "EXISTING\n" {
+		t.Errorf(testintl.FormatTestResult("cp", "EXISTING\n", string(data), "existing.txt", "docs"))
+	}
+	if !gw.Exists("/home/moved.txt") || gw.Exists("/home/stdin.txt") || gw.Exists("/home/docs/sub") {
+		t.Errorf(testintl.FormatTestError("cli.run", fmt.Errorf("the remote files don't match the executed commands")))
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(localDir, "download.txt")); err != nil || string(data) != "HELLO CLI WORLD!\n" {
+		t.Errorf(testintl.FormatTestResult("get", "HELLO CLI WORLD!\n", string(data), "docs/upload.txt"))
+	}
+	if _, err := os.Stat(filepath.Join(configDir, sessionFileName)); !os.IsNotExist(err) {
+		t.Errorf(testintl.FormatTestError("logout", fmt.Errorf("the session file wasn't removed")))
+	}
+}
+
+func TestShell(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	t.Setenv(envUser, testintl.TestGatewayUser)
+	t.Setenv(envPassword, testintl.TestGatewayPassword)
+	configDir := t.TempDir()
+	gw.WriteFile("/home/docs/my file.txt", []byte("SHELL\n"), time.Now())
+	gw.WriteFile("/home/docs/notes.txt", []byte("NOTES\n"), time.Now())
+
+	script := strings.Join([]string{"cd docs", "pwd", "ls", "cd missing", "mv 'my file.txt' renamed.txt", "!2", "history", "frobnicate", "cd", "pwd", "exit", "pwd"}, "\n")
+	var stdout, stderr bytes.Buffer
+	cli := newCLI(strings.NewReader(script), &stdout, &stderr)
+	if code := cli.run([]string{"-host", gw.Address(), "-insecure", "-config-dir", configDir, "shell"}); code != exitOK {
+		t.Fatalf(testintl.FormatTestResult("cli.run", exitOK, code, "shell", stderr.String()))
+	}
+
+	output := stdout.String()
+	for _, expected := range []string{"/home/docs\n", "/home/docs/notes.txt", "/home/docs/renamed.txt", "    7  history", "/home\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf(testintl.FormatTestResult("shell", expected, output, script))
+		}
+	}
+	if strings.Count(output, "/home/docs\n") != 2 || strings.Count(output, "/home\n") != 1 {
+		t.Errorf(testintl.FormatTestResult("shell", "pwd output", output, script))
+	}
+	for _, expected := range []string{"cd: ", "frobnicate: unknown command"} {
+		if !strings.Contains(stderr.String(), expected) {
+			t.Errorf(testintl.FormatTestResult("shell", expected, stderr.String(), script))
+		}
+	}
+	if !gw.Exists("/home/docs/renamed.txt") {
+		t.Errorf(testintl.FormatTestError("shell", fmt.Errorf("relative paths weren't resolved against the working directory"), script))
+	}
+	if history, _ := ioutil.ReadFile(filepath.Join(configDir, historyFileName)); !strings.HasPrefix(string(history), "cd docs\npwd\n") {
+		t.Errorf(testintl.FormatTestResult("shell", "stored history", string(history), script))
+	}
+}
+
+func TestShellHistory(t *testing.T) {
+	cli := newCLI(strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	cli.configDir = t.TempDir()
+	sh := newShell(cli)
+
+	lines := []string{
+		"ls docs",
+		"share -public -password 'top secret' notes.txt",
+		"share -public --password=secret notes.txt",
+		"share -public -Password secret notes.txt",
+		"login alice",
+		`share -public -password "unterminated`,
+		"get password.txt",
+	}
+	for _, line := range lines {
+		sh.addHistory(line)
+	}
+
+	// Lines carrying secrets must not be stored, but can still be recalled during the session
+	history, _ := ioutil.ReadFile(filepath.Join(cli.configDir, historyFileName))
+	if string(history) != "ls docs\nget password.txt\n" {
+		t.Errorf(testintl.FormatTestResult("shell.addHistory", "ls docs\nget password.txt\n", string(history)))
+	}
+	if line, err := sh.recall("!2"); err != nil || line != lines[1] {
+		t.Errorf(testintl.FormatTestResult("shell.recall", lines[1], line, "!2"))
+	}
+}
+
+func TestShellCompletion(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	gw.WriteFile("/home/docs/report 2021.pdf", []byte("2021\n"), time.Now())
+	gw.WriteFile("/home/docs/report 2022.pdf", []byte("2022\n"), time.Now())
+	gw.WriteFile("/home/data/raw.bin", []byte("RAW\n"), time.Now())
+
+	cli := newCLI(strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	cli.profile = &reva.Profile{Home: "/home"}
+	cli.session = session
+	sh := newShell(cli)
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"wh", "whoami "},
+		{"get do", "get docs/"},
+		{"get docs/r", `get docs/report\ 202`},
+		{`get docs/report\ 2022`, `get docs/report\ 2022.pdf `},
+		{"get /home/da", "get /home/data/"},
+		{"get nothing", "get nothing"},
+	}
+
+	for _, test := range tests {
+		if line, pos, ok := sh.complete(test.line, len(test.line), '\t'); !ok || line != test.expected || pos != len(test.expected) {
+			t.Errorf(testintl.FormatTestResult("shell.complete", test.expected, line, test.line))
+		}
+	}
+
+	// Completions must be served from the cache until the listing expires
+	gw.WriteFile("/home/docs/zebra.txt", []byte("ZEBRA\n"), time.Now())
+	if line, _, _ := sh.complete("get docs/z", 10, '\t'); line != "get docs/z" {
+		t.Errorf(testintl.FormatTestResult("shell.complete", "get docs/z", line, "get docs/z"))
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"ls -R docs", []string{"ls", "-R", "docs"}},
+		{`  put  "my file.txt"   'other dir/' `, []string{"put", "my file.txt", "other dir/"}},
+		{`mv my\ file.txt "it's here"`, []string{"mv", "my file.txt", "it's here"}},
+		{`cd ""`, []string{"cd", ""}},
+		{`rm "unterminated`, nil},
+	}
+
+	for _, test := range tests {
+		if args, _ := splitLine(test.line); !reflect.DeepEqual(args, test.args) {
+			t.Errorf(testintl.FormatTestResult("splitLine", test.args, args, test.line))
+		}
+	}
+}
+
+func TestRemoteProfiles(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	t.Setenv(reva.ProfilesEnvVar, "")
+	t.Setenv(envHost, "")
+	t.Setenv(envRemote, "")
+	configDir := t.TempDir()
+	profiles := fmt.Sprintf("default: test\nremotes:\n  test:\n    gateway: %v\n    tls:\n      insecure: true\n    credentials:\n      source: static\n      user: %v\n      password: %v\n    home: /home/docs\n",
+		gw.Address(), testintl.TestGatewayUser, testintl.TestGatewayPassword)
+	if err := ioutil.WriteFile(filepath.Join(configDir, profilesFileName), []byte(profiles), 0600); err != nil {
+		t.Fatalf(testintl.FormatTestError("ioutil.WriteFile", err, profilesFileName))
+	}
+	gw.WriteFile("/home/docs/profile.txt", []byte("PROFILE\n"), time.Now())
+
+	tests := []struct {
+		args   []string
+		code   int
+		output string
+	}{
+		{[]string{"-remote", "test", "whoami"}, exitOK, testintl.TestGatewayUser},
+		{[]string{"ls"}, exitOK, "/home/docs/profile.txt"},
+		{[]string{"-remote", "missing", "ls"}, exitUsage, ""},
+		{[]string{"-remote", "test", "-host", gw.Address(), "ls"}, exitUsage, ""},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		cli := newCLI(strings.NewReader(""), &stdout, &stderr)
+		if code := cli.run(append([]string{"-config-dir", configDir}, test.args...)); code != test.code {
+			t.Errorf(testintl.FormatTestResult("cli.run", test.code, code, test.args, stderr.String()))
+		} else if !strings.Contains(stdout.String(), test.output) {
+			t.Errorf(testintl.FormatTestResult("cli.run", test.output, stdout.String(), test.args))
+		}
+	}
+}
+
+func TestGuardHandler(t *testing.T) {
+	const token = "0123456789abcdef"
+	handler := &guardHandler{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+		token:   token,
+	}
+
+	tests := []struct {
+		name      string
+		host      string
+		header    string
+		query     string
+		checkHost bool
+		status    int
+	}{
+		{"basic auth", "localhost:8080", "basic", "", true, http.StatusNoContent},
+		{"loopback address", "127.0.0.1:8080", "basic", "", true, http.StatusNoContent},
+		{"loopback IPv6 address", "[::1]:8080", "basic", "", true, http.StatusNoContent},
+		{"foreign host", "attacker.example.com", "basic", "", true, http.StatusForbidden},
+		{"foreign host allowed", "reva.example.com", "basic", "", false, http.StatusNoContent},
+		{"missing credentials", "localhost", "", "", true, http.StatusUnauthorized},
+		{"wrong password", "localhost", "Basic bGlicmV2YTp3cm9uZw==", "", true, http.StatusUnauthorized},
+		{"s3 v4", "localhost", "AWS4-HMAC-SHA256 Credential=" + token + "/20240101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", "", true, http.StatusNoContent},
+		{"s3 v4 wrong key", "localhost", "AWS4-HMAC-SHA256 Credential=wrong/20240101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=abc", "", true, http.StatusUnauthorized},
+		{"s3 v2", "localhost", "AWS " + token + ":signature", "", true, http.StatusNoContent},
+		{"s3 presigned", "localhost", "", "X-Amz-Credential=" + token + "%2F20240101%2Fus-east-1%2Fs3%2Faws4_request", true, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		handler.checkHost = test.checkHost
+		req := httptest.NewRequest(http.MethodGet, "/?"+test.query, nil)
+		req.Host = test.host
+		if test.header == "basic" {
+			req.SetBasicAuth(serveUser, token)
+		} else if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf(testintl.FormatTestResult("guardHandler.ServeHTTP", test.status, rec.Code, test.name))
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+// outputFormat specifies how the results of a command are printed; it is used as a flag value.
+type outputFormat string
+
+const (
+	// outputPlain prints results as simple lines of text.
+	outputPlain outputFormat = "plain"
+	// outputTable prints results as an aligned table with a header.
+	outputTable outputFormat = "table"
+	// outputJSON prints results as indented JSON.
+	outputJSON outputFormat = "json"
+)
+
+func (format *outputFormat) String() string {
+	return string(*format)
+}
+
+func (format *outputFormat) Set(value string) error {
+	switch f := outputFormat(strings.ToLower(value)); f {
+	case outputPlain, outputTable, outputJSON:
+		*format = f
+		return nil
+	default:
+		return fmt.Errorf("unknown output format '%v' (must be json, table or plain)", value)
+	}
+}
+
+// result holds the result of a command in all output formats.
+type result struct {
+	// value is encoded as JSON.
+	value interface{}
+	// headers and rows form the table output.
+	headers []string
+	rows    [][]string
+	// lines are printed in plain output.
+	lines []string
+}
+
+func (cli *cli) print(res *result) error {
+	switch cli.output {
+	case outputJSON:
+		encoder := json.NewEncoder(cli.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(res.value)
+
+	case outputTable:
+		writer := tabwriter.NewWriter(cli.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(res.headers, "\t"))
+		for _, row := range res.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+
+	default:
+		for _, line := range res.lines {
+			fmt.Fprintln(cli.stdout, line)
+		}
+		return nil
+	}
+}
+
+func messageResult(message string, fields map[string]string) *result {
+	res := &result{value: fields, headers: []string{"FIELD", "VALUE"}, lines: []string{message}}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res.rows = append(res.rows, []string{name, fields[name]})
+	}
+	return res
+}
+
+func fileEntriesResult(entries []*action.FileEntry) *result {
+	res := &result{value: entries, headers: []string{"TYPE", "SIZE", "MODIFIED", "PATH"}}
+	for _, entry := range entries {
+		res.rows = append(res.rows, []string{entry.Type, fmt.Sprint(entry.Size), valueOrDash(entry.Modified), entry.Path})
+		res.lines = append(res.lines, formatEntry(entry))
+	}
+	return res
+}
+
+func fileEntryResult(entry *action.FileEntry) *result {
+	fields := [][]string{
+		{"Path", entry.Path},
+		{"Type", entry.Type},
+		{"Size", fmt.Sprint(entry.Size)},
+		{"Modified", valueOrDash(entry.Modified)},
+		{"ETag", entry.ETag},
+	}
+	if entry.Checksum != "" {
+		fields = append(fields, []string{"Checksum", entry.ChecksumType + ":" + entry.Checksum})
+	}
+	if entry.Permissions != nil {
+		fields = append(fields, []string{"Permissions", strings.Join(entry.Permissions, ",")})
+	}
+	if entry.ID != "" {
+		fields = append(fields, []string{"ID", entry.ID})
+	}
+
+	res := &result{value: entry, headers: []string{"FIELD", "VALUE"}, rows: fields}
+	for _, field := range fields {
+		res.lines = append(res.lines, fmt.Sprintf("%-12s %v", field[0]+":", field[1]))
+	}
+	return res
+}
+
+func transferEntriesResult(entries []*action.TransferEntry) *result {
+	res := &result{value: entries, headers: []string{"STATUS", "SIZE", "REMOTE", "LOCAL", "ERROR"}}
+	for _, entry := range entries {
+		res.rows = append(res.rows, []string{entry.Status, fmt.Sprint(entry.Size), entry.RemotePath, valueOrDash(entry.LocalPath), valueOrDash(entry.Error)})
+		res.lines = append(res.lines, formatTransfer(entry))
+	}
+	return res
+}
+
+func transferEntryResult(entry *action.TransferEntry) *result {
+	res := transferEntriesResult([]*action.TransferEntry{entry})
+	res.value = entry
+	return res
+}
+
+func shareEntryResult(entry *action.ShareEntry, path string) *result {
+	res := &result{
+		value:   entry,
+		headers: []string{"ID", "ROLE", "GRANTEE", "TOKEN", "EXPIRES"},
+		rows:    [][]string{{entry.ID, entry.Role, valueOrDash(entry.Grantee), valueOrDash(entry.Token), valueOrDash(entry.Expires)}},
+	}
+	if entry.Public {
+		res.lines = []string{fmt.Sprintf("Created public link for '%v' (token: %v)", path, entry.Token)}
+	} else {
+		res.lines = []string{fmt.Sprintf("Shared '%v' with %v as %v (share ID: %v)", path, entry.Grantee, entry.Role, entry.ID)}
+	}
+	return res
+}
+
+func formatEntry(entry *action.FileEntry) string {
+	typeFlag := "-"
+	if entry.IsDir() {
+		typeFlag = "d"
+	}
+	return fmt.Sprintf("%v %12d %-25v %v", typeFlag, entry.Size, valueOrDash(entry.Modified), entry.Path)
+}
+
+func formatTransfer(entry *action.TransferEntry) string {
+	switch entry.Status {
+	case "failed":
+		return fmt.Sprintf("failed:  %v: %v", entry.RemotePath, entry.Error)
+	case "skipped":
+		return fmt.Sprintf("skipped: %v", entry.RemotePath)
+	default:
+		return fmt.Sprintf("done:    %v (%v bytes)", entry.RemotePath, entry.Size)
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,273 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/revafs"
+	"github.com/Daniel-WWU-IT/libreva/pkg/revas3"
+)
+
+const (
+	// defaultServeAddress only accepts local connections, as the served data is accessible with the permissions of the logged-in user.
+	defaultServeAddress = "localhost:8080"
+	// serveUser is the user name that WebDAV clients have to log in with.
+	serveUser = "libreva"
+)
+
+// handlerCreator creates the HTTP handler serving the given remote directory.
+type handlerCreator func(cli *cli, root string) (http.Handler, error)
+
+// servers lists the protocols which Reva can be served through.
+var servers = []struct {
+	protocol   string
+	newHandler handlerCreator
+}{
+	{"webdav", newWebDAVHandler},
+	{"s3", newS3Handler},
+}
+
+func runServe(cli *cli, args []string) error {
+	flags := cli.newFlagSet("serve")
+	addr := flags.String("addr", defaultServeAddress, "the local address to listen on")
+	root := flags.String("root", "", "the remote directory to serve (defaults to the working directory)")
+	insecureListen := flags.Bool("insecure-listen", false, "allow listening on addresses which aren't loopback addresses")
+	if err := cli.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	protocol := strings.ToLower(flags.Arg(0))
+	var newHandler handlerCreator
+	for _, server := range servers {
+		if server.protocol == protocol {
+			newHandler = server.newHandler
+		}
+	}
+	if newHandler == nil {
+		return &usageError{err: fmt.Errorf("unknown protocol '%v'", flags.Arg(0))}
+	}
+
+	if host, _, err := net.SplitHostPort(*addr); err == nil && !isLoopbackHost(host) && !*insecureListen {
+		return &usageError{err: fmt.Errorf("refusing to listen on the non-loopback address %v (use -insecure-listen to override)", *addr)}
+	}
+
+	token, err := newServeToken()
+	if err != nil {
+		return err
+	}
+
+	path := cli.remotePath(*root)
+	handler, err := newHandler(cli, path)
+	if err != nil {
+		return err
+	}
+	if closer, ok := handler.(io.Closer); ok {
+		defer closer.Close()
+	}
+	handler = &guardHandler{handler: handler, token: token, checkHost: !*insecureListen}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		// Not a network error in terms of the exit codes, as these refer to the connection to Reva
+		return fmt.Errorf("unable to listen on %v: %v", *addr, err)
+	}
+	url := fmt.Sprintf("http://%v/", listener.Addr())
+	res := messageResult(fmt.Sprintf("Serving %v via %v on %v (press Ctrl-C to stop)", path, protocol, url), map[string]string{"root": path, "protocol": protocol, "url": url, "user": serveUser, "token": token})
+	if protocol == "s3" {
+		res.lines = append(res.lines, fmt.Sprintf("Access key: %v (any secret key is accepted)", token))
+	} else {
+		res.lines = append(res.lines, fmt.Sprintf("User: %v, password: %v", serveUser, token))
+	}
+	if err := cli.print(res); err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	// Serve until interrupted, letting running requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Handler: handler}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func newWebDAVHandler(cli *cli, root string) (http.Handler, error) {
+	fsys, err := revafs.NewWebDAV(cli.session, root)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &webdav.Handler{
+		FileSystem: fsys,
+		LockSystem: webdav.NewMemLS(),
+	}
+	if cli.verbose {
+		logger := log.New(cli.stderr, "", log.LstdFlags)
+		handler.Logger = func(r *http.Request, err error) {
+			if err != nil {
+				logger.Printf("%v %v: %v", r.Method, r.URL.Path, err)
+			} else {
+				logger.Printf("%v %v", r.Method, r.URL.Path)
+			}
+		}
+	}
+	return handler, nil
+}
+
+func newS3Handler(cli *cli, root string) (http.Handler, error) {
+	gw, err := revas3.New(cli.session, root)
+	if err != nil {
+		return nil, err
+	}
+	if !cli.verbose {
+		return gw, nil
+	}
+
+	logger := log.New(cli.stderr, "", log.LstdFlags)
+	return &loggingHandler{handler: gw, logger: logger}, nil
+}
+
+// guardHandler only passes on requests which carry the access token and, unless disabled, are addressed to a loopback host.
+//
+// The token is accepted as the password of HTTP basic authentication or as the access key of S3 requests; S3 signatures
+// aren't verified, so the access key acts as a bearer token.
+type guardHandler struct {
+	handler   http.Handler
+	token     string
+	checkHost bool
+}
+
+func (h *guardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.checkHost && !isLoopbackHost(requestHost(r)) {
+		// Protects against DNS rebinding attacks through browsers
+		http.Error(w, "invalid host", http.StatusForbidden)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="libreva"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *guardHandler) authorized(r *http.Request) bool {
+	if _, password, ok := r.BasicAuth(); ok {
+		return h.matches(password)
+	}
+	return h.matches(s3AccessKey(r))
+}
+
+func (h *guardHandler) matches(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// s3AccessKey extracts the access key of an S3 request signed with signature version 2 or 4, either via the
+// Authorization header or a presigned URL.
+func s3AccessKey(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(auth, "AWS4-HMAC-SHA256 "):
+		for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+			if credential := strings.TrimPrefix(strings.TrimSpace(field), "Credential="); credential != strings.TrimSpace(field) {
+				return strings.SplitN(credential, "/", 2)[0]
+			}
+		}
+	case strings.HasPrefix(auth, "AWS "):
+		return strings.SplitN(strings.TrimPrefix(auth, "AWS "), ":", 2)[0]
+	}
+
+	query := r.URL.Query()
+	if credential := query.Get("X-Amz-Credential"); credential != "" {
+		return strings.SplitN(credential, "/", 2)[0]
+	}
+	return query.Get("AWSAccessKeyId")
+}
+
+// requestHost returns the host of a request without the port.
+func requestHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+	return r.Host
+}
+
+// isLoopbackHost checks whether the given host name or address refers to the local machine.
+func isLoopbackHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// newServeToken generates the random token required to access the server.
+func newServeToken() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("unable to generate the access token: %v", err)
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// loggingHandler logs all requests before passing them on.
+type loggingHandler struct {
+	handler http.Handler
+	logger  *log.Logger
+}
+
+func (h *loggingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.logger.Printf("%v %v", r.Method, r.URL.RequestURI())
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *loggingHandler) Close() error {
+	if closer, ok := h.handler.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
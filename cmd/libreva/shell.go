@@ -0,0 +1,519 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	p "path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"golang.org/x/term"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+const (
+	historyFileName = "history"
+	// historySize is the maximum number of lines kept in the history file.
+	historySize = 500
+
+	// Directory listings used for tab completion are cached for a short time only, as the remote files might change.
+	listingCacheTTL  = 30 * time.Second
+	listingCacheSize = 32
+)
+
+// shellBuiltins are the commands handled by the shell itself; all other commands requiring a session are available as well.
+var shellBuiltins = []struct {
+	name        string
+	description string
+}{
+	{"cd", "Changes the remote working directory (without an argument, to the home directory)"},
+	{"pwd", "Prints the remote working directory"},
+	{"lcd", "Changes the local working directory"},
+	{"lpwd", "Prints the local working directory"},
+	{"history", "Lists the command history; !n repeats the n-th command, !! the last one"},
+	{"help", "Lists all available commands"},
+	{"exit", "Leaves the shell (as does quit or Ctrl-D)"},
+}
+
+type cachedListing struct {
+	infos   []*storage.ResourceInfo
+	fetched time.Time
+}
+
+// shell is an interactive session that keeps the connection open and tracks a remote working directory.
+type shell struct {
+	cli *cli
+
+	terminal *term.Terminal
+	fd       int
+
+	history     []string
+	historyPath string
+
+	listings map[string]*cachedListing
+}
+
+func runShell(cli *cli, args []string) error {
+	if err := cli.parseFlags(cli.newFlagSet("shell"), args, 0, 0); err != nil {
+		return err
+	}
+	return newShell(cli).run()
+}
+
+func newShell(cli *cli) *shell {
+	sh := &shell{
+		cli:         cli,
+		historyPath: filepath.Join(cli.configDir, historyFileName),
+		listings:    make(map[string]*cachedListing),
+	}
+
+	// Line editing is only possible if both input and output are a terminal; otherwise, commands are simply read line by line
+	if in, ok := cli.stdin.(*os.File); ok && term.IsTerminal(int(in.Fd())) {
+		if out, ok := cli.stdout.(*os.File); ok && term.IsTerminal(int(out.Fd())) {
+			sh.fd = int(in.Fd())
+			sh.terminal = term.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{in, out}, "")
+			sh.terminal.AutoCompleteCallback = sh.complete
+		}
+	}
+	return sh
+}
+
+func (sh *shell) run() error {
+	sh.loadHistory()
+
+	// The output format given to the shell becomes the default of all commands
+	defaultOutput := sh.cli.output
+	for {
+		line, err := sh.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			if line, err = sh.recall(line); err != nil {
+				fmt.Fprintf(sh.cli.stderr, "%v\n", err)
+				continue
+			}
+			fmt.Fprintln(sh.cli.stdout, line)
+		}
+		sh.addHistory(line)
+
+		args, err := splitLine(line)
+		if err != nil {
+			fmt.Fprintf(sh.cli.stderr, "%v\n", err)
+			continue
+		}
+
+		sh.cli.output = defaultOutput
+		if exit := sh.execute(args); exit {
+			return nil
+		}
+	}
+}
+
+// execute runs a single command; it returns true if the shell should be left.
+func (sh *shell) execute(args []string) bool {
+	name := args[0]
+	var err error
+	switch name {
+	case "exit", "quit":
+		return true
+	case "cd":
+		err = sh.changeDir(args[1:])
+	case "pwd":
+		fmt.Fprintln(sh.cli.stdout, sh.cli.workingDir())
+	case "lcd":
+		if len(args) != 2 {
+			err = fmt.Errorf("usage: lcd path")
+		} else {
+			err = os.Chdir(args[1])
+		}
+	case "lpwd":
+		var dir string
+		if dir, err = os.Getwd(); err == nil {
+			fmt.Fprintln(sh.cli.stdout, dir)
+		}
+	case "history":
+		for i, line := range sh.history {
+			fmt.Fprintf(sh.cli.stdout, "%5d  %v\n", i+1, line)
+		}
+	case "help":
+		sh.help()
+	default:
+		cmd := findShellCommand(name)
+		if cmd == nil {
+			err = fmt.Errorf("unknown command '%v'; type 'help' to list all commands", name)
+			break
+		}
+
+		sh.cli.command = cmd
+		err = cmd.run(sh.cli, args[1:])
+
+		// Commands other than listings might have modified the remote files
+		if name != "ls" && name != "stat" && name != "whoami" {
+			sh.listings = make(map[string]*cachedListing)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(sh.cli.stderr, "%v: %v\n", name, err)
+	}
+	return false
+}
+
+func (sh *shell) changeDir(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: cd [path]")
+	}
+	if len(args) == 0 {
+		sh.cli.cwd = sh.cli.profile.Home
+		return nil
+	}
+
+	path := sh.cli.remotePath(args[0])
+	info, err := action.MustNewFileOperationsAction(sh.cli.session).Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return fmt.Errorf("'%v' is not a directory", path)
+	}
+	sh.cli.cwd = path
+	return nil
+}
+
+func (sh *shell) help() {
+	fmt.Fprintf(sh.cli.stdout, "Shell commands:\n")
+	for _, builtin := range shellBuiltins {
+		fmt.Fprintf(sh.cli.stdout, "  %-8s %v\n", builtin.name, builtin.description)
+	}
+	fmt.Fprintf(sh.cli.stdout, "\nRemote commands (use -h for details):\n")
+	for _, cmd := range commands {
+		if isShellCommand(cmd) {
+			fmt.Fprintf(sh.cli.stdout, "  %-8s %v\n", cmd.name, cmd.description)
+		}
+	}
+	fmt.Fprintf(sh.cli.stdout, "\nRelative remote paths refer to the working directory; press Tab to complete commands and remote paths.\n")
+}
+
+func (sh *shell) readLine() (string, error) {
+	if sh.terminal == nil {
+		if sh.cli.input == nil {
+			sh.cli.input = bufio.NewReader(sh.cli.stdin)
+		}
+		line, err := sh.cli.input.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return line, err
+	}
+
+	// The terminal is only put into raw mode while reading, so that commands behave normally (e.g., can be interrupted)
+	state, err := term.MakeRaw(sh.fd)
+	if err != nil {
+		return "", fmt.Errorf("unable to prepare the terminal: %v", err)
+	}
+	defer term.Restore(sh.fd, state)
+
+	if width, height, err := term.GetSize(sh.fd); err == nil {
+		_ = sh.terminal.SetSize(width, height)
+	}
+	sh.terminal.SetPrompt(fmt.Sprintf("libreva:%v> ", sh.cli.workingDir()))
+	return sh.terminal.ReadLine()
+}
+
+// complete is called by the terminal for every key press; it completes command names and remote paths when Tab is pressed.
+func (sh *shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	head := line[:pos]
+	start := wordStart(head)
+	word := unescapeWord(head[start:])
+
+	var candidates []string
+	if strings.TrimSpace(head[:start]) == "" {
+		candidates = completeCommand(word)
+	} else {
+		candidates = sh.completePath(word)
+	}
+	if len(candidates) == 0 {
+		return line, pos, true
+	}
+
+	completion := escapeWord(commonPrefix(candidates))
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+	return head[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// completePath returns all remote paths starting with the given (partial) path; directories end with a slash.
+func (sh *shell) completePath(word string) []string {
+	dirPart, prefix := "", word
+	if index := strings.LastIndex(word, "/"); index != -1 {
+		dirPart, prefix = word[:index+1], word[index+1:]
+	}
+
+	var candidates []string
+	for _, info := range sh.listDir(sh.cli.remotePath(dirPart)) {
+		name := p.Base(info.Path)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			name += "/"
+		}
+		candidates = append(candidates, dirPart+name)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// listDir lists the contents of a remote directory, using the listing cache if possible.
+func (sh *shell) listDir(path string) []*storage.ResourceInfo {
+	if listing, ok := sh.listings[path]; ok && time.Since(listing.fetched) < listingCacheTTL {
+		return listing.infos
+	}
+
+	infos, err := action.MustNewEnumFilesAction(sh.cli.session).ListAll(path, false)
+	if err != nil {
+		return nil
+	}
+
+	// Make room by evicting the oldest listing
+	if len(sh.listings) >= listingCacheSize {
+		var oldest string
+		for dir, listing := range sh.listings {
+			if oldest == "" || listing.fetched.Before(sh.listings[oldest].fetched) {
+				oldest = dir
+			}
+		}
+		delete(sh.listings, oldest)
+	}
+	sh.listings[path] = &cachedListing{infos: infos, fetched: time.Now()}
+	return infos
+}
+
+func (sh *shell) loadHistory() {
+	data, err := ioutil.ReadFile(sh.historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			sh.history = append(sh.history, line)
+		}
+	}
+	if len(sh.history) > historySize {
+		sh.history = sh.history[len(sh.history)-historySize:]
+		_ = ioutil.WriteFile(sh.historyPath, []byte(strings.Join(sh.history, "\n")+"\n"), 0600)
+	}
+}
+
+func (sh *shell) addHistory(line string) {
+	sh.history = append(sh.history, line)
+
+	// Lines carrying secrets are only kept in memory; the history is only a convenience, so failing to store it is ignored
+	if hasSecrets(line) {
+		return
+	}
+	if err := os.MkdirAll(sh.cli.configDir, 0700); err != nil {
+		return
+	}
+	if file, err := os.OpenFile(sh.historyPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
+		fmt.Fprintln(file, line)
+		file.Close()
+	}
+}
+
+// hasSecrets checks whether a command line might contain secrets, i.e., passwords passed via flags or login arguments.
+func hasSecrets(line string) bool {
+	args, err := splitLine(line)
+	if err != nil {
+		return strings.Contains(strings.ToLower(line), "password")
+	}
+	if len(args) > 0 && args[0] == "login" {
+		return true
+	}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]; strings.EqualFold(name, "password") {
+			return true
+		}
+	}
+	return false
+}
+
+// recall resolves a history reference like !! or !n.
+func (sh *shell) recall(ref string) (string, error) {
+	if len(sh.history) == 0 {
+		return "", fmt.Errorf("%v: the history is empty", ref)
+	}
+	if ref == "!!" {
+		return sh.history[len(sh.history)-1], nil
+	}
+
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(sh.history) {
+		return "", fmt.Errorf("%v: no such history entry", ref)
+	}
+	return sh.history[n-1], nil
+}
+
+func isShellCommand(cmd *command) bool {
+	return cmd.needsSession && cmd.name != "shell"
+}
+
+func findShellCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name && isShellCommand(cmd) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func completeCommand(prefix string) []string {
+	var names []string
+	for _, builtin := range shellBuiltins {
+		names = append(names, builtin.name)
+	}
+	for _, cmd := range commands {
+		if isShellCommand(cmd) {
+			names = append(names, cmd.name)
+		}
+	}
+
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// splitLine splits a command line into its arguments; arguments can be quoted using single or double quotes, and backslashes escape the next character.
+func splitLine(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// wordStart returns the index of the word ending at the end of the given text, skipping escaped spaces.
+func wordStart(text string) int {
+	for i := len(text) - 1; i >= 0; i-- {
+		if text[i] == ' ' && (i == 0 || text[i-1] != '\\') {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func escapeWord(word string) string {
+	return strings.NewReplacer(`\`, `\\`, " ", `\ `, `"`, `\"`, "'", `\'`).Replace(word)
+}
+
+func unescapeWord(word string) string {
+	if args, err := splitLine(word); err == nil && len(args) == 1 {
+		return args[0]
+	}
+	return word
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, value := range values[1:] {
+		for !strings.HasPrefix(value, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
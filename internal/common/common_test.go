@@ -186,3 +186,32 @@ func TestGetValuesFromOpaque(t *testing.T) {
 		}
 	}
 }
+
+func TestCleanRelativePath(t *testing.T) {
+	tests := []struct {
+		input     string
+		wants     string
+		shouldErr bool
+	}{
+		{"dir/file.txt", "dir/file.txt", false},
+		{"./dir//sub/../file.txt", "dir/file.txt", false},
+		{"dir/", "dir", false},
+		{".", "", false},
+		{"dir\\file.txt", "dir/file.txt", false},
+		{"../file.txt", "", true},
+		{"dir/../../file.txt", "", true},
+		{"..\\file.txt", "", true},
+		{"/etc/passwd", "", true},
+	}
+
+	for _, test := range tests {
+		cleaned, err := common.CleanRelativePath(test.input)
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("CleanRelativePath", err, test.input))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("CleanRelativePath", fmt.Errorf("accepted an invalid path"), test.input))
+		} else if cleaned != test.wants {
+			t.Errorf(testintl.FormatTestResult("CleanRelativePath", test.wants, cleaned, test.input))
+		}
+	}
+}
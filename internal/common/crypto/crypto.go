@@ -19,12 +19,32 @@
 package crypto
 
 import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
 	"io"
+	"strings"
 
+	"github.com/cespare/xxhash/v2"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 )
 
+// The names of all supported checksum algorithms.
+const (
+	AlgorithmAdler32 = "adler32"
+	AlgorithmMD5     = "md5"
+	AlgorithmSHA1    = "sha1"
+	AlgorithmSHA256  = "sha256"
+	AlgorithmSHA512  = "sha512"
+	AlgorithmCRC32C  = "crc32c"
+	AlgorithmXXHash  = "xxhash"
+)
+
 // ComputeChecksum calculates the checksum of the given data using the specified checksum type.
 func ComputeChecksum(checksumType provider.ResourceChecksumType, data io.Reader) (string, error) {
 	switch checksumType {
@@ -41,17 +61,63 @@ func ComputeChecksum(checksumType provider.ResourceChecksumType, data io.Reader)
 	}
 }
 
+// ComputeChecksumByName calculates the checksum of the given data using the specified algorithm (see the Algorithm... constants).
+// Unlike ComputeChecksum, this also supports algorithms that have no CS3 checksum type.
+func ComputeChecksumByName(algorithm string, data io.Reader) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// NewChecksumHash creates a hash for the specified checksum type; the checksum is the hex-encoded sum of the hash.
+// This allows computing checksums of data that is written piece by piece.
+func NewChecksumHash(checksumType provider.ResourceChecksumType) (hash.Hash, error) {
+	switch checksumType {
+	case provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32, provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_SHA1:
+		return NewHash(GetChecksumTypeName(checksumType))
+	default:
+		return nil, fmt.Errorf("invalid checksum type: %s", checksumType)
+	}
+}
+
+// NewHash creates a hash for the specified algorithm (see the Algorithm... constants); the checksum is the hex-encoded sum of the hash.
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case AlgorithmAdler32:
+		return adler32.New(), nil
+	case AlgorithmMD5:
+		return md5.New(), nil
+	case AlgorithmSHA1:
+		return sha1.New(), nil
+	case AlgorithmSHA256:
+		return sha256.New(), nil
+	case AlgorithmSHA512:
+		return sha512.New(), nil
+	case AlgorithmCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	case AlgorithmXXHash:
+		return xxhash.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %v", algorithm)
+	}
+}
+
 // GetChecksumTypeName returns a stringified name of the given checksum type.
 func GetChecksumTypeName(checksumType provider.ResourceChecksumType) string {
 	switch checksumType {
 	case provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET:
 		return "unset"
 	case provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_SHA1:
-		return "sha1"
+		return AlgorithmSHA1
 	case provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32:
-		return "adler32"
+		return AlgorithmAdler32
 	case provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5:
-		return "md5"
+		return AlgorithmMD5
 	default:
 		return "invalid"
 	}
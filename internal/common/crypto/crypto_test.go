@@ -25,11 +25,14 @@
 package crypto_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 	"testing"
 
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"golang.org/x/crypto/pbkdf2"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
 	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
@@ -80,3 +83,116 @@ func TestGetChecksumTypeName(t *testing.T) {
 		}
 	}
 }
+
+func TestNewChecksumHash(t *testing.T) {
+	checksumTypes := []provider.ResourceChecksumType{
+		provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32,
+		provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_SHA1,
+		provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5,
+	}
+
+	for _, checksumType := range checksumTypes {
+		h, err := crypto.NewChecksumHash(checksumType)
+		if err != nil {
+			t.Errorf(testintl.FormatTestError("NewChecksumHash", err, checksumType))
+			continue
+		}
+
+		// Writing the data in pieces must yield the same checksum as computing it at once
+		_, _ = h.Write([]byte("Hello "))
+		_, _ = h.Write([]byte("World!"))
+		wants, _ := crypto.ComputeChecksum(checksumType, strings.NewReader("Hello World!"))
+		if got := fmt.Sprintf("%x", h.Sum(nil)); got != wants {
+			t.Errorf(testintl.FormatTestResult("NewChecksumHash", wants, got, checksumType))
+		}
+	}
+
+	if _, err := crypto.NewChecksumHash(provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET); err == nil {
+		t.Errorf(testintl.FormatTestError("NewChecksumHash", fmt.Errorf("accepted an unset checksum type w/o erring"), provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET))
+	}
+}
+
+var checksumsByName = map[string]string{
+	crypto.AlgorithmAdler32: "1c49043e",
+	crypto.AlgorithmMD5:     "ed076287532e86365e841e92bfc50d8c",
+	crypto.AlgorithmSHA1:    "2ef7bde608ce5404e97d5f042f95f89f1c232871",
+	crypto.AlgorithmSHA256:  "7f83b1657ff1fc53b92dc18148a1d65dfc2d4b1fa3d677284addd200126d9069",
+	crypto.AlgorithmSHA512:  "861844d6704e8573fec34d967e20bcfef3d424cf48be04e6dc08f2bd58c729743371015ead891cc3cf1c9d34b49264b510751b1ff9e537937bc46b5d6ff4ecc8",
+	crypto.AlgorithmCRC32C:  "fe6cf1dc",
+	crypto.AlgorithmXXHash:  "a52b286a3e7f4d91",
+}
+
+func TestComputeChecksumByName(t *testing.T) {
+	for algorithm, wants := range checksumsByName {
+		if checksum, err := crypto.ComputeChecksumByName(algorithm, strings.NewReader("Hello World!")); err == nil {
+			if checksum != wants {
+				t.Errorf(testintl.FormatTestResult("ComputeChecksumByName", wants, checksum, algorithm, "Hello World!"))
+			}
+		} else {
+			t.Errorf(testintl.FormatTestError("ComputeChecksumByName", err, algorithm, "Hello World!"))
+		}
+	}
+
+	if _, err := crypto.ComputeChecksumByName("rot13", strings.NewReader("Hello World!")); err == nil {
+		t.Errorf(testintl.FormatTestError("ComputeChecksumByName", fmt.Errorf("accepted an unsupported algorithm w/o erring"), "rot13", "Hello World!"))
+	}
+}
+
+func TestMultiHasher(t *testing.T) {
+	algorithms := make([]string, 0, len(checksumsByName))
+	for algorithm := range checksumsByName {
+		algorithms = append(algorithms, algorithm)
+	}
+
+	hasher, err := crypto.NewMultiHasher(append(algorithms, "SHA256", "")...)
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("NewMultiHasher", err, algorithms))
+	}
+	if len(hasher.Algorithms()) != len(algorithms) {
+		t.Errorf(testintl.FormatTestResult("MultiHasher.Algorithms", algorithms, hasher.Algorithms()))
+	}
+
+	// All checksums must be computed in a single pass, no matter how the data is split
+	for _, piece := range []string{"Hello", " ", "World!"} {
+		_, _ = hasher.Write([]byte(piece))
+	}
+	checksums := hasher.Checksums()
+	for algorithm, wants := range checksumsByName {
+		if got := checksums[algorithm]; got != wants {
+			t.Errorf(testintl.FormatTestResult("MultiHasher.Checksums", wants, got, algorithm))
+		}
+		if got := hasher.Checksum(strings.ToUpper(algorithm)); got != wants {
+			t.Errorf(testintl.FormatTestResult("MultiHasher.Checksum", wants, got, algorithm))
+		}
+	}
+
+	hasher.Reset()
+	if got := hasher.Checksum(crypto.AlgorithmMD5); got != "d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf(testintl.FormatTestResult("MultiHasher.Reset", "d41d8cd98f00b204e9800998ecf8427e", got))
+	}
+
+	if _, err := crypto.NewMultiHasher("md5", "rot13"); err == nil {
+		t.Errorf(testintl.FormatTestError("NewMultiHasher", fmt.Errorf("accepted an unsupported algorithm w/o erring"), "md5", "rot13"))
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Pins the PBKDF2 variant (HMAC-SHA256) used for encrypted credential files; test vectors taken from RFC 7914, section 11
+	tests := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		keyLen     int
+		key        string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"passwd", "salt", 1, 16, "55ac046e56e3089fec1691c22544b605"},
+	}
+
+	for _, test := range tests {
+		if key := hex.EncodeToString(pbkdf2.Key([]byte(test.passphrase), []byte(test.salt), test.iterations, test.keyLen, sha256.New)); key != test.key {
+			t.Errorf(testintl.FormatTestResult("pbkdf2.Key", test.key, key, test.passphrase, test.salt, test.iterations, test.keyLen))
+		}
+	}
+}
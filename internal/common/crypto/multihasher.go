@@ -0,0 +1,92 @@
+// Copyright 2018-2020 CERN
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// In applying this license, CERN does not waive the privileges and immunities
+// granted to it by virtue of its status as an Intergovernmental Organization
+// or submit itself to any jurisdiction.
+
+package crypto
+
+import (
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// MultiHasher computes the checksums of several algorithms in a single pass over the data.
+// It is an io.Writer, so it can be used with io.Copy, io.TeeReader or io.MultiWriter.
+type MultiHasher struct {
+	algorithms []string
+	hashes     []hash.Hash
+}
+
+// Write adds the given data to all checksums; it never fails.
+func (hasher *MultiHasher) Write(p []byte) (int, error) {
+	for _, h := range hasher.hashes {
+		_, _ = h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Reset resets all checksums.
+func (hasher *MultiHasher) Reset() {
+	for _, h := range hasher.hashes {
+		h.Reset()
+	}
+}
+
+// Algorithms returns the names of all algorithms computed by the hasher.
+func (hasher *MultiHasher) Algorithms() []string {
+	return append([]string{}, hasher.algorithms...)
+}
+
+// Checksum returns the hex-encoded checksum of the data written so far for the specified algorithm.
+// An empty string is returned if the algorithm isn't computed by the hasher.
+func (hasher *MultiHasher) Checksum(algorithm string) string {
+	for i, name := range hasher.algorithms {
+		if name == strings.ToLower(algorithm) {
+			return fmt.Sprintf("%x", hasher.hashes[i].Sum(nil))
+		}
+	}
+	return ""
+}
+
+// Checksums returns the hex-encoded checksums of the data written so far for all algorithms.
+func (hasher *MultiHasher) Checksums() map[string]string {
+	checksums := make(map[string]string, len(hasher.algorithms))
+	for i, name := range hasher.algorithms {
+		checksums[name] = fmt.Sprintf("%x", hasher.hashes[i].Sum(nil))
+	}
+	return checksums
+}
+
+// NewMultiHasher creates a new multi-hasher for the specified algorithms (see the Algorithm... constants).
+// Duplicate and empty algorithm names are ignored.
+func NewMultiHasher(algorithms ...string) (*MultiHasher, error) {
+	hasher := &MultiHasher{}
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(algorithm)
+		if algorithm == "" || hasher.Checksum(algorithm) != "" {
+			continue
+		}
+
+		h, err := NewHash(algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the multi-hasher: %v", err)
+		}
+		hasher.algorithms = append(hasher.algorithms, algorithm)
+		hasher.hashes = append(hasher.hashes, h)
+	}
+	return hasher, nil
+}
@@ -0,0 +1,82 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/eventials/go-tus"
+)
+
+// StatusChecksumMismatch is the status code used by TUS servers to reject uploads whose data doesn't match the provided checksum.
+const StatusChecksumMismatch = 460
+
+// HTTPError is returned if an HTTP request was performed, but the server responded with an unexpected status code.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error returns the textual representation of the HTTP error.
+func (err *HTTPError) Error() string {
+	return fmt.Sprintf("performing the HTTP request failed: %v", err.Status)
+}
+
+// IsChecksumMismatch checks whether the server rejected the transferred data because of a checksum mismatch.
+func (err *HTTPError) IsChecksumMismatch() bool {
+	return err.StatusCode == StatusChecksumMismatch
+}
+
+// NewHTTPError creates a new HTTP error from the given status code.
+func NewHTTPError(statusCode int) *HTTPError {
+	return &HTTPError{
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+	}
+}
+
+func convertTUSError(err error) error {
+	// TUS reports unexpected status codes through its own error type
+	var clientErr tus.ClientError
+	if errors.As(err, &clientErr) {
+		return NewHTTPError(clientErr.Code)
+	}
+	return err
+}
+
+func convertWebDAVError(err error) error {
+	// WebDAV reports unexpected status codes as path errors containing only the code
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		if code, convErr := strconv.Atoi(pathErr.Err.Error()); convErr == nil {
+			return fmt.Errorf("%v '%v': %w", pathErr.Op, pathErr.Path, NewHTTPError(code))
+		}
+	}
+	return err
+}
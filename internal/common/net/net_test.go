@@ -25,12 +25,18 @@
 package net_test
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common"
 	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
@@ -81,18 +87,18 @@ func TestTUSClient(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.endpoint, func(t *testing.T) {
-			if client, err := net.NewTUSClient(test.endpoint, "", ""); err == nil {
+			if client, err := net.NewTUSClient(test.endpoint, "", "", nil); err == nil {
 				data := strings.NewReader("This is a simple TUS test")
 				dataDesc := common.CreateDataDescriptor("tus-test.txt", data.Size())
 				checksumTypeName := crypto.GetChecksumTypeName(provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5)
 
-				if err := client.Write(data, dataDesc.Name(), &dataDesc, checksumTypeName, ""); err != nil && test.shouldSucceed {
+				if err := client.Write(context.Background(), data, dataDesc.Name(), &dataDesc, checksumTypeName, ""); err != nil && test.shouldSucceed {
 					t.Errorf(testintl.FormatTestError("TUSClient.Write", err, data, dataDesc.Name(), &dataDesc, checksumTypeName, ""))
 				} else if err == nil && !test.shouldSucceed {
 					t.Errorf(testintl.FormatTestError("TUSClient.Write", fmt.Errorf("writing to a non-TUS host succeeded"), data, dataDesc.Name(), &dataDesc, checksumTypeName, ""))
 				}
 			} else {
-				t.Errorf(testintl.FormatTestError("NewTUSClient", err, test.endpoint, "", ""))
+				t.Errorf(testintl.FormatTestError("NewTUSClient", err, test.endpoint, "", "", nil))
 			}
 		})
 	}
@@ -109,16 +115,16 @@ func TestWebDAVClient(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.endpoint, func(t *testing.T) {
-			if client, err := net.NewWebDAVClient(test.endpoint, "testUser", "test12345"); err == nil {
+			if client, err := net.NewWebDAVClient(test.endpoint, "testUser", "test12345", nil); err == nil {
 				const fileName = "webdav-test.txt"
 
 				data := strings.NewReader("This is a simple WebDAV test")
-				if err := client.Write(fileName, data, data.Size()); err == nil && test.shouldSucceed {
-					if _, err := client.Read(fileName); err != nil {
+				if err := client.Write(context.Background(), fileName, data, data.Size()); err == nil && test.shouldSucceed {
+					if _, err := client.Read(context.Background(), fileName); err != nil {
 						t.Errorf(testintl.FormatTestError("WebDAVClient.Read", err))
 					}
 
-					if err := client.Remove(fileName); err != nil {
+					if err := client.Remove(context.Background(), fileName); err != nil {
 						t.Errorf(testintl.FormatTestError("WebDAVClient.Remove", err))
 					}
 				} else if err != nil && test.shouldSucceed {
@@ -127,8 +133,130 @@ func TestWebDAVClient(t *testing.T) {
 					t.Errorf(testintl.FormatTestError("WebDAVClient.Write", fmt.Errorf("writing to a non-WebDAV host succeeded"), fileName, data, data.Size()))
 				}
 			} else {
-				t.Errorf(testintl.FormatTestError("NewWebDavClient", err, test.endpoint, "testUser", "test12345"))
+				t.Errorf(testintl.FormatTestError("NewWebDavClient", err, test.endpoint, "testUser", "test12345", nil))
 			}
 		})
 	}
 }
+
+func TestHeaderTransport(t *testing.T) {
+	tests := []struct {
+		header      string
+		presetValue string
+		wants       string
+	}{
+		{"User-Agent", "", "libreva-test"},
+		{"User-Agent", "custom-agent", "custom-agent"},
+		{"X-Custom", "", "libreva-test"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Get(test.header)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: net.NewHeaderTransport(nil, map[string]string{test.header: "libreva-test"})}
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			if test.presetValue != "" {
+				req.Header.Set(test.header, test.presetValue)
+			}
+
+			if res, err := client.Do(req); err == nil {
+				res.Body.Close()
+				if received != test.wants {
+					t.Errorf(testintl.FormatTestResult("HeaderTransport.RoundTrip", test.wants, received, test.header, test.presetValue))
+				}
+			} else {
+				t.Errorf(testintl.FormatTestError("HeaderTransport.RoundTrip", err, test.header, test.presetValue))
+			}
+		})
+	}
+}
+
+func TestWebDAVClientTracing(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			data, _ := ioutil.ReadAll(r.Body)
+			received = string(data)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := tracerProvider.Tracer("test").Start(context.Background(), "parent")
+
+	if client, err := net.NewWebDAVClient(server.URL, "", "", server.Client()); err == nil {
+		data := strings.NewReader("This is a traced WebDAV test")
+		if err := client.Write(ctx, "traced.txt", data, data.Size()); err != nil {
+			t.Errorf(testintl.FormatTestError("WebDAVClient.Write", err, ctx, "traced.txt", data, data.Size()))
+		}
+		if received != "This is a traced WebDAV test" {
+			t.Errorf(testintl.FormatTestResult("WebDAVClient.Write", "This is a traced WebDAV test", received))
+		}
+	} else {
+		t.Errorf(testintl.FormatTestError("NewWebDAVClient", err, server.URL, "", "", server.Client()))
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "WebDAVClient.Write" || spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf(testintl.FormatTestResult("WebDAVClient.Write", "WebDAVClient.Write span as child of parent", spans))
+	}
+}
+
+func TestTUSClientWriteDeferred(t *testing.T) {
+	const chunkSize = 2 * 1024 * 1024
+
+	tests := []struct {
+		size    int
+		patches int
+	}{
+		{0, 1},
+		{100, 1},
+		{chunkSize, 1},
+		{chunkSize + 100, 2},
+		{2 * chunkSize, 2},
+	}
+
+	for _, test := range tests {
+		var patches, received int
+		var length string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Tus-Resumable", "1.0.0")
+			switch r.Method {
+			case http.MethodOptions:
+				w.Header().Set("Tus-Extension", "creation,creation-defer-length")
+			case http.MethodPost:
+				w.Header().Set("Location", "/upload")
+				w.WriteHeader(http.StatusCreated)
+			case http.MethodPatch:
+				data, _ := ioutil.ReadAll(r.Body)
+				patches++
+				received += len(data)
+				length = r.Header.Get("Upload-Length")
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}))
+
+		client, err := net.NewTUSClient(server.URL, "", "", nil)
+		if err != nil {
+			server.Close()
+			t.Fatalf(testintl.FormatTestError("NewTUSClient", err, server.URL, "", "", nil))
+		}
+
+		// Data that is an exact multiple of the chunk size must not lead to an additional empty chunk
+		data := strings.NewReader(strings.Repeat("x", test.size))
+		if size, err := client.WriteDeferred(context.Background(), data, "/home/deferred.txt"); err != nil {
+			t.Errorf(testintl.FormatTestError("TUSClient.WriteDeferred", err, test.size, "/home/deferred.txt"))
+		} else if size != int64(test.size) || received != test.size || patches != test.patches || length != fmt.Sprint(test.size) {
+			t.Errorf(testintl.FormatTestResult("TUSClient.WriteDeferred", fmt.Sprintf("%v bytes in %v chunks", test.size, test.patches), fmt.Sprintf("%v bytes in %v chunks (length %v)", received, patches, length), test.size, "/home/deferred.txt"))
+		}
+		server.Close()
+	}
+}
@@ -34,11 +34,34 @@ type rpcStatusGetter interface {
 	GetStatus() *rpc.Status
 }
 
+// RPCError is returned if an RPC call succeeded, but its response status reports an error.
+type RPCError struct {
+	Operation string
+	Code      rpc.Code
+	Message   string
+	Trace     string
+}
+
+// Error returns the textual representation of the RPC error.
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("%s: %q (code=%+v, trace=%q)", err.Operation, err.Message, err.Code, err.Trace)
+}
+
+// NewRPCError creates a new RPC error from the given status.
+func NewRPCError(operation string, status *rpc.Status) *RPCError {
+	return &RPCError{
+		Operation: operation,
+		Code:      status.Code,
+		Message:   status.Message,
+		Trace:     status.Trace,
+	}
+}
+
 // CheckRPCInvocation checks if an RPC invocation has succeeded.
 // For this, the error from the original call is first checked; after that, the actual RPC response status is checked.
 func CheckRPCInvocation(operation string, res rpcStatusGetter, callErr error) error {
 	if callErr != nil {
-		return fmt.Errorf("%s: %v", operation, callErr)
+		return fmt.Errorf("%s: %w", operation, callErr)
 	}
 
 	return CheckRPCStatus(operation, res)
@@ -48,7 +71,7 @@ func CheckRPCInvocation(operation string, res rpcStatusGetter, callErr error) er
 func CheckRPCStatus(operation string, res rpcStatusGetter) error {
 	status := res.GetStatus()
 	if status.Code != rpc.Code_CODE_OK {
-		return fmt.Errorf("%s: %q (code=%+v, trace=%q)", operation, status.Message, status.Code, status.Trace)
+		return NewRPCError(operation, status)
 	} else {
 		return nil
 	}
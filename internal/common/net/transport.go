@@ -0,0 +1,103 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package net
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type headerTransport struct {
+	transport http.RoundTripper
+	headers   map[string]string
+}
+
+// RoundTrip adds the configured headers to the request and passes it on to the underlying transport.
+func (transport *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A round tripper must not modify the original request, so work on a copy
+	req = req.Clone(req.Context())
+	for k, v := range transport.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return transport.transport.RoundTrip(req)
+}
+
+// NewHeaderTransport creates a round tripper that adds the given headers to every request (unless already set).
+func NewHeaderTransport(transport http.RoundTripper, headers map[string]string) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &headerTransport{
+		transport: transport,
+		headers:   headers,
+	}
+}
+
+type contextTransport struct {
+	transport http.RoundTripper
+
+	mutex  sync.Mutex
+	ctx    context.Context
+	header http.Header
+}
+
+// RoundTrip performs the request using the context set via use.
+// This is used to pass contexts into requests made by third-party clients which aren't context-aware.
+// The header of the response is kept, as such clients usually don't expose it.
+func (transport *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The mutex is held by the caller of use, so the fields can be accessed safely
+	if transport.ctx != nil {
+		req = req.WithContext(transport.ctx)
+	}
+	res, err := transport.transport.RoundTrip(req)
+	if err == nil {
+		transport.header = res.Header
+	}
+	return res, err
+}
+
+// use sets the context for all requests made until the returned release function is called.
+// As the context can't be passed per request, concurrent operations using the same transport are serialized.
+func (transport *contextTransport) use(ctx context.Context) (release func()) {
+	transport.mutex.Lock()
+	transport.ctx = ctx
+	transport.header = nil
+	return func() {
+		transport.ctx = nil
+		transport.mutex.Unlock()
+	}
+}
+
+func newContextTransport(transport http.RoundTripper) *contextTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &contextTransport{
+		transport: transport,
+	}
+}
@@ -19,32 +19,53 @@
 package net
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/eventials/go-tus"
 	"github.com/eventials/go-tus/memorystore"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common"
 )
 
-// TUSClient is a simple client wrapper for uploading files via TUS.
+// TUSClient is a simple client wrapper for uploading files via TUS. Concurrent operations on the same client are serialized.
 type TUSClient struct {
-	config *tus.Config
-	client *tus.Client
+	config     *tus.Config
+	client     *tus.Client
+	httpClient *http.Client
+	transport  *contextTransport
+
+	upload *tus.Upload
 
 	supportsResourceCreation bool
+	supportsDeferredLength   bool
 }
 
-func (client *TUSClient) initClient(endpoint string, accessToken string, transportToken string) error {
+const tusCreationProbeTimeout = time.Duration(1.5 * float64(time.Second))
+
+func (client *TUSClient) initClient(endpoint string, accessToken string, transportToken string, httpClient *http.Client) error {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	client.httpClient = httpClient
+
 	// Create the TUS configuration
 	client.config = tus.DefaultConfig()
 	client.config.Resume = true
+	client.transport = newContextTransport(httpClient.Transport)
+	client.config.HttpClient = &http.Client{
+		Transport: client.transport,
+		Timeout:   httpClient.Timeout,
+	}
 
 	memStore, err := memorystore.NewMemoryStore()
 	if err != nil {
@@ -67,35 +88,49 @@ func (client *TUSClient) initClient(endpoint string, accessToken string, transpo
 	}
 	client.client = tusClient
 
-	// Check if the TUS server supports resource creation
-	client.supportsResourceCreation = client.checkEndpointCreationOption(endpoint)
+	// Check which extensions the TUS server supports
+	extensions := client.getEndpointExtensions(endpoint)
+	client.supportsResourceCreation = common.FindStringNoCase(extensions, "creation") != -1
+	client.supportsDeferredLength = client.supportsResourceCreation && common.FindStringNoCase(extensions, "creation-defer-length") != -1
 
 	return nil
 }
 
-func (client *TUSClient) checkEndpointCreationOption(endpoint string) bool {
-	// Perform an OPTIONS request to the endpoint; if this succeeds, check if the header "Tus-Extension" contains the "creation" flag
-	httpClient := &http.Client{
-		Timeout: time.Duration(1.5 * float64(time.Second)),
-	}
+func (client *TUSClient) getEndpointExtensions(endpoint string) []string {
+	// Perform an OPTIONS request to the endpoint; if this succeeds, the header "Tus-Extension" contains all supported extensions
+	ctx, cancel := context.WithTimeout(context.Background(), tusCreationProbeTimeout)
+	defer cancel()
 
-	if httpReq, err := http.NewRequest("OPTIONS", endpoint, nil); err == nil {
-		if res, err := httpClient.Do(httpReq); err == nil && res.StatusCode == http.StatusOK {
-			ext := strings.Split(res.Header.Get("Tus-Extension"), ",")
-			return common.FindStringNoCase(ext, "creation") != -1
+	if httpReq, err := http.NewRequestWithContext(ctx, "OPTIONS", endpoint, nil); err == nil {
+		if res, err := client.httpClient.Do(httpReq); err == nil {
+			defer res.Body.Close()
+
+			if res.StatusCode == http.StatusOK {
+				extensions := strings.Split(res.Header.Get("Tus-Extension"), ",")
+				for i := range extensions {
+					extensions[i] = strings.TrimSpace(extensions[i])
+				}
+				return extensions
+			}
 		}
 	}
 
-	return false
+	return []string{}
 }
 
 // Write writes the provided data to the endpoint.
 // The target is used as the filename on the remote site. The file information and checksum are used to create a fingerprint.
-func (client *TUSClient) Write(data io.Reader, target string, fileInfo os.FileInfo, checksumType string, checksum string) error {
+func (client *TUSClient) Write(ctx context.Context, data io.Reader, target string, fileInfo os.FileInfo, checksumType string, checksum string) (err error) {
+	ctx, span := startSpan(ctx, "TUSClient.Write", attribute.String("target", target), attribute.Int64("size", fileInfo.Size()))
+	defer func() { endSpan(span, err) }()
+	defer client.transport.use(ctx)()
+
 	metadata := map[string]string{
 		"filename": path.Base(target),
 		"dir":      path.Dir(target),
-		"checksum": fmt.Sprintf("%s %s", checksumType, checksum),
+	}
+	if checksum != "" {
+		metadata["checksum"] = fmt.Sprintf("%s %s", checksumType, checksum)
 	}
 	fingerprint := fmt.Sprintf("%s-%d-%s-%s", path.Base(target), fileInfo.Size(), fileInfo.ModTime(), checksum)
 
@@ -103,27 +138,161 @@ func (client *TUSClient) Write(data io.Reader, target string, fileInfo os.FileIn
 	client.config.Store.Set(upload.Fingerprint, client.client.Url)
 
 	var uploader *tus.Uploader
+	span.SetAttributes(attribute.Bool("tus.creation", client.supportsResourceCreation))
 	if client.supportsResourceCreation {
 		upldr, err := client.client.CreateUpload(upload)
 		if err != nil {
-			return fmt.Errorf("unable to perform the TUS resource creation for '%v': %v", client.client.Url, err)
+			return fmt.Errorf("unable to perform the TUS resource creation for '%v': %w", client.client.Url, convertTUSError(err))
 		}
 		uploader = upldr
 	} else {
 		uploader = tus.NewUploader(client.client, client.client.Url, upload, 0)
 	}
 
+	// From now on, the upload can be resumed if it gets interrupted
+	client.upload = upload
+
+	if err := uploader.Upload(); err != nil {
+		return fmt.Errorf("unable to perform the TUS upload for '%v': %w", client.client.Url, convertTUSError(err))
+	}
+
+	return nil
+}
+
+// WriteDeferred writes data of unknown size to the endpoint, using the "creation-defer-length" extension.
+// The data is sent in chunks; the total size is announced with the last chunk. Such uploads can't be resumed.
+func (client *TUSClient) WriteDeferred(ctx context.Context, data io.Reader, target string) (size int64, err error) {
+	ctx, span := startSpan(ctx, "TUSClient.WriteDeferred", attribute.String("target", target))
+	defer func() { endSpan(span, err) }()
+
+	if !client.supportsDeferredLength {
+		return 0, fmt.Errorf("the TUS server doesn't support uploads of unknown size")
+	}
+
+	upload := &tus.Upload{Metadata: tus.Metadata{"filename": path.Base(target), "dir": path.Dir(target)}}
+	res, err := client.do(ctx, "POST", client.client.Url, nil, map[string]string{
+		"Content-Length":      "0",
+		"Upload-Defer-Length": "1",
+		"Upload-Metadata":     upload.EncodedMetadata(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to perform the TUS resource creation for '%v': %w", client.client.Url, err)
+	}
+	location, err := res.Location()
+	if err != nil {
+		return 0, fmt.Errorf("invalid TUS resource location received from '%v': %v", client.client.Url, err)
+	}
+
+	// Read one chunk ahead, so that the last chunk can carry the total upload length
+	chunk := make([]byte, client.config.ChunkSize)
+	next := make([]byte, client.config.ChunkSize)
+	n, readErr := io.ReadFull(data, chunk)
+	for {
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return size, fmt.Errorf("unable to read the data: %v", readErr)
+		}
+
+		// A full chunk might be the last one, which is only known after trying to read the next one
+		nextN := 0
+		if readErr == nil {
+			nextN, readErr = io.ReadFull(data, next)
+			if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				return size, fmt.Errorf("unable to read the data: %v", readErr)
+			}
+		}
+		isLast := readErr != nil && nextN == 0
+
+		headers := map[string]string{
+			"Content-Type":   "application/offset+octet-stream",
+			"Content-Length": strconv.Itoa(n),
+			"Upload-Offset":  strconv.FormatInt(size, 10),
+		}
+		size += int64(n)
+		if isLast {
+			headers["Upload-Length"] = strconv.FormatInt(size, 10)
+		}
+
+		if _, err := client.do(ctx, "PATCH", location.String(), bytes.NewReader(chunk[:n]), headers); err != nil {
+			return size, fmt.Errorf("unable to perform the TUS upload for '%v': %w", location, err)
+		}
+		if isLast {
+			return size, nil
+		}
+		chunk, next, n = next, chunk, nextN
+	}
+}
+
+func (client *TUSClient) do(ctx context.Context, method string, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range client.config.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Tus-Resumable", tus.ProtocolVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if length, ok := headers["Content-Length"]; ok {
+		req.ContentLength, _ = strconv.ParseInt(length, 10, 64)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return nil, NewHTTPError(res.StatusCode)
+	}
+	return res, nil
+}
+
+// SupportsDeferredLength checks whether the TUS server supports uploads of unknown size (the "creation-defer-length" extension).
+func (client *TUSClient) SupportsDeferredLength() bool {
+	return client.supportsDeferredLength
+}
+
+// SupportsResourceCreation checks whether the TUS server supports the "creation" extension.
+func (client *TUSClient) SupportsResourceCreation() bool {
+	return client.supportsResourceCreation
+}
+
+// CanResume checks whether an upload has been started that can be resumed.
+func (client *TUSClient) CanResume() bool {
+	return client.upload != nil
+}
+
+// Resume continues a previously started (and interrupted) upload.
+// The server is queried for the current upload offset, so that only the remaining data is sent.
+func (client *TUSClient) Resume(ctx context.Context) (err error) {
+	if client.upload == nil {
+		return fmt.Errorf("no upload has been started yet")
+	}
+
+	ctx, span := startSpan(ctx, "TUSClient.Resume", attribute.Int64("size", client.upload.Size()))
+	defer func() { endSpan(span, err) }()
+	defer client.transport.use(ctx)()
+
+	uploader, err := client.client.ResumeUpload(client.upload)
+	if err != nil {
+		return fmt.Errorf("unable to resume the TUS upload for '%v': %w", client.client.Url, convertTUSError(err))
+	}
+
 	if err := uploader.Upload(); err != nil {
-		return fmt.Errorf("unable to perform the TUS upload for '%v': %v", client.client.Url, err)
+		return fmt.Errorf("unable to perform the TUS upload for '%v': %w", client.client.Url, convertTUSError(err))
 	}
 
 	return nil
 }
 
 // NewTUSClient creates a new TUS client.
-func NewTUSClient(endpoint string, accessToken string, transportToken string) (*TUSClient, error) {
+// All requests are performed using the provided HTTP client; if it is nil, a default client is used.
+func NewTUSClient(endpoint string, accessToken string, transportToken string, httpClient *http.Client) (*TUSClient, error) {
 	client := &TUSClient{}
-	if err := client.initClient(endpoint, accessToken, transportToken); err != nil {
+	if err := client.initClient(endpoint, accessToken, transportToken, httpClient); err != nil {
 		return nil, fmt.Errorf("unable to create the TUS client: %v", err)
 	}
 	return client, nil
@@ -19,13 +19,16 @@
 package net
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"strconv"
 
 	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
 	"github.com/studio-b12/gowebdav"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common"
 )
@@ -35,15 +38,24 @@ const (
 	WebDAVPathName  = "webdav-file-path"
 )
 
-// WebDAVClient is a simple client wrapper for down- and uploading files via WebDAV.
+// WebDAVClient is a simple client wrapper for down- and uploading files via WebDAV. Concurrent operations on the same client are serialized.
 type WebDAVClient struct {
-	client *gowebdav.Client
+	client    *gowebdav.Client
+	transport *contextTransport
 }
 
-func (webdav *WebDAVClient) initClient(endpoint string, userName string, password string, accessToken string) error {
+func (webdav *WebDAVClient) initClient(endpoint string, userName string, password string, accessToken string, httpClient *http.Client) error {
 	// Create the WebDAV client
 	webdav.client = gowebdav.NewClient(endpoint, userName, password)
 
+	if httpClient != nil {
+		webdav.transport = newContextTransport(httpClient.Transport)
+		webdav.client.SetTimeout(httpClient.Timeout)
+	} else {
+		webdav.transport = newContextTransport(nil)
+	}
+	webdav.client.SetTransport(webdav.transport)
+
 	if accessToken != "" {
 		webdav.client.SetHeader(AccessTokenName, accessToken)
 	}
@@ -52,33 +64,58 @@ func (webdav *WebDAVClient) initClient(endpoint string, userName string, passwor
 }
 
 // Read reads all data of the specified remote file.
-func (webdav *WebDAVClient) Read(file string) ([]byte, error) {
-	reader, err := webdav.client.ReadStream(file)
+func (webdav *WebDAVClient) Read(ctx context.Context, file string) (data []byte, err error) {
+	reader, _, err := webdav.ReadStream(ctx, file)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create reader: %v", err)
+		return nil, err
 	}
 	defer reader.Close()
 
-	data, err := ioutil.ReadAll(reader)
+	data, err = ioutil.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read the data: %v", err)
 	}
 	return data, nil
 }
 
+// ReadStream opens a reader for the data of the specified remote file; the caller must close it.
+// The header of the server response is returned as well.
+func (webdav *WebDAVClient) ReadStream(ctx context.Context, file string) (reader io.ReadCloser, header http.Header, err error) {
+	ctx, span := startSpan(ctx, "WebDAVClient.Read", attribute.String("file", file))
+	defer func() { endSpan(span, err) }()
+	defer webdav.transport.use(ctx)()
+
+	reader, err = webdav.client.ReadStream(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create reader: %w", convertWebDAVError(err))
+	}
+	return reader, webdav.transport.header, nil
+}
+
 // Write writes data to the specified remote file.
-func (webdav *WebDAVClient) Write(file string, data io.Reader, size int64) error {
-	webdav.client.SetHeader("Upload-Length", strconv.FormatInt(size, 10))
+func (webdav *WebDAVClient) Write(ctx context.Context, file string, data io.Reader, size int64) (err error) {
+	ctx, span := startSpan(ctx, "WebDAVClient.Write", attribute.String("file", file), attribute.Int64("size", size))
+	defer func() { endSpan(span, err) }()
+	defer webdav.transport.use(ctx)()
+
+	// Data of unknown size is sent using chunked transfer encoding
+	if size >= 0 {
+		webdav.client.SetHeader("Upload-Length", strconv.FormatInt(size, 10))
+	}
 
 	if err := webdav.client.WriteStream(file, data, 0700); err != nil {
-		return fmt.Errorf("unable to write the data: %v", err)
+		return fmt.Errorf("unable to write the data: %w", convertWebDAVError(err))
 	}
 
 	return nil
 }
 
 // Remove deletes the entire file/path.
-func (webdav *WebDAVClient) Remove(path string) error {
+func (webdav *WebDAVClient) Remove(ctx context.Context, path string) (err error) {
+	ctx, span := startSpan(ctx, "WebDAVClient.Remove", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+	defer webdav.transport.use(ctx)()
+
 	if err := webdav.client.Remove(path); err != nil {
 		return fmt.Errorf("error removing '%v' :%v", path, err)
 	}
@@ -86,27 +123,27 @@ func (webdav *WebDAVClient) Remove(path string) error {
 	return nil
 }
 
-func newWebDAVClient(endpoint string, userName string, password string, accessToken string) (*WebDAVClient, error) {
+func newWebDAVClient(endpoint string, userName string, password string, accessToken string, httpClient *http.Client) (*WebDAVClient, error) {
 	client := &WebDAVClient{}
-	if err := client.initClient(endpoint, userName, password, accessToken); err != nil {
+	if err := client.initClient(endpoint, userName, password, accessToken, httpClient); err != nil {
 		return nil, fmt.Errorf("unable to create the WebDAV client: %v", err)
 	}
 	return client, nil
 }
 
 // NewWebDAVClientWithAccessToken creates a new WebDAV client using an access token.
-func NewWebDAVClientWithAccessToken(endpoint string, accessToken string) (*WebDAVClient, error) {
-	return newWebDAVClient(endpoint, "", "", accessToken)
+func NewWebDAVClientWithAccessToken(endpoint string, accessToken string, httpClient *http.Client) (*WebDAVClient, error) {
+	return newWebDAVClient(endpoint, "", "", accessToken, httpClient)
 }
 
 // NewWebDAVClientWithOpaque creates a new WebDAV client using the information stored in the opaque.
-func NewWebDAVClientWithOpaque(endpoint string, opaque *types.Opaque) (*WebDAVClient, map[string]string, error) {
+func NewWebDAVClientWithOpaque(endpoint string, opaque *types.Opaque, httpClient *http.Client) (*WebDAVClient, map[string]string, error) {
 	values, err := common.GetValuesFromOpaque(opaque, []string{WebDAVTokenName, WebDAVPathName}, true)
 	if err != nil {
 		return nil, nil, fmt.Errorf("invalid opaque object: %v", err)
 	}
 
-	client, err := NewWebDAVClientWithAccessToken(endpoint, values[WebDAVTokenName])
+	client, err := NewWebDAVClientWithAccessToken(endpoint, values[WebDAVTokenName], httpClient)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -114,6 +151,6 @@ func NewWebDAVClientWithOpaque(endpoint string, opaque *types.Opaque) (*WebDAVCl
 }
 
 // NewWebDAVClient creates a new WebDAV client with user credentials.
-func NewWebDAVClient(endpoint string, userName string, password string) (*WebDAVClient, error) {
-	return newWebDAVClient(endpoint, userName, password, "")
+func NewWebDAVClient(endpoint string, userName string, password string, httpClient *http.Client) (*WebDAVClient, error) {
+	return newWebDAVClient(endpoint, userName, password, "", httpClient)
 }
@@ -25,6 +25,8 @@
 package common
 
 import (
+	"fmt"
+	"path"
 	"strings"
 )
 
@@ -49,3 +51,20 @@ func FindStringNoCase(a []string, x string) int {
 
 	return -1
 }
+
+// CleanRelativePath cleans a relative, slash-separated path (e.g., the name of an archive entry) and makes sure that it doesn't point outside of its base directory.
+// An empty string is returned if the path refers to the base directory itself.
+func CleanRelativePath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("'%v' is an absolute path", p)
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("'%v' points outside of its base directory", p)
+	} else if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
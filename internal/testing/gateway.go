@@ -0,0 +1,694 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package testing
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	p "path"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	gotesting "testing"
+	"time"
+
+	registry "github.com/cs3org/go-cs3apis/cs3/auth/registry/v1beta1"
+	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+const (
+	// TestGatewayUser is the only user accepted by the test gateway.
+	TestGatewayUser = "test"
+	// TestGatewayPassword is the password of the test gateway user.
+	TestGatewayPassword = "testpass"
+	// TestGatewayGuest is another known user who resources can be shared with.
+	TestGatewayGuest = "guest"
+
+	testGatewayToken = "test-token"
+)
+
+type testNode struct {
+	isDir bool
+	data  []byte
+	mtime time.Time
+	id    string
+	etag  string
+}
+
+// TestGateway is a minimal, in-memory implementation of a Reva gateway and its data server.
+// It allows testing actions without a running Reva instance; all files are stored below /home.
+type TestGateway struct {
+	gateway.UnimplementedGatewayAPIServer
+
+	// UseWebDAV specifies whether the data server is announced as a WebDAV endpoint.
+	UseWebDAV bool
+	// SendDigest specifies whether downloads carry a Digest header with the MD5 checksum of the data.
+	SendDigest bool
+	// TUSExtensions lists the TUS extensions announced by the data server; if empty, TUS isn't supported.
+	TUSExtensions []string
+	// ChecksumTypes lists the checksum types offered for uploads; if empty, MD5 is offered.
+	ChecksumTypes []*storage.ResourceChecksumPriority
+
+	server     *grpc.Server
+	listener   stdnet.Listener
+	dataServer *httptest.Server
+
+	mutex      gosync.Mutex
+	nodes      map[string]*testNode
+	nextID     int
+	tusUploads map[string]*testTUSUpload
+
+	// tokenGeneration is increased whenever the tokens expire; logins counts the successful logins
+	tokenGeneration int
+	logins          int
+	// listings counts the ListContainer calls, uploads the initiated uploads; changes is used to generate unique ETags
+	listings int
+	uploads  int
+	changes  int
+}
+
+type testTUSUpload struct {
+	path   string
+	data   []byte
+	length int64
+}
+
+// Address returns the address of the gRPC gateway.
+func (gw *TestGateway) Address() string {
+	return gw.listener.Addr().String()
+}
+
+// Profile returns a profile describing how to connect to and log into the test gateway.
+func (gw *TestGateway) Profile() *reva.Profile {
+	return &reva.Profile{
+		Name:        "test",
+		Gateway:     gw.Address(),
+		TLS:         reva.TLSSettings{Insecure: true},
+		LoginMethod: reva.DefaultLoginMethod,
+		Credentials: reva.CredentialSettings{Source: reva.CredentialSourceStatic, User: TestGatewayUser, Password: TestGatewayPassword},
+		Home:        reva.DefaultHomePath,
+	}
+}
+
+// CreateSession creates a session that is logged into the test gateway.
+func (gw *TestGateway) CreateSession(opts ...reva.SessionOption) (*reva.Session, error) {
+	return gw.Profile().NewSession(opts...)
+}
+
+// WriteFile stores a file, creating all parent directories.
+func (gw *TestGateway) WriteFile(path string, data []byte, mtime time.Time) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.makeDirs(p.Dir(path))
+	gw.writeFile(path, data, mtime)
+}
+
+// ReadFile returns the contents of a file.
+func (gw *TestGateway) ReadFile(path string) ([]byte, bool) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	if node, ok := gw.nodes[path]; ok && !node.isDir {
+		return node.data, true
+	}
+	return nil, false
+}
+
+// Exists checks whether a file or directory exists.
+func (gw *TestGateway) Exists(path string) bool {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	_, ok := gw.nodes[path]
+	return ok
+}
+
+// Close shuts down the test gateway.
+func (gw *TestGateway) Close() {
+	gw.server.Stop()
+	gw.dataServer.Close()
+}
+
+func (gw *TestGateway) ListAuthProviders(ctx context.Context, req *registry.ListAuthProvidersRequest) (*gateway.ListAuthProvidersResponse, error) {
+	return &gateway.ListAuthProvidersResponse{Status: okStatus(), Types: []string{"basic"}}, nil
+}
+
+func (gw *TestGateway) Authenticate(ctx context.Context, req *gateway.AuthenticateRequest) (*gateway.AuthenticateResponse, error) {
+	if req.Type != "basic" || req.ClientId != TestGatewayUser || req.ClientSecret != TestGatewayPassword {
+		return &gateway.AuthenticateResponse{Status: errorStatus(rpc.Code_CODE_UNAUTHENTICATED, "invalid credentials")}, nil
+	}
+
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.logins++
+	return &gateway.AuthenticateResponse{Status: okStatus(), Token: gw.validToken()}, nil
+}
+
+// ExpireTokens invalidates all tokens handed out so far; subsequent calls using them are rejected as unauthenticated.
+func (gw *TestGateway) ExpireTokens() {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.tokenGeneration++
+}
+
+// Logins returns the number of successful logins.
+func (gw *TestGateway) Logins() int {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	return gw.logins
+}
+
+// Listings returns the number of directory listings performed so far.
+func (gw *TestGateway) Listings() int {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	return gw.listings
+}
+
+// Uploads returns the number of uploads initiated so far.
+func (gw *TestGateway) Uploads() int {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	return gw.uploads
+}
+
+func (gw *TestGateway) validToken() string {
+	if gw.tokenGeneration == 0 {
+		return testGatewayToken
+	}
+	return fmt.Sprintf("%v-%v", testGatewayToken, gw.tokenGeneration)
+}
+
+// isAuthorized checks the access token sent along with a call.
+func (gw *TestGateway) isAuthorized(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(net.AccessTokenName)
+	return len(tokens) > 0 && tokens[len(tokens)-1] == gw.validToken()
+}
+
+func (gw *TestGateway) WhoAmI(ctx context.Context, req *gateway.WhoAmIRequest) (*gateway.WhoAmIResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	if req.Token != gw.validToken() {
+		return &gateway.WhoAmIResponse{Status: errorStatus(rpc.Code_CODE_UNAUTHENTICATED, "invalid token")}, nil
+	}
+	return &gateway.WhoAmIResponse{Status: okStatus(), User: testUser(TestGatewayUser)}, nil
+}
+
+func (gw *TestGateway) GetUserByClaim(ctx context.Context, req *userpb.GetUserByClaimRequest) (*userpb.GetUserByClaimResponse, error) {
+	if req.Claim != "username" || (req.Value != TestGatewayUser && req.Value != TestGatewayGuest) {
+		return &userpb.GetUserByClaimResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "user not found")}, nil
+	}
+	return &userpb.GetUserByClaimResponse{Status: okStatus(), User: testUser(req.Value)}, nil
+}
+
+func (gw *TestGateway) CreateShare(ctx context.Context, req *collaboration.CreateShareRequest) (*collaboration.CreateShareResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.nextID++
+	share := &collaboration.Share{
+		Id:          &collaboration.ShareId{OpaqueId: fmt.Sprint(gw.nextID)},
+		ResourceId:  req.ResourceInfo.GetId(),
+		Permissions: req.Grant.GetPermissions(),
+		Grantee:     req.Grant.GetGrantee(),
+		Owner:       testUser(TestGatewayUser).Id,
+		Creator:     testUser(TestGatewayUser).Id,
+	}
+	return &collaboration.CreateShareResponse{Status: okStatus(), Share: share}, nil
+}
+
+func (gw *TestGateway) CreatePublicShare(ctx context.Context, req *link.CreatePublicShareRequest) (*link.CreatePublicShareResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.nextID++
+	share := &link.PublicShare{
+		Id:                &link.PublicShareId{OpaqueId: fmt.Sprint(gw.nextID)},
+		Token:             fmt.Sprintf("public-%v", gw.nextID),
+		ResourceId:        req.ResourceInfo.GetId(),
+		Permissions:       req.Grant.GetPermissions(),
+		Owner:             testUser(TestGatewayUser).Id,
+		Creator:           testUser(TestGatewayUser).Id,
+		PasswordProtected: req.Grant.GetPassword() != "",
+		Expiration:        req.Grant.GetExpiration(),
+	}
+	return &link.CreatePublicShareResponse{Status: okStatus(), Share: share}, nil
+}
+
+func (gw *TestGateway) Stat(ctx context.Context, req *storage.StatRequest) (*storage.StatResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	if !gw.isAuthorized(ctx) {
+		return &storage.StatResponse{Status: errorStatus(rpc.Code_CODE_UNAUTHENTICATED, "invalid token")}, nil
+	}
+
+	path := req.Ref.GetPath()
+	node, ok := gw.nodes[path]
+	if !ok {
+		return &storage.StatResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "'"+path+"' not found")}, nil
+	}
+	return &storage.StatResponse{Status: okStatus(), Info: node.resourceInfo(path)}, nil
+}
+
+func (gw *TestGateway) ListContainer(ctx context.Context, req *storage.ListContainerRequest) (*storage.ListContainerResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	gw.listings++
+	path := req.Ref.GetPath()
+	if node, ok := gw.nodes[path]; !ok || !node.isDir {
+		return &storage.ListContainerResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "'"+path+"' not found")}, nil
+	}
+
+	infos := make([]*storage.ResourceInfo, 0)
+	for _, child := range gw.children(path) {
+		infos = append(infos, gw.nodes[child].resourceInfo(child))
+	}
+	return &storage.ListContainerResponse{Status: okStatus(), Infos: infos}, nil
+}
+
+func (gw *TestGateway) CreateContainer(ctx context.Context, req *storage.CreateContainerRequest) (*storage.CreateContainerResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	path := req.Ref.GetPath()
+	if _, ok := gw.nodes[path]; ok {
+		return &storage.CreateContainerResponse{Status: errorStatus(rpc.Code_CODE_ALREADY_EXISTS, "'"+path+"' already exists")}, nil
+	}
+	if parent, ok := gw.nodes[p.Dir(path)]; !ok || !parent.isDir {
+		return &storage.CreateContainerResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "parent of '"+path+"' not found")}, nil
+	}
+
+	gw.nodes[path] = gw.newNode(true)
+	gw.propagateChange(path)
+	return &storage.CreateContainerResponse{Status: okStatus()}, nil
+}
+
+func (gw *TestGateway) Delete(ctx context.Context, req *storage.DeleteRequest) (*storage.DeleteResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	path := req.Ref.GetPath()
+	if _, ok := gw.nodes[path]; !ok {
+		return &storage.DeleteResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "'"+path+"' not found")}, nil
+	}
+
+	for existingPath := range gw.nodes {
+		if existingPath == path || strings.HasPrefix(existingPath, path+"/") {
+			delete(gw.nodes, existingPath)
+		}
+	}
+	gw.propagateChange(path)
+	return &storage.DeleteResponse{Status: okStatus()}, nil
+}
+
+func (gw *TestGateway) Move(ctx context.Context, req *storage.MoveRequest) (*storage.MoveResponse, error) {
+	gw.mutex.Lock()
+	defer gw.mutex.Unlock()
+
+	source, target := req.Source.GetPath(), req.Destination.GetPath()
+	if _, ok := gw.nodes[source]; !ok {
+		return &storage.MoveResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "'"+source+"' not found")}, nil
+	}
+	if parent, ok := gw.nodes[p.Dir(target)]; !ok || !parent.isDir {
+		return &storage.MoveResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "parent of '"+target+"' not found")}, nil
+	}
+
+	// Resources keep their IDs when being moved
+	for existingPath, node := range gw.nodes {
+		if existingPath == source || strings.HasPrefix(existingPath, source+"/") {
+			delete(gw.nodes, existingPath)
+			gw.nodes[target+strings.TrimPrefix(existingPath, source)] = node
+		}
+	}
+	gw.propagateChange(source)
+	gw.propagateChange(target)
+	return &storage.MoveResponse{Status: okStatus()}, nil
+}
+
+func (gw *TestGateway) InitiateFileUpload(ctx context.Context, req *storage.InitiateFileUploadRequest) (*gateway.InitiateFileUploadResponse, error) {
+	gw.mutex.Lock()
+	gw.uploads++
+	gw.mutex.Unlock()
+
+	res := &gateway.InitiateFileUploadResponse{
+		Status:             okStatus(),
+		Token:              testGatewayToken,
+		AvailableChecksums: gw.ChecksumTypes,
+	}
+	if len(res.AvailableChecksums) == 0 {
+		res.AvailableChecksums = []*storage.ResourceChecksumPriority{
+			{Type: storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, Priority: 1},
+		}
+	}
+	res.UploadEndpoint, res.Opaque = gw.endpoint(req.Ref.GetPath())
+	return res, nil
+}
+
+func (gw *TestGateway) InitiateFileDownload(ctx context.Context, req *storage.InitiateFileDownloadRequest) (*gateway.InitiateFileDownloadResponse, error) {
+	gw.mutex.Lock()
+	_, ok := gw.nodes[req.Ref.GetPath()]
+	gw.mutex.Unlock()
+	if !ok {
+		return &gateway.InitiateFileDownloadResponse{Status: errorStatus(rpc.Code_CODE_NOT_FOUND, "'"+req.Ref.GetPath()+"' not found")}, nil
+	}
+
+	res := &gateway.InitiateFileDownloadResponse{Status: okStatus(), Token: testGatewayToken}
+	res.DownloadEndpoint, res.Opaque = gw.endpoint(req.Ref.GetPath())
+	return res, nil
+}
+
+func (gw *TestGateway) endpoint(path string) (string, *types.Opaque) {
+	if gw.UseWebDAV {
+		return gw.dataServer.URL + "/webdav", &types.Opaque{
+			Map: map[string]*types.OpaqueEntry{
+				net.WebDAVTokenName: {Decoder: "plain", Value: []byte(testGatewayToken)},
+				net.WebDAVPathName:  {Decoder: "plain", Value: []byte(path)},
+			},
+		}
+	}
+	return gw.dataServer.URL + "/data" + path, nil
+}
+
+func (gw *TestGateway) serveData(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/tus/") || (r.Header.Get("Tus-Resumable") != "" && r.Method == http.MethodPost) || r.Method == http.MethodOptions {
+		gw.serveTUS(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/webdav"), "/data")
+
+	switch r.Method {
+	case "MKCOL":
+		gw.mutex.Lock()
+		gw.makeDirs(path)
+		gw.mutex.Unlock()
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodGet:
+		data, ok := gw.ReadFile(path)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if gw.SendDigest {
+			sum := md5.Sum(data)
+			w.Header().Set("Digest", "md5="+base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		_, _ = w.Write(data)
+
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Plain uploads carry the checksum of the data, which needs to match
+		if xs := r.URL.Query().Get("xs"); xs != "" && r.URL.Query().Get("xs_type") == "md5" {
+			if checksum, _ := crypto.ComputeMD5Checksum(bytes.NewReader(data)); checksum != xs {
+				w.WriteHeader(net.StatusChecksumMismatch)
+				return
+			}
+		}
+
+		gw.mutex.Lock()
+		if parent, ok := gw.nodes[p.Dir(path)]; !ok || !parent.isDir {
+			gw.mutex.Unlock()
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		gw.writeFile(path, data, time.Now())
+		gw.mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (gw *TestGateway) serveTUS(w http.ResponseWriter, r *http.Request) {
+	if len(gw.TUSExtensions) == 0 {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", "1.0.0")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Tus-Version", "1.0.0")
+		w.Header().Set("Tus-Extension", strings.Join(gw.TUSExtensions, ","))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPost:
+		upload := &testTUSUpload{path: strings.TrimPrefix(r.URL.Path, "/data"), length: -1}
+		if length := r.Header.Get("Upload-Length"); length != "" {
+			upload.length, _ = strconv.ParseInt(length, 10, 64)
+		} else if r.Header.Get("Upload-Defer-Length") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		gw.mutex.Lock()
+		gw.nextID++
+		location := fmt.Sprintf("/tus/%v", gw.nextID)
+		gw.tusUploads[location] = upload
+		gw.mutex.Unlock()
+		w.Header().Set("Location", gw.dataServer.URL+location)
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodHead:
+		gw.mutex.Lock()
+		upload, ok := gw.tusUploads[r.URL.Path]
+		gw.mutex.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(upload.data)))
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodPatch:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		gw.mutex.Lock()
+		defer gw.mutex.Unlock()
+
+		upload, ok := gw.tusUploads[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if offset, _ := strconv.Atoi(r.Header.Get("Upload-Offset")); offset != len(upload.data) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if length := r.Header.Get("Upload-Length"); length != "" && upload.length < 0 {
+			upload.length, _ = strconv.ParseInt(length, 10, 64)
+		}
+		upload.data = append(upload.data, data...)
+
+		if upload.length >= 0 && int64(len(upload.data)) >= upload.length {
+			delete(gw.tusUploads, r.URL.Path)
+			if parent, ok := gw.nodes[p.Dir(upload.path)]; !ok || !parent.isDir {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			gw.writeFile(upload.path, upload.data, time.Now())
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(upload.data)))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (gw *TestGateway) makeDirs(path string) {
+	for dir := path; dir != "/" && dir != "."; dir = p.Dir(dir) {
+		if _, ok := gw.nodes[dir]; !ok {
+			gw.nodes[dir] = gw.newNode(true)
+			gw.propagateChange(dir)
+		}
+	}
+}
+
+func (gw *TestGateway) writeFile(path string, data []byte, mtime time.Time) {
+	node, ok := gw.nodes[path]
+	if !ok {
+		node = gw.newNode(false)
+		gw.nodes[path] = node
+	}
+	node.data = data
+	node.mtime = mtime
+	node.etag = fmt.Sprintf("%v-%v", node.id, mtime.UnixNano())
+	gw.propagateChange(path)
+}
+
+// propagateChange updates the ETags of all ancestors of a changed path, just like Reva does.
+func (gw *TestGateway) propagateChange(path string) {
+	for dir := p.Dir(path); dir != "/" && dir != "."; dir = p.Dir(dir) {
+		if node, ok := gw.nodes[dir]; ok {
+			gw.changes++
+			node.etag = fmt.Sprintf("%v-%v-%v", node.id, node.mtime.UnixNano(), gw.changes)
+		}
+	}
+}
+
+func (gw *TestGateway) newNode(isDir bool) *testNode {
+	gw.nextID++
+	node := &testNode{isDir: isDir, mtime: time.Now(), id: fmt.Sprint(gw.nextID)}
+	node.etag = fmt.Sprintf("%v-%v", node.id, node.mtime.UnixNano())
+	return node
+}
+
+func (gw *TestGateway) children(path string) []string {
+	children := make([]string, 0)
+	for existingPath := range gw.nodes {
+		if p.Dir(existingPath) == path && existingPath != path {
+			children = append(children, existingPath)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+func (node *testNode) resourceInfo(path string) *storage.ResourceInfo {
+	info := &storage.ResourceInfo{
+		Type:  storage.ResourceType_RESOURCE_TYPE_FILE,
+		Id:    &storage.ResourceId{StorageId: "test", OpaqueId: node.id},
+		Path:  path,
+		Size:  uint64(len(node.data)),
+		Mtime: &types.Timestamp{Seconds: uint64(node.mtime.Unix()), Nanos: uint32(node.mtime.Nanosecond())},
+		Etag:  node.etag,
+	}
+
+	if node.isDir {
+		info.Type = storage.ResourceType_RESOURCE_TYPE_CONTAINER
+	} else {
+		checksum, _ := crypto.ComputeMD5Checksum(bytes.NewReader(node.data))
+		info.Checksum = &storage.ResourceChecksum{Type: storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, Sum: checksum}
+	}
+	return info
+}
+
+func testUser(name string) *userpb.User {
+	return &userpb.User{
+		Id:          &userpb.UserId{Idp: "test", OpaqueId: name + "-id"},
+		Username:    name,
+		DisplayName: strings.ToUpper(name[:1]) + name[1:],
+		Mail:        name + "@example.org",
+	}
+}
+
+func okStatus() *rpc.Status {
+	return &rpc.Status{Code: rpc.Code_CODE_OK}
+}
+
+func errorStatus(code rpc.Code, msg string) *rpc.Status {
+	return &rpc.Status{Code: code, Message: msg}
+}
+
+// NewTestGateway starts a new test gateway listening on a random local port.
+func NewTestGateway() (*TestGateway, error) {
+	listener, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the test gateway listener: %v", err)
+	}
+
+	gw := &TestGateway{
+		server:   grpc.NewServer(),
+		listener: listener,
+		nodes:    make(map[string]*testNode),
+
+		tusUploads: make(map[string]*testTUSUpload),
+	}
+	gw.dataServer = httptest.NewServer(http.HandlerFunc(gw.serveData))
+	gw.makeDirs("/home")
+
+	gateway.RegisterGatewayAPIServer(gw.server, gw)
+	go func() {
+		_ = gw.server.Serve(listener)
+	}()
+
+	return gw, nil
+}
+
+// StartTestGateway starts a new test gateway for the given test; the gateway is closed automatically once the test has finished.
+func StartTestGateway(t gotesting.TB) *TestGateway {
+	t.Helper()
+
+	gw, err := NewTestGateway()
+	if err != nil {
+		t.Fatalf(FormatTestError("NewTestGateway", err))
+	}
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+// NewTestSession starts a new test gateway for the given test and creates a session logged into it.
+func NewTestSession(t gotesting.TB, opts ...reva.SessionOption) (*TestGateway, *reva.Session) {
+	t.Helper()
+
+	gw := StartTestGateway(t)
+	session, err := gw.CreateSession(opts...)
+	if err != nil {
+		t.Fatalf(FormatTestError("TestGateway.CreateSession", err))
+	}
+	return gw, session
+}
@@ -25,8 +25,15 @@
 package action
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
 )
 
@@ -42,3 +49,29 @@ func (act *action) initAction(session *reva.Session) error {
 
 	return nil
 }
+
+func (act *action) logDebug(msg string, keysAndValues ...interface{}) {
+	act.session.Logger().Log(reva.LogLevelDebug, msg, keysAndValues...)
+}
+
+func (act *action) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return act.session.Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func (act *action) observeTransfer(direction reva.TransferDirection, protocol reva.TransferProtocol, size int64, start time.Time, err error) {
+	metrics := act.session.Metrics()
+	if err != nil {
+		size = 0
+
+		var httpErr *net.HTTPError
+		if (errors.As(err, &httpErr) && httpErr.IsChecksumMismatch()) || errors.Is(err, ErrChecksumMismatch) {
+			metrics.ObserveChecksumMismatch()
+		}
+	}
+	metrics.ObserveTransfer(direction, protocol, size, time.Since(start), err)
+}
+
+func endSpan(span trace.Span, err error) {
+	reva.RecordSpanError(span, err)
+	span.End()
+}
@@ -25,11 +25,28 @@
 package action_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 
 	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
 	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
 )
 
 func TestActions(t *testing.T) {
@@ -82,6 +99,90 @@ func TestActions(t *testing.T) {
 					t.Errorf(testintl.FormatTestError("NewDownloadAction", err, session))
 				}
 
+				// Try uploading an entire directory
+				if act, err := action.NewUploadAction(session); err == nil {
+					if localDir, err := createTestTree(); err == nil {
+						act.Filter.Exclude = []string{"*.tmp"}
+						if results, err := act.UploadDirectory(localDir, "/home/subdir/tree"); err != nil {
+							t.Errorf(testintl.FormatTestError("UploadAction.UploadDirectory", err, localDir, "/home/subdir/tree"))
+						} else if len(results) != 2 {
+							t.Errorf(testintl.FormatTestResult("UploadAction.UploadDirectory", 2, len(results), localDir, "/home/subdir/tree"))
+						}
+						_ = os.RemoveAll(localDir)
+					} else {
+						t.Errorf(testintl.FormatTestError("createTestTree", err))
+					}
+				} else {
+					t.Errorf(testintl.FormatTestError("NewUploadAction", err, session))
+				}
+
+				// Try downloading an entire directory
+				if act, err := action.NewDownloadAction(session); err == nil {
+					if localDir, err := ioutil.TempDir("", "libreva-download"); err == nil {
+						if results, err := act.DownloadDirectory("/home/subdir/tree", localDir); err != nil {
+							t.Errorf(testintl.FormatTestError("DownloadAction.DownloadDirectory", err, "/home/subdir/tree", localDir))
+						} else if len(results) != 2 {
+							t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", 2, len(results), "/home/subdir/tree", localDir))
+						}
+
+						// Downloading the same directory again must skip all files
+						if results, err := act.DownloadDirectory("/home/subdir/tree", localDir); err == nil {
+							for _, result := range results {
+								if !result.Skipped {
+									t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", true, result.Skipped, "/home/subdir/tree", localDir))
+								}
+							}
+						} else {
+							t.Errorf(testintl.FormatTestError("DownloadAction.DownloadDirectory", err, "/home/subdir/tree", localDir))
+						}
+						_ = os.RemoveAll(localDir)
+					} else {
+						t.Errorf(testintl.FormatTestError("ioutil.TempDir", err, "", "libreva-download"))
+					}
+				} else {
+					t.Errorf(testintl.FormatTestError("NewDownloadAction", err, session))
+				}
+
+				// Try downloading an entire directory as an archive
+				if act, err := action.NewDownloadAction(session); err == nil {
+					archive := &bytes.Buffer{}
+					if err := act.DownloadArchive("/home/subdir/tree", archive, action.ArchiveFormatZip); err == nil {
+						if reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len())); err == nil {
+							names := make([]string, 0, len(reader.File))
+							for _, file := range reader.File {
+								names = append(names, file.Name)
+							}
+							sort.Strings(names)
+
+							expected := []string{"tree/", "tree/file.txt", "tree/sub/", "tree/sub/subfile.txt"}
+							if !reflect.DeepEqual(names, expected) {
+								t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadArchive", expected, names, "/home/subdir/tree", archive, action.ArchiveFormatZip))
+							}
+						} else {
+							t.Errorf(testintl.FormatTestError("zip.NewReader", err))
+						}
+					} else {
+						t.Errorf(testintl.FormatTestError("DownloadAction.DownloadArchive", err, "/home/subdir/tree", archive, action.ArchiveFormatZip))
+					}
+				} else {
+					t.Errorf(testintl.FormatTestError("NewDownloadAction", err, session))
+				}
+
+				// Try uploading archives; entries pointing outside of the target directory must be rejected
+				if act, err := action.NewUploadAction(session); err == nil {
+					if results, err := act.UploadArchive(createTestArchive("dir/", "dir/file.txt"), action.ArchiveFormatTarGz, "/home/subdir/extracted"); err != nil {
+						t.Errorf(testintl.FormatTestError("UploadAction.UploadArchive", err, action.ArchiveFormatTarGz, "/home/subdir/extracted"))
+					} else if len(results) != 1 {
+						t.Errorf(testintl.FormatTestResult("UploadAction.UploadArchive", 1, len(results), action.ArchiveFormatTarGz, "/home/subdir/extracted"))
+					}
+
+					if _, err := act.UploadArchive(createTestArchive("../evil.txt"), action.ArchiveFormatTarGz, "/home/subdir/extracted"); err == nil {
+						t.Errorf(testintl.FormatTestError("UploadAction.UploadArchive", fmt.Errorf("path traversal not detected"), action.ArchiveFormatTarGz, "/home/subdir/extracted"))
+					}
+				} else {
+					t.Errorf(testintl.FormatTestError("NewUploadAction", err, session))
+				}
+
 				// Try listing
 				if act, err := action.NewEnumFilesAction(session); err == nil {
 					if _, err := act.ListFiles("/home", true); err != nil {
@@ -118,3 +219,790 @@ func TestActions(t *testing.T) {
 		})
 	}
 }
+
+func TestTransferFilter(t *testing.T) {
+	tests := []struct {
+		filter action.TransferFilter
+		path   string
+		isDir  bool
+		want   bool
+	}{
+		{action.TransferFilter{}, "sub/file.txt", false, true},
+		{action.TransferFilter{Include: []string{"*.txt"}}, "sub/file.txt", false, true},
+		{action.TransferFilter{Include: []string{"*.txt"}}, "sub/file.dat", false, false},
+		{action.TransferFilter{Include: []string{"*.txt"}}, "sub", true, true},
+		{action.TransferFilter{Include: []string{"sub/*"}}, "sub/file.dat", false, true},
+		{action.TransferFilter{Exclude: []string{".git"}}, "sub/.git", true, false},
+		{action.TransferFilter{Include: []string{"*.txt"}, Exclude: []string{"secret.*"}}, "secret.txt", false, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Matches(test.path, test.isDir); got != test.want {
+			t.Errorf(testintl.FormatTestResult("TransferFilter.Matches", test.want, got, test.filter, test.path, test.isDir))
+		}
+	}
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    action.ArchiveFormat
+		shouldErr bool
+	}{
+		{"zip", action.ArchiveFormatZip, false},
+		{".ZIP", action.ArchiveFormatZip, false},
+		{"tar", action.ArchiveFormatTar, false},
+		{"tgz", action.ArchiveFormatTarGz, false},
+		{"tar.gz", action.ArchiveFormatTarGz, false},
+		{"rar", "", true},
+	}
+
+	for _, test := range tests {
+		format, err := action.ParseArchiveFormat(test.name)
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("ParseArchiveFormat", err, test.name))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("ParseArchiveFormat", fmt.Errorf("accepted an invalid format"), test.name))
+		} else if format != test.format {
+			t.Errorf(testintl.FormatTestResult("ParseArchiveFormat", test.format, format, test.name))
+		}
+	}
+}
+
+func createTestTree() (string, error) {
+	dir, err := ioutil.TempDir("", "libreva-tree")
+	if err != nil {
+		return "", err
+	}
+
+	files := map[string]string{
+		"file.txt":        "HELLO WORLD!\n",
+		"sub/subfile.txt": "HELLO SUBWORLD!\n",
+		"sub/ignored.tmp": "IGNORE ME\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func createTestArchive(names ...string) io.Reader {
+	data := &bytes.Buffer{}
+	compressor := gzip.NewWriter(data)
+	archive := tar.NewWriter(compressor)
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			_ = archive.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755})
+		} else {
+			content := []byte("HELLO ARCHIVE!\n")
+			_ = archive.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+			_, _ = archive.Write(content)
+		}
+	}
+	_ = archive.Close()
+	_ = compressor.Close()
+	return data
+}
+
+func TestUploadNonSeekable(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	tests := []struct {
+		webDAV    bool
+		data      string
+		size      int64
+		shouldErr bool
+	}{
+		{false, "HELLO NON-SEEKABLE WORLD!\n", 26, false},
+		{true, "HELLO NON-SEEKABLE WEBDAV!\n", 27, false},
+		{false, "TOO SHORT\n", 100, true},
+		{true, "TOO SHORT\n", 100, true},
+	}
+
+	for _, test := range tests {
+		gw.UseWebDAV = test.webDAV
+		session, err := gw.CreateSession()
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("TestGateway.CreateSession", err))
+		}
+
+		// A multi-reader hides the Seek method of the underlying reader
+		act := action.MustNewUploadAction(session)
+		data := io.MultiReader(strings.NewReader(test.data))
+		_, err = act.Upload(data, test.size, "/home/stream.txt")
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", err, data, test.size, "/home/stream.txt"))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", fmt.Errorf("size mismatch not detected"), data, test.size, "/home/stream.txt"))
+		} else if err == nil {
+			if uploaded, _ := gw.ReadFile("/home/stream.txt"); string(uploaded) != test.data {
+				t.Errorf(testintl.FormatTestResult("UploadAction.Upload", test.data, string(uploaded), data, test.size, "/home/stream.txt"))
+			}
+		}
+	}
+}
+
+func TestUploadUnknownSize(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	tests := []struct {
+		webDAV        bool
+		enableTUS     bool
+		tusExtensions []string
+		seekable      bool
+		data          string
+		shouldErr     bool
+	}{
+		{false, false, nil, false, "HELLO CHUNKED WORLD!\n", false},
+		{true, false, nil, false, "HELLO CHUNKED WEBDAV!\n", false},
+		{false, false, nil, true, "HELLO SEEKABLE WORLD!\n", false},
+		{false, true, []string{"creation", "creation-defer-length"}, false, "HELLO DEFERRED TUS!\n", false},
+		{false, true, []string{"creation", "creation-defer-length"}, true, "HELLO SEEKABLE TUS!\n", false},
+		{false, true, []string{"creation"}, false, "NO DEFERRED LENGTH\n", true},
+	}
+
+	for _, test := range tests {
+		gw.UseWebDAV = test.webDAV
+		gw.TUSExtensions = test.tusExtensions
+		session, err := gw.CreateSession()
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("TestGateway.CreateSession", err))
+		}
+
+		act := action.MustNewUploadAction(session)
+		act.EnableTUS = test.enableTUS
+		var data io.Reader = strings.NewReader(test.data)
+		if !test.seekable {
+			data = io.MultiReader(data)
+		}
+		_, err = act.Upload(data, -1, "/home/unknown.txt")
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", err, data, -1, "/home/unknown.txt"))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", fmt.Errorf("unsupported upload of unknown size not detected"), data, -1, "/home/unknown.txt"))
+		} else if err == nil {
+			if uploaded, _ := gw.ReadFile("/home/unknown.txt"); string(uploaded) != test.data {
+				t.Errorf(testintl.FormatTestResult("UploadAction.Upload", test.data, string(uploaded), data, -1, "/home/unknown.txt"))
+			}
+		}
+	}
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+	gw.WriteFile("/home/verified.txt", []byte("HELLO VERIFIED WORLD!\n"), time.Now())
+
+	const (
+		checksumNone = iota
+		checksumValid
+		checksumWrong
+	)
+
+	tests := []struct {
+		webDAV       bool
+		sendDigest   bool
+		verification action.ChecksumVerification
+		checksum     int
+		shouldErr    bool
+		mismatch     bool
+	}{
+		{false, false, action.ChecksumVerificationBestEffort, checksumValid, false, false},
+		{true, false, action.ChecksumVerificationBestEffort, checksumValid, false, false},
+		{false, false, action.ChecksumVerificationBestEffort, checksumWrong, true, true},
+		{true, false, action.ChecksumVerificationBestEffort, checksumWrong, true, true},
+		{false, false, action.ChecksumVerificationDisabled, checksumWrong, false, false},
+		{false, false, action.ChecksumVerificationBestEffort, checksumNone, false, false},
+		{false, false, action.ChecksumVerificationMandatory, checksumNone, true, false},
+		{false, true, action.ChecksumVerificationMandatory, checksumNone, false, false},
+		{true, true, action.ChecksumVerificationMandatory, checksumNone, false, false},
+	}
+
+	for _, test := range tests {
+		gw.UseWebDAV = test.webDAV
+		gw.SendDigest = test.sendDigest
+		session, err := gw.CreateSession()
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("TestGateway.CreateSession", err))
+		}
+
+		info, err := action.MustNewFileOperationsAction(session).Stat("/home/verified.txt")
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("FileOperationsAction.Stat", err, "/home/verified.txt"))
+		}
+		switch test.checksum {
+		case checksumNone:
+			info.Checksum = nil
+		case checksumWrong:
+			info.Checksum.Sum = "0123456789abcdef0123456789abcdef"
+		}
+
+		act := action.MustNewDownloadAction(session)
+		act.ChecksumVerification = test.verification
+		_, err = act.Download(info)
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("DownloadAction.Download", err, info))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("DownloadAction.Download", fmt.Errorf("unverified download not detected"), info))
+		} else if errors.Is(err, action.ErrChecksumMismatch) != test.mismatch {
+			t.Errorf(testintl.FormatTestResult("DownloadAction.Download", test.mismatch, errors.Is(err, action.ErrChecksumMismatch), info))
+		}
+	}
+}
+
+func TestUploadWithChecksums(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	const data = "HELLO CHECKSUMMED WORLD!\n"
+	tests := []struct {
+		webDAV    bool
+		seekable  bool
+		size      int64
+		checksums map[string]string
+	}{
+		{false, true, int64(len(data)), map[string]string{"md5": "c8eb19ea3d1a18a0b2453692b7b29f98", "sha256": "9ad0e4d91a8a17cba9bea98febde11d512120e63bf3583960747c8b8d12fee0b"}},
+		{false, false, int64(len(data)), map[string]string{"md5": "c8eb19ea3d1a18a0b2453692b7b29f98", "sha256": "9ad0e4d91a8a17cba9bea98febde11d512120e63bf3583960747c8b8d12fee0b"}},
+		{false, false, -1, map[string]string{"sha256": "9ad0e4d91a8a17cba9bea98febde11d512120e63bf3583960747c8b8d12fee0b"}},
+		{true, false, int64(len(data)), map[string]string{"sha256": "9ad0e4d91a8a17cba9bea98febde11d512120e63bf3583960747c8b8d12fee0b"}},
+	}
+
+	for _, test := range tests {
+		gw.UseWebDAV = test.webDAV
+		session, err := gw.CreateSession()
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("TestGateway.CreateSession", err))
+		}
+
+		act := action.MustNewUploadAction(session)
+		act.LocalChecksums = []string{"sha256"}
+		var reader io.Reader = strings.NewReader(data)
+		if !test.seekable {
+			reader = io.MultiReader(reader)
+		}
+		_, checksums, err := act.UploadWithChecksums(reader, test.size, "/home/checksummed.txt")
+		if err != nil {
+			t.Errorf(testintl.FormatTestError("UploadAction.UploadWithChecksums", err, reader, test.size, "/home/checksummed.txt"))
+		} else if !reflect.DeepEqual(checksums, test.checksums) {
+			t.Errorf(testintl.FormatTestResult("UploadAction.UploadWithChecksums", test.checksums, checksums, reader, test.size, "/home/checksummed.txt"))
+		}
+	}
+
+	// Unsupported algorithms must be rejected before uploading anything
+	session, _ := gw.CreateSession()
+	act := action.MustNewUploadAction(session)
+	act.LocalChecksums = []string{"rot13"}
+	if _, err := act.UploadBytes([]byte(data), "/home/rejected.txt"); err == nil || gw.Exists("/home/rejected.txt") {
+		t.Errorf(testintl.FormatTestError("UploadAction.UploadBytes", fmt.Errorf("unsupported checksum algorithm not rejected"), data, "/home/rejected.txt"))
+	}
+}
+
+func TestCopyAndShare(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	const data = "HELLO COPIED WORLD!\n"
+	gw.WriteFile("/home/original.txt", []byte(data), time.Now())
+
+	fileOpsAct := action.MustNewFileOperationsAction(session)
+	if err := fileOpsAct.Copy("/home/original.txt", "/home/copies/copy.txt"); err != nil {
+		t.Errorf(testintl.FormatTestError("FileOperationsAction.Copy", err, "/home/original.txt", "/home/copies/copy.txt"))
+	} else if copied, _ := gw.ReadFile("/home/copies/copy.txt"); string(copied) != data {
+		t.Errorf(testintl.FormatTestResult("FileOperationsAction.Copy", data, string(copied), "/home/original.txt", "/home/copies/copy.txt"))
+	}
+	if err := fileOpsAct.Copy("/home/copies", "/home/copies2"); err == nil {
+		t.Errorf(testintl.FormatTestError("FileOperationsAction.Copy", fmt.Errorf("copying a directory succeeded"), "/home/copies", "/home/copies2"))
+	}
+
+	shareAct := action.MustNewShareAction(session)
+	share, err := shareAct.ShareWithUser("/home/original.txt", testintl.TestGatewayGuest, action.ShareRoleEditor)
+	if err != nil {
+		t.Errorf(testintl.FormatTestError("ShareAction.ShareWithUser", err, "/home/original.txt", testintl.TestGatewayGuest, action.ShareRoleEditor))
+	} else if !share.Permissions.Permissions.InitiateFileUpload {
+		t.Errorf(testintl.FormatTestResult("ShareAction.ShareWithUser", "write permissions", share.Permissions.Permissions, "/home/original.txt", testintl.TestGatewayGuest, action.ShareRoleEditor))
+	}
+	if _, err := shareAct.ShareWithUser("/home/original.txt", "nobody", action.ShareRoleViewer); err == nil {
+		t.Errorf(testintl.FormatTestError("ShareAction.ShareWithUser", fmt.Errorf("sharing with an unknown user succeeded"), "/home/original.txt", "nobody", action.ShareRoleViewer))
+	}
+
+	publicShare, err := shareAct.CreatePublicLink("/home/original.txt", action.ShareRoleViewer, "secret", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Errorf(testintl.FormatTestError("ShareAction.CreatePublicLink", err, "/home/original.txt", action.ShareRoleViewer, "secret"))
+	} else if publicShare.Token == "" || !publicShare.PasswordProtected {
+		t.Errorf(testintl.FormatTestResult("ShareAction.CreatePublicLink", "password-protected share with token", publicShare, "/home/original.txt", action.ShareRoleViewer, "secret"))
+	}
+
+	if _, err := action.ParseShareRole("owner"); err == nil {
+		t.Errorf(testintl.FormatTestError("ParseShareRole", fmt.Errorf("invalid role accepted"), "owner"))
+	}
+}
+
+func TestResultEntries(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	gw.WriteFile("/home/results/file.txt", []byte("HELLO RESULTS!\n"), mtime)
+
+	info, err := action.MustNewFileOperationsAction(session).Stat("/home/results/file.txt")
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("FileOperationsAction.Stat", err, "/home/results/file.txt"))
+	}
+	entry := action.NewFileEntry(info)
+	if entry.Name != "file.txt" || entry.Type != "file" || entry.Size != 15 || entry.Modified != "2021-03-04T05:06:07Z" || entry.ChecksumType != "md5" || entry.Checksum == "" {
+		t.Errorf(testintl.FormatTestResult("NewFileEntry", "file.txt [file, 15b, 2021-03-04T05:06:07Z, md5]", entry, info))
+	}
+
+	infos, _ := action.MustNewEnumFilesAction(session).ListAll("/home", false)
+	if entries := action.NewFileEntries(infos); len(entries) != 1 || !entries[0].IsDir() {
+		t.Errorf(testintl.FormatTestResult("NewFileEntries", "[results directory]", entries, infos))
+	}
+
+	transfer := action.NewTransferEntry(action.TransferResult{RemotePath: "/home/results/file.txt", Err: fmt.Errorf("broken")})
+	if transfer.Status != "failed" || transfer.Error != "broken" || transfer.File != nil {
+		t.Errorf(testintl.FormatTestResult("NewTransferEntry", "failed transfer", transfer))
+	}
+
+	share, _ := action.MustNewShareAction(session).CreatePublicLink("/home/results/file.txt", action.ShareRoleEditor, "", mtime)
+	if shareEntry := action.NewPublicShareEntry(share); !shareEntry.Public || shareEntry.Role != "editor" || shareEntry.Expires != "2021-03-04T05:06:07Z" || shareEntry.PasswordProtected {
+		t.Errorf(testintl.FormatTestResult("NewPublicShareEntry", "public editor link", shareEntry, share))
+	}
+
+	perms := action.ShareRoleViewer.Permissions()
+	if names := action.PermissionNames(perms); !reflect.DeepEqual(names, []string{"read", "list"}) {
+		t.Errorf(testintl.FormatTestResult("PermissionNames", []string{"read", "list"}, names, perms))
+	}
+}
+
+func TestUploadChecksumTypes(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+
+	checksumType := func(xsType storage.ResourceChecksumType, priority uint32) *storage.ResourceChecksumPriority {
+		return &storage.ResourceChecksumPriority{Type: xsType, Priority: priority}
+	}
+	tests := []struct {
+		name          string
+		checksumTypes []*storage.ResourceChecksumPriority
+		shouldErr     bool
+	}{
+		{"invalid", []*storage.ResourceChecksumPriority{checksumType(storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_INVALID, 1)}, true},
+		{"unknown", []*storage.ResourceChecksumPriority{checksumType(storage.ResourceChecksumType(99), 1)}, true},
+		{"fallback", []*storage.ResourceChecksumPriority{checksumType(storage.ResourceChecksumType(99), 1), checksumType(storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, 2)}, false},
+		{"unset", []*storage.ResourceChecksumPriority{checksumType(storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET, 1)}, false},
+	}
+
+	for _, test := range tests {
+		gw.ChecksumTypes = test.checksumTypes
+		session, err := gw.CreateSession()
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("TestGateway.CreateSession", err))
+		}
+
+		// Uploads must never be performed without a checksum the server asked for
+		target := "/home/xs-" + test.name + ".txt"
+		_, err = action.MustNewUploadAction(session).Upload(strings.NewReader("CHECKSUM TYPES\n"), -1, target)
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", err, test.name))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.Upload", fmt.Errorf("an unsupported checksum type was accepted"), test.name))
+		} else if gw.Exists(target) == test.shouldErr {
+			t.Errorf(testintl.FormatTestResult("TestGateway.Exists", !test.shouldErr, test.shouldErr, target))
+		}
+	}
+}
+
+func TestUploadDirectory(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	localDir := t.TempDir()
+	files := map[string]string{
+		"file.txt":          "HELLO WORLD!\n",
+		"sub/subfile.txt":   "HELLO SUBWORLD!\n",
+		"sub/ignored.tmp":   "IGNORE ME\n",
+		"filtered/only.tmp": "IGNORE ME TOO\n",
+		"empty/":            "",
+	}
+	for name, data := range files {
+		path := filepath.Join(localDir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatalf(testintl.FormatTestError("os.MkdirAll", err, path))
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf(testintl.FormatTestError("os.MkdirAll", err, filepath.Dir(path)))
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf(testintl.FormatTestError("ioutil.WriteFile", err, path))
+		}
+	}
+
+	act := action.MustNewUploadAction(session)
+	act.Workers = 2
+	act.Filter.Exclude = []string{"*.tmp"}
+	results, err := act.UploadDirectory(localDir, "/home/tree")
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("UploadAction.UploadDirectory", err, localDir, "/home/tree"))
+	} else if len(results) != 2 {
+		t.Errorf(testintl.FormatTestResult("UploadAction.UploadDirectory", 2, len(results), localDir, "/home/tree"))
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+		data   string
+	}{
+		{"/home/tree/file.txt", true, "HELLO WORLD!\n"},
+		{"/home/tree/sub/subfile.txt", true, "HELLO SUBWORLD!\n"},
+		{"/home/tree/sub/ignored.tmp", false, ""},
+		{"/home/tree/empty", true, ""},
+		{"/home/tree/filtered", false, ""},
+	}
+
+	for _, test := range tests {
+		if exists := gw.Exists(test.path); exists != test.exists {
+			t.Errorf(testintl.FormatTestResult("TestGateway.Exists", test.exists, exists, test.path))
+		} else if data, ok := gw.ReadFile(test.path); ok && string(data) != test.data {
+			t.Errorf(testintl.FormatTestResult("TestGateway.ReadFile", test.data, string(data), test.path))
+		}
+	}
+}
+
+func TestDownloadDirectory(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	gw.WriteFile("/home/tree/file.txt", []byte("HELLO WORLD!\n"), mtime)
+	gw.WriteFile("/home/tree/sub/subfile.txt", []byte("HELLO SUBWORLD!\n"), mtime)
+
+	localDir := t.TempDir()
+	act := action.MustNewDownloadAction(session)
+	act.Workers = 2
+	results, err := act.DownloadDirectory("/home/tree", localDir)
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("DownloadAction.DownloadDirectory", err, "/home/tree", localDir))
+	} else if len(results) != 2 {
+		t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", 2, len(results), "/home/tree", localDir))
+	}
+
+	tests := []struct {
+		path string
+		data string
+	}{
+		{"file.txt", "HELLO WORLD!\n"},
+		{"sub/subfile.txt", "HELLO SUBWORLD!\n"},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(localDir, filepath.FromSlash(test.path))
+		if data, err := ioutil.ReadFile(path); err != nil {
+			t.Errorf(testintl.FormatTestError("ioutil.ReadFile", err, path))
+		} else if string(data) != test.data {
+			t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", test.data, string(data), "/home/tree", localDir))
+		}
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(mtime) {
+			t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", mtime, info.ModTime(), "/home/tree", localDir))
+		}
+	}
+
+	// Downloading the same directory again must skip all files
+	if results, err := act.DownloadDirectory("/home/tree", localDir); err == nil {
+		for _, result := range results {
+			if !result.Skipped {
+				t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadDirectory", true, result.Skipped, "/home/tree", localDir))
+			}
+		}
+	} else {
+		t.Errorf(testintl.FormatTestError("DownloadAction.DownloadDirectory", err, "/home/tree", localDir))
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	gw.WriteFile("/home/tree/file.txt", []byte("HELLO WORLD!\n"), mtime)
+	gw.WriteFile("/home/tree/sub/subfile.txt", []byte("HELLO SUBWORLD!\n"), mtime)
+
+	tests := []struct {
+		format action.ArchiveFormat
+	}{
+		{action.ArchiveFormatZip},
+		{action.ArchiveFormatTarGz},
+	}
+
+	expected := map[string]string{"tree/": "", "tree/file.txt": "HELLO WORLD!\n", "tree/sub/": "", "tree/sub/subfile.txt": "HELLO SUBWORLD!\n"}
+	for _, test := range tests {
+		archive := &bytes.Buffer{}
+		if err := action.MustNewDownloadAction(session).DownloadArchive("/home/tree", archive, test.format); err != nil {
+			t.Errorf(testintl.FormatTestError("DownloadAction.DownloadArchive", err, "/home/tree", archive, test.format))
+			continue
+		}
+
+		entries, err := readTestArchive(archive, test.format, mtime)
+		if err != nil {
+			t.Errorf(testintl.FormatTestError("readTestArchive", err, test.format))
+		} else if !reflect.DeepEqual(entries, expected) {
+			t.Errorf(testintl.FormatTestResult("DownloadAction.DownloadArchive", expected, entries, "/home/tree", archive, test.format))
+		}
+	}
+}
+
+func readTestArchive(archive *bytes.Buffer, format action.ArchiveFormat, mtime time.Time) (map[string]string, error) {
+	entries := make(map[string]string)
+	addEntry := func(name string, modTime time.Time, data io.Reader) error {
+		if !strings.HasSuffix(name, "/") && !modTime.Equal(mtime) {
+			return fmt.Errorf("invalid modification time of '%v': %v", name, modTime)
+		}
+		content, err := ioutil.ReadAll(data)
+		entries[name] = string(content)
+		return err
+	}
+
+	if format == action.ArchiveFormatZip {
+		reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			data, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = addEntry(file.Name, file.Modified, data)
+			_ = data.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	decompressor, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	reader := tar.NewReader(decompressor)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err := addEntry(header.Name, header.ModTime, reader); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestUploadArchive(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	// Zip archives are passed as a regular file as well as a pipe, which doesn't allow random access
+	zipData := &bytes.Buffer{}
+	archive := zip.NewWriter(zipData)
+	_, _ = archive.Create("zipdir/")
+	if w, err := archive.Create("zipdir/file.txt"); err == nil {
+		_, _ = w.Write([]byte("HELLO ARCHIVE!\n"))
+	}
+	_ = archive.Close()
+
+	zipFile := filepath.Join(t.TempDir(), "archive.zip")
+	if err := ioutil.WriteFile(zipFile, zipData.Bytes(), 0644); err != nil {
+		t.Fatalf(testintl.FormatTestError("ioutil.WriteFile", err, zipFile))
+	}
+	openFile := func() io.Reader {
+		file, _ := os.Open(zipFile)
+		t.Cleanup(func() { _ = file.Close() })
+		return file
+	}
+	openPipe := func() io.Reader {
+		reader, writer, _ := os.Pipe()
+		go func() {
+			_, _ = writer.Write(zipData.Bytes())
+			_ = writer.Close()
+		}()
+		t.Cleanup(func() { _ = reader.Close() })
+		return reader
+	}
+
+	tests := []struct {
+		data      func() io.Reader
+		format    action.ArchiveFormat
+		target    string
+		files     int
+		shouldErr bool
+	}{
+		{func() io.Reader { return createTestArchive("dir/", "dir/file.txt") }, action.ArchiveFormatTarGz, "/home/tar", 1, false},
+		{openFile, action.ArchiveFormatZip, "/home/file", 1, false},
+		{openPipe, action.ArchiveFormatZip, "/home/pipe", 1, false},
+		{func() io.Reader { return createTestArchive("good.txt", "../evil.txt") }, action.ArchiveFormatTarGz, "/home/evil", 0, true},
+	}
+
+	for _, test := range tests {
+		results, err := action.MustNewUploadAction(session).UploadArchive(test.data(), test.format, test.target)
+		if err != nil && !test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.UploadArchive", err, test.format, test.target))
+		} else if err == nil && test.shouldErr {
+			t.Errorf(testintl.FormatTestError("UploadAction.UploadArchive", fmt.Errorf("invalid archive entry not detected"), test.format, test.target))
+		} else if len(results) != test.files {
+			t.Errorf(testintl.FormatTestResult("UploadAction.UploadArchive", test.files, len(results), test.format, test.target))
+		}
+
+		// Invalid archives must not lead to any uploads
+		if test.shouldErr && gw.Exists(test.target) {
+			t.Errorf(testintl.FormatTestError("UploadAction.UploadArchive", fmt.Errorf("partial upload of an invalid archive"), test.format, test.target))
+		}
+	}
+
+	for _, path := range []string{"/home/tar/dir/file.txt", "/home/file/zipdir/file.txt", "/home/pipe/zipdir/file.txt"} {
+		if data, ok := gw.ReadFile(path); !ok || string(data) != "HELLO ARCHIVE!\n" {
+			t.Errorf(testintl.FormatTestResult("TestGateway.ReadFile", "HELLO ARCHIVE!\n", string(data), path))
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	gw.WriteFile("/home/watch/x/1.txt", []byte("X"), time.Now())
+	gw.WriteFile("/home/watch/y/2.txt", []byte("Y"), time.Now())
+
+	fileOpsAct := action.MustNewFileOperationsAction(session)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := action.MustNewWatcher(session)
+	watcher.Interval = 10 * time.Millisecond
+	events, err := watcher.Watch(ctx, "/home/watch")
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("Watcher.Watch", err, "/home/watch"))
+	}
+
+	tests := []struct {
+		name     string
+		change   func() error
+		events   []string
+		listings int
+	}{
+		{"create", func() error { gw.WriteFile("/home/watch/a.txt", []byte("A"), time.Now()); return nil }, []string{"created /home/watch/a.txt"}, 1},
+		{"create tree", func() error { gw.WriteFile("/home/watch/sub/deep/b.txt", []byte("B"), time.Now()); return nil }, []string{"created /home/watch/sub", "created /home/watch/sub/deep", "created /home/watch/sub/deep/b.txt"}, 3},
+		{"modify", func() error {
+			gw.WriteFile("/home/watch/x/1.txt", []byte("XX"), time.Now().Add(time.Second))
+			return nil
+		}, []string{"modified /home/watch/x/1.txt"}, 2},
+		{"rename directory", func() error { return fileOpsAct.Move("/home/watch/sub", "/home/watch/moved") }, []string{"renamed /home/watch/sub -> /home/watch/moved"}, 3},
+		{"move file", func() error { return fileOpsAct.Move("/home/watch/moved/deep/b.txt", "/home/watch/b.txt") }, []string{"renamed /home/watch/moved/deep/b.txt -> /home/watch/b.txt"}, 3},
+		{"delete", func() error { return fileOpsAct.Remove("/home/watch/moved") }, []string{"deleted /home/watch/moved/deep", "deleted /home/watch/moved"}, 1},
+		{"rename and modify", func() error {
+			if err := fileOpsAct.Move("/home/watch/x", "/home/watch/z"); err != nil {
+				return err
+			}
+			gw.WriteFile("/home/watch/z/1.txt", []byte("XXX"), time.Now().Add(2*time.Second))
+			return nil
+		}, []string{"renamed /home/watch/x -> /home/watch/z", "modified /home/watch/z/1.txt"}, 2},
+		{"change outside", func() error { gw.WriteFile("/home/other.txt", []byte("-"), time.Now()); return nil }, nil, 0},
+	}
+
+	for _, test := range tests {
+		listings := gw.Listings()
+		if err := test.change(); err != nil {
+			t.Fatalf(testintl.FormatTestError(test.name, err))
+		}
+
+		got := make([]string, 0, len(test.events))
+		timeout := time.After(2 * time.Second)
+		for len(got) < len(test.events) {
+			select {
+			case event := <-events:
+				if event.Type == action.WatchEventRenamed {
+					got = append(got, fmt.Sprintf("%v %v -> %v", event.Type, event.OldPath, event.Path))
+				} else {
+					got = append(got, fmt.Sprintf("%v %v", event.Type, event.Path))
+				}
+			case <-timeout:
+				t.Fatalf(testintl.FormatTestResult(test.name, test.events, got))
+			}
+		}
+		time.Sleep(5 * watcher.Interval) // Make sure that no further events follow
+		select {
+		case event := <-events:
+			got = append(got, fmt.Sprintf("%v %v", event.Type, event.Path))
+		default:
+		}
+
+		if !reflect.DeepEqual(got, test.events) && !(len(got) == 0 && len(test.events) == 0) {
+			t.Errorf(testintl.FormatTestResult(test.name, test.events, got))
+		}
+		// Unchanged directories must not be listed again
+		if n := gw.Listings() - listings; n != test.listings {
+			t.Errorf(testintl.FormatTestResult(test.name+" (listings)", test.listings, n))
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatcherRelogin(t *testing.T) {
+	gw := testintl.StartTestGateway(t)
+	gw.WriteFile("/home/watch/a.txt", []byte("A"), time.Now())
+
+	// Without a credential provider, calls using a stale token aren't repeated automatically
+	session := reva.MustNewSession()
+	if err := session.Initiate(gw.Address(), true); err != nil {
+		t.Fatalf(testintl.FormatTestError("Session.Initiate", err, gw.Address()))
+	}
+	if err := session.Login("basic", testintl.TestGatewayUser, testintl.TestGatewayPassword); err != nil {
+		t.Fatalf(testintl.FormatTestError("Session.Login", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 100)
+	watcher := action.MustNewWatcher(session)
+	watcher.Interval = 10 * time.Millisecond
+	watcher.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	events, err := watcher.Watch(ctx, "/home/watch")
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("Watcher.Watch", err, "/home/watch"))
+	}
+
+	// The watcher must pick up the token of the new login
+	gw.ExpireTokens()
+	if err := session.Login("basic", testintl.TestGatewayUser, testintl.TestGatewayPassword); err != nil {
+		t.Fatalf(testintl.FormatTestError("Session.Login", err))
+	}
+	time.Sleep(5 * watcher.Interval)
+	for len(errs) > 0 {
+		<-errs // Polls between expiring the token and logging in again fail legitimately
+	}
+	gw.WriteFile("/home/watch/b.txt", []byte("B"), time.Now())
+
+	select {
+	case event := <-events:
+		if got := fmt.Sprintf("%v %v", event.Type, event.Path); got != "created /home/watch/b.txt" {
+			t.Errorf(testintl.FormatTestResult("Watcher.Watch", "created /home/watch/b.txt", got))
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf(testintl.FormatTestResult("Watcher.Watch", "created /home/watch/b.txt", "<timeout>"))
+	}
+	select {
+	case err := <-errs:
+		t.Errorf(testintl.FormatTestError("Watcher.Watch", err, "/home/watch"))
+	default:
+	}
+
+	cancel()
+	for range events {
+	}
+}
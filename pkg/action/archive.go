@@ -0,0 +1,305 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// ArchiveFormat specifies the format of an archive.
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatZip is used for zip archives.
+	ArchiveFormatZip ArchiveFormat = "zip"
+	// ArchiveFormatTar is used for uncompressed tar archives.
+	ArchiveFormatTar ArchiveFormat = "tar"
+	// ArchiveFormatTarGz is used for gzip-compressed tar archives.
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+)
+
+// ParseArchiveFormat converts a format name (like "zip" or "tgz") to an archive format.
+func ParseArchiveFormat(name string) (ArchiveFormat, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "zip":
+		return ArchiveFormatZip, nil
+	case "tar":
+		return ArchiveFormatTar, nil
+	case "tar.gz", "tgz":
+		return ArchiveFormatTarGz, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format '%v'", name)
+	}
+}
+
+// archiveWriter abstracts the differences between the various archive formats.
+type archiveWriter interface {
+	// WriteEntry adds a new entry to the archive and returns a writer for its data (nil for directories).
+	WriteEntry(name string, info *storage.ResourceInfo) (io.Writer, error)
+	Close() error
+}
+
+type zipArchiveWriter struct {
+	writer *zip.Writer
+}
+
+func (archive *zipArchiveWriter) WriteEntry(name string, info *storage.ResourceInfo) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: resourceModTime(info),
+	}
+
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		header.Name += "/"
+		header.Method = zip.Store
+		header.SetMode(os.ModeDir | 0755)
+	} else {
+		header.SetMode(0644)
+	}
+
+	return archive.writer.CreateHeader(header)
+}
+
+func (archive *zipArchiveWriter) Close() error {
+	return archive.writer.Close()
+}
+
+type tarArchiveWriter struct {
+	writer     *tar.Writer
+	compressor *gzip.Writer
+}
+
+func (archive *tarArchiveWriter) WriteEntry(name string, info *storage.ResourceInfo) (io.Writer, error) {
+	header := &tar.Header{
+		Name:    name,
+		ModTime: resourceModTime(info),
+		Format:  tar.FormatPAX,
+	}
+
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		header.Name += "/"
+		header.Typeflag = tar.TypeDir
+		header.Mode = 0755
+	} else {
+		header.Typeflag = tar.TypeReg
+		header.Mode = 0644
+		header.Size = int64(info.Size)
+	}
+
+	if err := archive.writer.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return archive.writer, nil
+}
+
+func (archive *tarArchiveWriter) Close() error {
+	if err := archive.writer.Close(); err != nil {
+		return err
+	}
+	if archive.compressor != nil {
+		return archive.compressor.Close()
+	}
+	return nil
+}
+
+// archiveEntry describes a directory or regular file contained in an archive.
+type archiveEntry struct {
+	name  string
+	isDir bool
+	size  int64
+
+	// open returns a reader for the data of a file; the reader is seekable if the data is stored uncompressed
+	open func() (io.ReadCloser, error)
+}
+
+// archiveSection is a seekable reader for the data of an uncompressed archive entry.
+type archiveSection struct {
+	*io.SectionReader
+}
+
+// Close does nothing, as the underlying archive data is owned by the archive index.
+func (section *archiveSection) Close() error {
+	return nil
+}
+
+// archiveIndex lists all entries of an archive, so that they can be checked before any data is processed.
+type archiveIndex struct {
+	entries []archiveEntry
+	tmpFile *os.File
+}
+
+// Close releases all resources used by the index.
+func (index *archiveIndex) Close() error {
+	if index.tmpFile != nil {
+		defer os.Remove(index.tmpFile.Name())
+		return index.tmpFile.Close()
+	}
+	return nil
+}
+
+// data provides random access to the archive data; it is stored in a temporary file first unless it already is a regular file.
+func (index *archiveIndex) data(r io.Reader) (io.ReaderAt, int64, error) {
+	if file, ok := r.(*os.File); ok {
+		if fileInfo, err := file.Stat(); err == nil && fileInfo.Mode().IsRegular() {
+			if offset, err := file.Seek(0, io.SeekCurrent); err == nil {
+				return io.NewSectionReader(file, offset, fileInfo.Size()-offset), fileInfo.Size() - offset, nil
+			}
+		}
+	}
+
+	tmpFile, err := ioutil.TempFile("", "libreva-archive-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to create a temporary file for the archive: %v", err)
+	}
+	index.tmpFile = tmpFile
+
+	size, err := io.Copy(tmpFile, r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to store the archive in a temporary file: %v", err)
+	}
+	return tmpFile, size, nil
+}
+
+func (index *archiveIndex) readTar(r io.Reader) error {
+	data, size, err := index.data(r)
+	if err != nil {
+		return err
+	}
+
+	// The tar reader reads the headers block by block, so the data of an entry starts at the current position of the underlying reader
+	archive := io.NewSectionReader(data, 0, size)
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to read the archive: %v", err)
+		}
+
+		// Links and special files are ignored
+		switch header.Typeflag {
+		case tar.TypeDir:
+			index.entries = append(index.entries, archiveEntry{name: header.Name, isDir: true})
+		case tar.TypeReg, tar.TypeRegA:
+			offset, err := archive.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return fmt.Errorf("unable to read the archive: %v", err)
+			}
+			entryData := io.NewSectionReader(data, offset, header.Size)
+			index.entries = append(index.entries, archiveEntry{name: header.Name, size: header.Size, open: func() (io.ReadCloser, error) {
+				return &archiveSection{SectionReader: entryData}, nil
+			}})
+		}
+	}
+}
+
+func (index *archiveIndex) readZip(r io.Reader) error {
+	// Zip archives can't be read sequentially, so random access to the data is needed
+	data, size, err := index.data(r)
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(data, size)
+	if err != nil {
+		return fmt.Errorf("unable to read the archive: %v", err)
+	}
+
+	for _, entry := range reader.File {
+		mode := entry.Mode()
+		if mode.IsDir() || strings.HasSuffix(entry.Name, "/") {
+			index.entries = append(index.entries, archiveEntry{name: entry.Name, isDir: true})
+		} else if mode.IsRegular() {
+			index.entries = append(index.entries, archiveEntry{name: entry.Name, size: int64(entry.UncompressedSize64), open: entry.Open})
+		}
+	}
+	return nil
+}
+
+// openArchive reads the entries of an archive of the given format; the returned index must be closed by the caller.
+func openArchive(r io.Reader, format ArchiveFormat) (*archiveIndex, error) {
+	index := &archiveIndex{}
+
+	var err error
+	switch format {
+	case ArchiveFormatZip:
+		err = index.readZip(r)
+
+	case ArchiveFormatTar:
+		err = index.readTar(r)
+
+	case ArchiveFormatTarGz:
+		decompressor, gzErr := gzip.NewReader(r)
+		if gzErr != nil {
+			return nil, fmt.Errorf("unable to decompress the archive: %v", gzErr)
+		}
+		defer decompressor.Close()
+		err = index.readTar(decompressor)
+
+	default:
+		return nil, fmt.Errorf("unsupported archive format '%v'", format)
+	}
+
+	if err != nil {
+		_ = index.Close()
+		return nil, err
+	}
+	return index, nil
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveFormatZip:
+		return &zipArchiveWriter{writer: zip.NewWriter(w)}, nil
+
+	case ArchiveFormatTar:
+		return &tarArchiveWriter{writer: tar.NewWriter(w)}, nil
+
+	case ArchiveFormatTarGz:
+		compressor := gzip.NewWriter(w)
+		return &tarArchiveWriter{writer: tar.NewWriter(compressor), compressor: compressor}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported archive format '%v'", format)
+	}
+}
+
+func resourceModTime(info *storage.ResourceInfo) time.Time {
+	if info.Mtime == nil {
+		return time.Now()
+	}
+	return time.Unix(int64(info.Mtime.Seconds), int64(info.Mtime.Nanos))
+}
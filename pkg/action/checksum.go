@@ -0,0 +1,117 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
+)
+
+// ChecksumVerification specifies how the checksums of downloaded files are verified.
+type ChecksumVerification int
+
+const (
+	// ChecksumVerificationBestEffort verifies the checksum of a download if one is available.
+	ChecksumVerificationBestEffort ChecksumVerification = iota
+	// ChecksumVerificationMandatory verifies the checksum of every download; downloads without a known checksum fail.
+	ChecksumVerificationMandatory
+	// ChecksumVerificationDisabled skips the verification of downloads completely.
+	ChecksumVerificationDisabled
+)
+
+// ErrChecksumMismatch is matched (using errors.Is) by all errors reporting that downloaded data doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ChecksumMismatchError is returned if the checksum of downloaded data doesn't match the expected one.
+type ChecksumMismatchError struct {
+	Path         string
+	ChecksumType string
+	Expected     string
+	Actual       string
+}
+
+func (err *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%v of '%v': expected %v checksum %v, got %v", ErrChecksumMismatch, err.Path, err.ChecksumType, err.Expected, err.Actual)
+}
+
+// Is reports whether the target is ErrChecksumMismatch.
+func (err *ChecksumMismatchError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// expectedChecksum determines the checksum a download must match.
+// The checksum of the resource is preferred; if it doesn't have one, the Digest header of the download response is used.
+// ETags are never used, as they aren't guaranteed to be content checksums even if they look like ones.
+func expectedChecksum(info *provider.ResourceInfo, header http.Header) (provider.ResourceChecksumType, string) {
+	if checksum := info.GetChecksum(); checksum.GetSum() != "" && isVerifiableChecksumType(checksum.Type) {
+		return checksum.Type, normalizeChecksum(checksum.Type, checksum.Sum)
+	}
+
+	// A Digest header (RFC 3230) may contain several checksums, like "md5=<base64>, sha=<base64>"
+	for _, digest := range strings.Split(header.Get("Digest"), ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(digest), "=")
+		if !ok {
+			continue
+		}
+
+		switch strings.ToLower(algorithm) {
+		case "md5":
+			if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+				return provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, hex.EncodeToString(sum)
+			}
+		case "sha":
+			if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+				return provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_SHA1, hex.EncodeToString(sum)
+			}
+		case "adler32":
+			return provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32, normalizeChecksum(provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32, value)
+		}
+	}
+
+	return provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET, ""
+}
+
+func normalizeChecksum(checksumType provider.ResourceChecksumType, checksum string) string {
+	checksum = strings.ToLower(checksum)
+
+	// Some storages omit leading zeros of Adler32 checksums
+	if checksumType == provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_ADLER32 && len(checksum) < 8 {
+		checksum = strings.Repeat("0", 8-len(checksum)) + checksum
+	}
+	return checksum
+}
+
+func isVerifiableChecksumType(checksumType provider.ResourceChecksumType) bool {
+	_, err := crypto.NewChecksumHash(checksumType)
+	return err == nil
+}
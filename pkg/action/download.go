@@ -25,12 +25,27 @@
 package action
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	p "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
 	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
 )
@@ -39,56 +54,305 @@ import (
 // WebDAV will be used automatically if the endpoint supports it.
 type DownloadAction struct {
 	action
+
+	// Workers is the number of files downloaded in parallel by DownloadDirectory.
+	Workers int
+	// Filter selects which files and directories are downloaded by DownloadDirectory.
+	Filter TransferFilter
+	// ChecksumVerification specifies how the checksums of downloaded files are verified; a mismatch results in a ChecksumMismatchError.
+	ChecksumVerification ChecksumVerification
 }
 
 // DownloadFile retrieves the data of the provided file path.
 // The method first tries to retrieve information about the remote file by performing a "stat" on it.
-func (action *DownloadAction) DownloadFile(path string) ([]byte, error) {
+func (action *DownloadAction) DownloadFile(path string) (data []byte, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "DownloadAction.DownloadFile", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
 	// Get the ResourceInfo object of the specified path
 	fileInfoAct := MustNewFileOperationsAction(action.session)
-	info, err := fileInfoAct.Stat(path)
+	info, err := fileInfoAct.stat(ctx, path)
 	if err != nil {
-		return nil, fmt.Errorf("the path '%v' was not found: %v", path, err)
+		return nil, fmt.Errorf("the path '%v' was not found: %w", path, err)
 	}
 
-	return action.Download(info)
+	return action.download(ctx, info)
 }
 
 // Download retrieves the data of the provided resource.
 func (action *DownloadAction) Download(fileInfo *storage.ResourceInfo) ([]byte, error) {
-	if fileInfo.Type != storage.ResourceType_RESOURCE_TYPE_FILE {
-		return nil, fmt.Errorf("resource is not a file")
+	return action.download(action.session.Context(), fileInfo)
+}
+
+// DownloadTo writes the data of the provided resource to the given writer without buffering it in memory.
+// If a transfer has to be retried after data has already been written, the writer must either be an *os.File or
+// offer a Reset method (like bytes.Buffer); otherwise, the download fails.
+func (action *DownloadAction) DownloadTo(fileInfo *storage.ResourceInfo, w io.Writer) (int64, error) {
+	return action.downloadTo(action.session.Context(), fileInfo, w)
+}
+
+// DownloadDirectory downloads all files and subdirectories of the remote directory to the local directory.
+// Files are downloaded in parallel, using the number of workers specified by the Workers field; only files and directories passing the
+// Filter are downloaded. Local files whose size and modification time match the remote ones are skipped; the modification times of all
+// downloaded files are set to the remote ones. The result contains an entry for every file; if any download failed, an error is returned as well.
+func (action *DownloadAction) DownloadDirectory(remoteDir string, localDir string) (results []TransferResult, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "DownloadAction.DownloadDirectory", attribute.String("source", remoteDir), attribute.String("target", localDir))
+	defer func() { endSpan(span, err) }()
+
+	entries, err := action.listTree(ctx, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recreate the directory structure first
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create the local directory '%v': %v", localDir, err)
+	}
+
+	dirs := make([]treeEntry, 0)
+	files := make([]TransferResult, 0)
+	for _, entry := range entries {
+		target := filepath.Join(localDir, filepath.FromSlash(entry.path))
+		if !strings.HasPrefix(target, filepath.Clean(localDir)+string(filepath.Separator)) {
+			return nil, fmt.Errorf("the remote path '%v' points outside of the local directory", entry.info.Path)
+		}
+
+		if entry.isDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("unable to create the local directory '%v': %v", target, err)
+			}
+			dirs = append(dirs, entry)
+		} else {
+			files = append(files, TransferResult{LocalPath: target, RemotePath: entry.info.Path, Info: entry.info})
+		}
+	}
+
+	runParallel(action.Workers, len(files), func(i int) {
+		result := &files[i]
+		if localInfo, err := os.Stat(result.LocalPath); err == nil && matchesResource(localInfo, result.Info) {
+			action.logDebug("skipping unchanged file", "source", result.RemotePath, "target", result.LocalPath)
+			result.Skipped = true
+			return
+		}
+
+		action.logDebug("downloading file", "source", result.RemotePath, "target", result.LocalPath)
+		result.Size, result.Err = action.downloadFile(ctx, result.Info, result.LocalPath)
+	})
+
+	// Setting the modification times of directories must be done last, as creating files inside them changes their times
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = setModTime(filepath.Join(localDir, filepath.FromSlash(dirs[i].path)), dirs[i].info)
+	}
+
+	return files, checkTransferResults(files, "download")
+}
+
+// DownloadArchive writes all files and subdirectories of the remote directory as an archive of the given format to the provided writer.
+// The archive is built on the fly while downloading, so no data is stored on the local disk; all entries are placed inside a directory named
+// after the remote directory. Only files and directories passing the Filter are included.
+func (action *DownloadAction) DownloadArchive(remoteDir string, w io.Writer, format ArchiveFormat) (err error) {
+	ctx, span := action.startSpan(action.session.Context(), "DownloadAction.DownloadArchive", attribute.String("source", remoteDir), attribute.String("format", string(format)))
+	defer func() { endSpan(span, err) }()
+
+	archive, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	entries, err := action.listTree(ctx, remoteDir)
+	if err != nil {
+		return err
+	}
+
+	// The root directory itself has no name, so its contents are placed directly into the archive
+	root := p.Base(remoteDir)
+	if root != "/" {
+		rootInfo, err := MustNewFileOperationsAction(action.session).stat(ctx, remoteDir)
+		if err != nil {
+			return fmt.Errorf("unable to stat the remote directory '%v': %w", remoteDir, err)
+		}
+		if _, err := archive.WriteEntry(root, rootInfo); err != nil {
+			return fmt.Errorf("unable to write the archive entry for '%v': %v", remoteDir, err)
+		}
+	} else {
+		root = ""
+	}
+
+	for _, entry := range entries {
+		data, err := archive.WriteEntry(p.Join(root, entry.path), entry.info)
+		if err != nil {
+			return fmt.Errorf("unable to write the archive entry for '%v': %v", entry.info.Path, err)
+		}
+
+		if !entry.isDir() {
+			action.logDebug("adding file to archive", "source", entry.info.Path, "format", format)
+			if _, err := action.downloadTo(ctx, entry.info, data); err != nil {
+				return fmt.Errorf("unable to download '%v': %w", entry.info.Path, err)
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("unable to finish the archive: %v", err)
+	}
+	return nil
+}
+
+// listTree lists all files and directories below the remote directory that pass the filter, parents first.
+// Excluded directories are skipped along with their contents.
+func (action *DownloadAction) listTree(ctx context.Context, remoteDir string) ([]treeEntry, error) {
+	enumFilesAct := MustNewEnumFilesAction(action.session)
+	infos, err := enumFilesAct.listAll(ctx, remoteDir, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the remote directory '%v': %w", remoteDir, err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+
+	entries := make([]treeEntry, 0, len(infos))
+	excludedDirs := make([]string, 0)
+	prefix := strings.TrimSuffix(remoteDir, "/") + "/"
+	for _, info := range infos {
+		if info.Type != storage.ResourceType_RESOURCE_TYPE_FILE && info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			continue
+		}
+
+		rel := strings.TrimPrefix(info.Path, prefix)
+		if rel == info.Path || rel == "" || isExcluded(excludedDirs, rel) {
+			continue
+		}
+
+		entry := treeEntry{path: rel, info: info}
+		if !action.Filter.Matches(rel, entry.isDir()) {
+			if entry.isDir() {
+				excludedDirs = append(excludedDirs, rel+"/")
+			}
+			continue
+		}
+		entries = append(entries, entry)
 	}
+	return entries, nil
+}
 
-	// Issue a file download request to Reva; this will provide the endpoint to read the file data from
-	download, err := action.initiateDownload(fileInfo)
+func (action *DownloadAction) downloadFile(ctx context.Context, fileInfo *storage.ResourceInfo, target string) (int64, error) {
+	// Download to a temporary file first, so that an interrupted download never leaves a partial file behind
+	tmpFile, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".*.download")
 	if err != nil {
+		return 0, fmt.Errorf("unable to create a temporary file for '%v': %v", target, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	size, err := action.downloadTo(ctx, fileInfo, tmpFile)
+	if closeErr := tmpFile.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("unable to write '%v': %v", target, closeErr)
+	}
+	if err != nil {
+		return size, err
+	}
+
+	if err := setModTime(tmpFile.Name(), fileInfo); err != nil {
+		return size, fmt.Errorf("unable to set the modification time of '%v': %v", target, err)
+	}
+	if err := os.Rename(tmpFile.Name(), target); err != nil {
+		return size, fmt.Errorf("unable to replace '%v': %v", target, err)
+	}
+	return size, nil
+}
+
+func (action *DownloadAction) download(ctx context.Context, fileInfo *storage.ResourceInfo) ([]byte, error) {
+	data := &bytes.Buffer{}
+	if _, err := action.downloadTo(ctx, fileInfo, data); err != nil {
 		return nil, err
 	}
+	return data.Bytes(), nil
+}
+
+func (action *DownloadAction) downloadTo(ctx context.Context, fileInfo *storage.ResourceInfo, w io.Writer) (size int64, err error) {
+	ctx, span := action.startSpan(ctx, "DownloadAction.Download", attribute.String("path", fileInfo.Path), attribute.Int64("size", int64(fileInfo.Size)))
+	defer func() { endSpan(span, err) }()
+
+	if fileInfo.Type != storage.ResourceType_RESOURCE_TYPE_FILE {
+		return 0, fmt.Errorf("resource is not a file")
+	}
+
+	// Transient failures are retried, using a fresh download endpoint for each attempt
+	retryPolicy := action.session.RetryPolicy()
+	err = retryPolicy.Retry(ctx, func(attempt int) error {
+		if attempt > 1 && size > 0 {
+			if err := rewindTarget(w); err != nil {
+				return reva.Permanent(fmt.Errorf("unable to retry the download: %v", err))
+			}
+		}
+
+		// Issue a file download request to Reva; this will provide the endpoint to read the file data from
+		download, err := action.initiateDownload(ctx, fileInfo)
+		if err != nil {
+			// Initiating the download is already retried by the session itself
+			return reva.Permanent(err)
+		}
+
+		size, err = action.transfer(ctx, download, fileInfo, w)
+		return err
+	})
+	return size, err
+}
+
+func (action *DownloadAction) transfer(ctx context.Context, download *gateway.InitiateFileDownloadResponse, fileInfo *storage.ResourceInfo, w io.Writer) (int64, error) {
+	protocol := reva.TransferProtocolHTTP
+	var data io.ReadCloser
+	var header http.Header
 
 	// Try to get the file via WebDAV first
-	if client, values, err := net.NewWebDAVClientWithOpaque(download.DownloadEndpoint, download.Opaque); err == nil {
-		data, err := client.Read(values[net.WebDAVPathName])
+	if client, values, err := net.NewWebDAVClientWithOpaque(download.DownloadEndpoint, download.Opaque, action.session.HTTPClient()); err == nil {
+		action.logDebug("downloading via WebDAV", "endpoint", download.DownloadEndpoint)
+		protocol = reva.TransferProtocolWebDAV
+
+		data, header, err = client.ReadStream(ctx, values[net.WebDAVPathName])
 		if err != nil {
-			return nil, fmt.Errorf("error while reading from '%v' via WebDAV: %v", download.DownloadEndpoint, err)
+			return 0, fmt.Errorf("error while reading from '%v' via WebDAV: %w", download.DownloadEndpoint, err)
 		}
-		return data, nil
 	} else {
 		// WebDAV is not supported, so directly read the HTTP endpoint
-		request, err := action.session.NewHTTPRequest(download.DownloadEndpoint, "GET", download.Token, nil)
+		action.logDebug("downloading via HTTP", "endpoint", download.DownloadEndpoint, "reason", err)
+
+		request, err := action.session.NewHTTPRequestWithContext(ctx, download.DownloadEndpoint, "GET", download.Token, nil)
 		if err != nil {
-			return nil, fmt.Errorf("unable to create an HTTP request for '%v': %v", download.DownloadEndpoint, err)
+			return 0, fmt.Errorf("unable to create an HTTP request for '%v': %v", download.DownloadEndpoint, err)
 		}
 
-		data, err := request.Do(true)
+		data, header, err = request.Stream()
 		if err != nil {
-			return nil, fmt.Errorf("error while reading from '%v' via HTTP: %v", download.DownloadEndpoint, err)
+			return 0, fmt.Errorf("error while reading from '%v' via HTTP: %w", download.DownloadEndpoint, err)
 		}
-		return data, nil
 	}
+	defer data.Close()
+
+	// The checksum is computed while receiving the data
+	var checksumHash hash.Hash
+	checksumType, checksum := provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET, ""
+	if action.ChecksumVerification != ChecksumVerificationDisabled {
+		checksumType, checksum = expectedChecksum(fileInfo, header)
+		if checksum != "" {
+			checksumHash, _ = crypto.NewChecksumHash(checksumType)
+			w = io.MultiWriter(w, checksumHash)
+		} else if action.ChecksumVerification == ChecksumVerificationMandatory {
+			return 0, reva.Permanent(fmt.Errorf("no checksum available to verify the download of '%v'", fileInfo.Path))
+		}
+	}
+
+	start := time.Now()
+	size, err := io.Copy(w, data)
+	if err != nil {
+		err = fmt.Errorf("error while reading from '%v' via %v: %w", download.DownloadEndpoint, protocol, err)
+	} else if checksumHash != nil {
+		if actual := hex.EncodeToString(checksumHash.Sum(nil)); actual != checksum {
+			err = &ChecksumMismatchError{Path: fileInfo.Path, ChecksumType: crypto.GetChecksumTypeName(checksumType), Expected: checksum, Actual: actual}
+		}
+	}
+	action.observeTransfer(reva.TransferDirectionDownload, protocol, size, start, err)
+	return size, err
 }
 
-func (action *DownloadAction) initiateDownload(fileInfo *storage.ResourceInfo) (*gateway.InitiateFileDownloadResponse, error) {
+func (action *DownloadAction) initiateDownload(ctx context.Context, fileInfo *storage.ResourceInfo) (*gateway.InitiateFileDownloadResponse, error) {
 	// Initiating a download request gets us the download endpoint for the specified resource
 	req := &provider.InitiateFileDownloadRequest{
 		Ref: &provider.Reference{
@@ -97,16 +361,65 @@ func (action *DownloadAction) initiateDownload(fileInfo *storage.ResourceInfo) (
 			},
 		},
 	}
-	res, err := action.session.Client().InitiateFileDownload(action.session.Context(), req)
+	res, err := action.session.Client().InitiateFileDownload(ctx, req)
 	if err := net.CheckRPCInvocation("initiating download", res, err); err != nil {
 		return nil, err
 	}
 	return res, nil
 }
 
+type treeEntry struct {
+	path string
+	info *storage.ResourceInfo
+}
+
+func (entry *treeEntry) isDir() bool {
+	return entry.info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER
+}
+
+func rewindTarget(w io.Writer) error {
+	switch target := w.(type) {
+	case *os.File:
+		if _, err := target.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return target.Truncate(0)
+
+	case interface{ Reset() }:
+		target.Reset()
+		return nil
+	}
+
+	return fmt.Errorf("the download target can't be rewound")
+}
+
+func matchesResource(localInfo os.FileInfo, info *storage.ResourceInfo) bool {
+	return !localInfo.IsDir() && localInfo.Size() == int64(info.Size) && localInfo.ModTime().Unix() == int64(info.GetMtime().GetSeconds())
+}
+
+func setModTime(path string, info *storage.ResourceInfo) error {
+	if info.Mtime == nil {
+		return nil
+	}
+
+	mtime := time.Unix(int64(info.Mtime.Seconds), int64(info.Mtime.Nanos))
+	return os.Chtimes(path, mtime, mtime)
+}
+
+func isExcluded(excludedDirs []string, path string) bool {
+	for _, dir := range excludedDirs {
+		if strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
 // NewDownloadAction creates a new download action.
 func NewDownloadAction(session *reva.Session) (*DownloadAction, error) {
-	action := &DownloadAction{}
+	action := &DownloadAction{
+		Workers: DefaultWorkers,
+	}
 	if err := action.initAction(session); err != nil {
 		return nil, fmt.Errorf("unable to create the DownloadAction: %v", err)
 	}
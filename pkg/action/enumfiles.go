@@ -25,9 +25,11 @@
 package action
 
 import (
+	"context"
 	"fmt"
 
 	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
@@ -40,11 +42,18 @@ type EnumFilesAction struct {
 
 // ListAll retrieves all files and directories contained in the provided path.
 func (action *EnumFilesAction) ListAll(path string, includeSubdirectories bool) ([]*storage.ResourceInfo, error) {
+	return action.listAll(action.session.Context(), path, includeSubdirectories)
+}
+
+func (action *EnumFilesAction) listAll(ctx context.Context, path string, includeSubdirectories bool) (files []*storage.ResourceInfo, err error) {
+	ctx, span := action.startSpan(ctx, "EnumFilesAction.ListAll", attribute.String("path", path), attribute.Bool("recursive", includeSubdirectories))
+	defer func() { endSpan(span, err) }()
+
 	ref := &storage.Reference{
 		Spec: &storage.Reference_Path{Path: path},
 	}
 	req := &storage.ListContainerRequest{Ref: ref}
-	res, err := action.session.Client().ListContainer(action.session.Context(), req)
+	res, err := action.session.Client().ListContainer(ctx, req)
 	if err := net.CheckRPCInvocation("listing container", res, err); err != nil {
 		return nil, err
 	}
@@ -59,7 +68,7 @@ func (action *EnumFilesAction) ListAll(path string, includeSubdirectories bool)
 		fileList = append(fileList, fi)
 
 		if fi.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER && includeSubdirectories {
-			subFileList, err := action.ListAll(fi.Path, includeSubdirectories)
+			subFileList, err := action.listAll(ctx, fi.Path, includeSubdirectories)
 			if err != nil {
 				return nil, err
 			}
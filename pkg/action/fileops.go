@@ -25,13 +25,17 @@
 package action
 
 import (
+	"context"
 	"fmt"
+	"io"
 	p "path"
 	"strings"
 
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/Daniel-WWU-IT/libreva/internal/common"
 	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
 )
@@ -43,11 +47,18 @@ type FileOperationsAction struct {
 
 // Stat queries the file information of the specified remote resource.
 func (action *FileOperationsAction) Stat(path string) (*storage.ResourceInfo, error) {
+	return action.stat(action.session.Context(), path)
+}
+
+func (action *FileOperationsAction) stat(ctx context.Context, path string) (info *storage.ResourceInfo, err error) {
+	ctx, span := action.startSpan(ctx, "FileOperationsAction.Stat", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
 	ref := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: path},
 	}
 	req := &provider.StatRequest{Ref: ref}
-	res, err := action.session.Client().Stat(action.session.Context(), req)
+	res, err := action.session.Client().Stat(ctx, req)
 	if err := net.CheckRPCInvocation("querying resource information", res, err); err != nil {
 		return nil, err
 	}
@@ -83,34 +94,81 @@ func (action *FileOperationsAction) ResourceExists(path string) bool {
 
 // MakePath creates the entire directory tree specified by the given path.
 func (action *FileOperationsAction) MakePath(path string) error {
+	return action.makePath(action.session.Context(), path)
+}
+
+func (action *FileOperationsAction) makePath(ctx context.Context, path string) (err error) {
+	ctx, span := action.startSpan(ctx, "FileOperationsAction.MakePath", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
 	path = strings.TrimPrefix(path, "/")
 
 	var curPath string
 	for _, token := range strings.Split(path, "/") {
 		curPath = p.Join(curPath, "/"+token)
+		if err := action.makeDir(ctx, curPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-		fileInfo, err := action.Stat(curPath)
-		if err != nil { // Stating failed, so the path probably doesn't exist yet
-			ref := &provider.Reference{
-				Spec: &provider.Reference_Path{Path: curPath},
-			}
-			req := &provider.CreateContainerRequest{Ref: ref}
-			res, err := action.session.Client().CreateContainer(action.session.Context(), req)
-			if err := net.CheckRPCInvocation("creating container", res, err); err != nil {
-				return err
-			}
-		} else { // The path exists, so make sure that is actually a directory
-			if fileInfo.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER {
-				return fmt.Errorf("'%v' is not a directory", curPath)
-			}
+// makeDir creates a single directory whose parent must exist; existing directories are left untouched.
+func (action *FileOperationsAction) makeDir(ctx context.Context, path string) error {
+	fileInfo, err := action.stat(ctx, path)
+	if err != nil { // Stating failed, so the path probably doesn't exist yet
+		ref := &provider.Reference{
+			Spec: &provider.Reference_Path{Path: path},
 		}
+		req := &provider.CreateContainerRequest{Ref: ref}
+		res, err := action.session.Client().CreateContainer(ctx, req)
+		return net.CheckRPCInvocation("creating container", res, err)
+	} else if fileInfo.Type != provider.ResourceType_RESOURCE_TYPE_CONTAINER { // The path exists, so make sure that is actually a directory
+		return fmt.Errorf("'%v' is not a directory", path)
+	}
+	return nil
+}
+
+// dirCreator creates remote directory trees, remembering all directories already created (or found) so that each one is only checked once.
+type dirCreator struct {
+	action  *FileOperationsAction
+	created map[string]bool
+}
+
+func (creator *dirCreator) makePath(ctx context.Context, path string) error {
+	// The root directory always exists
+	path = p.Join("/", path)
+	if path == "/" || creator.created[path] {
+		return nil
 	}
 
+	if err := creator.makePath(ctx, p.Dir(path)); err != nil {
+		return err
+	}
+	if err := creator.action.makeDir(ctx, path); err != nil {
+		return fmt.Errorf("unable to create target directory '%v': %v", path, err)
+	}
+	creator.created[path] = true
 	return nil
 }
 
+func newDirCreator(session *reva.Session) *dirCreator {
+	return &dirCreator{
+		action:  MustNewFileOperationsAction(session),
+		created: make(map[string]bool),
+	}
+}
+
 // Move moves the specified source to a new location. The caller must ensure that the target directory exists.
 func (action *FileOperationsAction) Move(source string, target string) error {
+	return action.move(action.session.Context(), source, target)
+}
+
+func (action *FileOperationsAction) move(ctx context.Context, source string, target string) (err error) {
+	ctx, span := action.startSpan(ctx, "FileOperationsAction.Move", attribute.String("source", source), attribute.String("target", target))
+	defer func() { endSpan(span, err) }()
+
 	sourceRef := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: source},
 	}
@@ -118,7 +176,7 @@ func (action *FileOperationsAction) Move(source string, target string) error {
 		Spec: &provider.Reference_Path{Path: target},
 	}
 	req := &provider.MoveRequest{Source: sourceRef, Destination: targetRef}
-	res, err := action.session.Client().Move(action.session.Context(), req)
+	res, err := action.session.Client().Move(ctx, req)
 	if err := net.CheckRPCInvocation("moving resource", res, err); err != nil {
 		return err
 	}
@@ -127,22 +185,65 @@ func (action *FileOperationsAction) Move(source string, target string) error {
 }
 
 // MoveTo moves the specified source to the target directory, creating it if necessary.
-func (action *FileOperationsAction) MoveTo(source string, path string) error {
-	if err := action.MakePath(path); err != nil {
+func (action *FileOperationsAction) MoveTo(source string, path string) (err error) {
+	ctx, span := action.startSpan(action.session.Context(), "FileOperationsAction.MoveTo", attribute.String("source", source), attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
+	if err := action.makePath(ctx, path); err != nil {
 		return fmt.Errorf("unable to create the target directory '%v': %v", path, err)
 	}
 
 	path = p.Join(path, p.Base(source)) // Keep the original resource base name
-	return action.Move(source, path)
+	return action.move(ctx, source, path)
+}
+
+// Copy copies the specified source file to the target, creating the target directory if necessary.
+// As there is no server-side copy operation, the data is streamed through the client; directories can't be copied.
+func (action *FileOperationsAction) Copy(source string, target string) (err error) {
+	ctx, span := action.startSpan(action.session.Context(), "FileOperationsAction.Copy", attribute.String("source", source), attribute.String("target", target))
+	defer func() { endSpan(span, err) }()
+
+	info, err := action.stat(ctx, source)
+	if err != nil {
+		return fmt.Errorf("the path '%v' was not found: %w", source, err)
+	}
+	if info.Type != provider.ResourceType_RESOURCE_TYPE_FILE {
+		return fmt.Errorf("'%v' is not a file", source)
+	}
+
+	// The download is written into a pipe which the upload reads from
+	reader, writer := io.Pipe()
+	downloadErr := make(chan error, 1)
+	go func() {
+		_, err := MustNewDownloadAction(action.session).downloadTo(ctx, info, writer)
+		_ = writer.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	dataDesc := common.CreateDataDescriptor(p.Base(target), int64(info.Size))
+	_, _, err = MustNewUploadAction(action.session).upload(ctx, reader, &dataDesc, target, true)
+	_ = reader.Close() // Unblocks the download if the upload failed early
+	dlErr := <-downloadErr
+	if err != nil {
+		// A failed download also makes the upload fail, so this error covers both cases
+		return fmt.Errorf("unable to copy '%v' to '%v': %w", source, target, err)
+	}
+	if dlErr != nil {
+		return fmt.Errorf("unable to download '%v': %w", source, dlErr)
+	}
+	return nil
 }
 
 // Remove deletes the specified resource.
-func (action *FileOperationsAction) Remove(path string) error {
+func (action *FileOperationsAction) Remove(path string) (err error) {
+	ctx, span := action.startSpan(action.session.Context(), "FileOperationsAction.Remove", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
 	ref := &provider.Reference{
 		Spec: &provider.Reference_Path{Path: path},
 	}
 	req := &provider.DeleteRequest{Ref: ref}
-	res, err := action.session.Client().Delete(action.session.Context(), req)
+	res, err := action.session.Client().Delete(ctx, req)
 	if err := net.CheckRPCInvocation("deleting resource", res, err); err != nil {
 		return err
 	}
@@ -0,0 +1,271 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"path"
+	"time"
+
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
+)
+
+// The result structs below describe the results of operations in a human-friendly way; they are meant to be printed or encoded as JSON.
+
+// FileEntry describes a single file or directory.
+type FileEntry struct {
+	// Path is the full path of the resource.
+	Path string `json:"path"`
+	// Name is the last element of the path.
+	Name string `json:"name"`
+	// Type is the resource type ("file", "directory", "symlink", "reference" or "unknown").
+	Type string `json:"type"`
+	// Size is the size of the resource in bytes.
+	Size uint64 `json:"size"`
+	// Modified is the modification time of the resource in RFC3339 format; it is empty if unknown.
+	Modified string `json:"modified,omitempty"`
+	// ETag is the entity tag of the resource.
+	ETag string `json:"etag,omitempty"`
+	// ChecksumType is the algorithm of the checksum (e.g., "md5").
+	ChecksumType string `json:"checksumType,omitempty"`
+	// Checksum is the checksum of the resource.
+	Checksum string `json:"checksum,omitempty"`
+	// Permissions lists the permissions the current user has on the resource (see PermissionNames).
+	Permissions []string `json:"permissions,omitempty"`
+	// ID identifies the resource independently of its path.
+	ID string `json:"id,omitempty"`
+	// MimeType is the MIME type of the resource.
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// IsDir returns whether the entry describes a directory.
+func (entry *FileEntry) IsDir() bool {
+	return entry.Type == "directory"
+}
+
+// TransferEntry describes the outcome of a single file transfer.
+type TransferEntry struct {
+	// LocalPath is the path of the local file; it is empty if the data wasn't transferred from or to a local file.
+	LocalPath string `json:"localPath,omitempty"`
+	// RemotePath is the path of the remote file.
+	RemotePath string `json:"remotePath"`
+	// Status is either "done", "skipped" or "failed".
+	Status string `json:"status"`
+	// Size is the number of transferred bytes.
+	Size int64 `json:"size"`
+	// Checksums holds the checksums computed during the transfer, mapped by their algorithm names.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// Error describes why the transfer failed.
+	Error string `json:"error,omitempty"`
+	// File describes the remote file; it is nil if the transfer failed.
+	File *FileEntry `json:"file,omitempty"`
+}
+
+// ShareEntry describes a user share or a public link.
+type ShareEntry struct {
+	// ID identifies the share.
+	ID string `json:"id"`
+	// ResourceID identifies the shared resource.
+	ResourceID string `json:"resourceId,omitempty"`
+	// Public is set for public links.
+	Public bool `json:"public"`
+	// Grantee is the user the resource is shared with; it is empty for public links.
+	Grantee string `json:"grantee,omitempty"`
+	// Token is the token of a public link.
+	Token string `json:"token,omitempty"`
+	// Role is the share role matching the granted permissions ("viewer" or "editor").
+	Role string `json:"role"`
+	// Permissions lists the permissions granted by the share (see PermissionNames).
+	Permissions []string `json:"permissions,omitempty"`
+	// PasswordProtected is set for public links that require a password.
+	PasswordProtected bool `json:"passwordProtected,omitempty"`
+	// Created is the creation time of the share in RFC3339 format; it is empty if unknown.
+	Created string `json:"created,omitempty"`
+	// Expires is the expiration time of a public link in RFC3339 format; it is empty if the link doesn't expire.
+	Expires string `json:"expires,omitempty"`
+}
+
+// NewFileEntry converts a resource information object into a file entry.
+func NewFileEntry(info *provider.ResourceInfo) *FileEntry {
+	entry := &FileEntry{
+		Path:        info.Path,
+		Name:        path.Base(info.Path),
+		Type:        ResourceTypeName(info.Type),
+		Size:        info.Size,
+		Modified:    formatTimestamp(info.Mtime),
+		ETag:        info.Etag,
+		Permissions: PermissionNames(info.PermissionSet),
+		ID:          formatResourceID(info.Id),
+		MimeType:    info.MimeType,
+	}
+	if info.Checksum != nil && info.Checksum.Sum != "" {
+		entry.ChecksumType = crypto.GetChecksumTypeName(info.Checksum.Type)
+		entry.Checksum = info.Checksum.Sum
+	}
+	return entry
+}
+
+// NewFileEntries converts a list of resource information objects into file entries.
+func NewFileEntries(infos []*provider.ResourceInfo) []*FileEntry {
+	entries := make([]*FileEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, NewFileEntry(info))
+	}
+	return entries
+}
+
+// NewTransferEntry converts a transfer result into a transfer entry.
+func NewTransferEntry(result TransferResult) *TransferEntry {
+	entry := &TransferEntry{
+		LocalPath:  result.LocalPath,
+		RemotePath: result.RemotePath,
+		Status:     "done",
+		Size:       result.Size,
+		Checksums:  result.Checksums,
+	}
+	switch {
+	case result.Err != nil:
+		entry.Status = "failed"
+		entry.Error = result.Err.Error()
+	case result.Skipped:
+		entry.Status = "skipped"
+	}
+	if result.Info != nil {
+		entry.File = NewFileEntry(result.Info)
+	}
+	return entry
+}
+
+// NewTransferEntries converts a list of transfer results into transfer entries.
+func NewTransferEntries(results []TransferResult) []*TransferEntry {
+	entries := make([]*TransferEntry, 0, len(results))
+	for _, result := range results {
+		entries = append(entries, NewTransferEntry(result))
+	}
+	return entries
+}
+
+// NewShareEntry converts a user share into a share entry; the grantee is identified by its user ID.
+func NewShareEntry(share *collaboration.Share) *ShareEntry {
+	entry := &ShareEntry{
+		ID:         share.GetId().GetOpaqueId(),
+		ResourceID: formatResourceID(share.ResourceId),
+		Created:    formatTimestamp(share.Ctime),
+	}
+	if id := share.GetGrantee().GetId(); id != nil {
+		entry.Grantee = id.OpaqueId
+	}
+	if perms := share.GetPermissions().GetPermissions(); perms != nil {
+		entry.Role = string(roleOf(perms))
+		entry.Permissions = PermissionNames(perms)
+	}
+	return entry
+}
+
+// NewPublicShareEntry converts a public link into a share entry.
+func NewPublicShareEntry(share *link.PublicShare) *ShareEntry {
+	entry := &ShareEntry{
+		ID:                share.GetId().GetOpaqueId(),
+		ResourceID:        formatResourceID(share.ResourceId),
+		Public:            true,
+		Token:             share.Token,
+		PasswordProtected: share.PasswordProtected,
+		Created:           formatTimestamp(share.Ctime),
+		Expires:           formatTimestamp(share.Expiration),
+	}
+	if perms := share.GetPermissions().GetPermissions(); perms != nil {
+		entry.Role = string(roleOf(perms))
+		entry.Permissions = PermissionNames(perms)
+	}
+	return entry
+}
+
+// ResourceTypeName returns a human-friendly name of a resource type.
+func ResourceTypeName(resType provider.ResourceType) string {
+	switch resType {
+	case provider.ResourceType_RESOURCE_TYPE_FILE:
+		return "file"
+	case provider.ResourceType_RESOURCE_TYPE_CONTAINER:
+		return "directory"
+	case provider.ResourceType_RESOURCE_TYPE_SYMLINK:
+		return "symlink"
+	case provider.ResourceType_RESOURCE_TYPE_REFERENCE:
+		return "reference"
+	default:
+		return "unknown"
+	}
+}
+
+// PermissionNames summarizes a permission set as a list of coarse permission names:
+// "read" (download), "write" (upload), "list", "create" (directories), "delete", "move" and "share".
+func PermissionNames(perms *provider.ResourcePermissions) []string {
+	if perms == nil {
+		return nil
+	}
+
+	names := make([]string, 0, 7)
+	for _, perm := range []struct {
+		name    string
+		granted bool
+	}{
+		{"read", perms.InitiateFileDownload},
+		{"write", perms.InitiateFileUpload},
+		{"list", perms.ListContainer},
+		{"create", perms.CreateContainer},
+		{"delete", perms.Delete},
+		{"move", perms.Move},
+		{"share", perms.AddGrant},
+	} {
+		if perm.granted {
+			names = append(names, perm.name)
+		}
+	}
+	return names
+}
+
+func roleOf(perms *provider.ResourcePermissions) ShareRole {
+	if perms.InitiateFileUpload {
+		return ShareRoleEditor
+	}
+	return ShareRoleViewer
+}
+
+func formatTimestamp(ts *types.Timestamp) string {
+	if ts == nil || (ts.Seconds == 0 && ts.Nanos == 0) {
+		return ""
+	}
+	return time.Unix(int64(ts.Seconds), int64(ts.Nanos)).UTC().Format(time.RFC3339)
+}
+
+func formatResourceID(id *provider.ResourceId) string {
+	if id == nil || id.OpaqueId == "" {
+		return ""
+	}
+	return id.StorageId + ":" + id.OpaqueId
+}
@@ -0,0 +1,168 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"fmt"
+	"time"
+
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	collaboration "github.com/cs3org/go-cs3apis/cs3/sharing/collaboration/v1beta1"
+	link "github.com/cs3org/go-cs3apis/cs3/sharing/link/v1beta1"
+	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// ShareRole specifies which permissions are granted by a share.
+type ShareRole string
+
+const (
+	// ShareRoleViewer allows listing and downloading the shared resource.
+	ShareRoleViewer ShareRole = "viewer"
+	// ShareRoleEditor additionally allows creating, modifying, moving and deleting resources.
+	ShareRoleEditor ShareRole = "editor"
+)
+
+// ParseShareRole converts a role name (like "viewer") into a ShareRole.
+func ParseShareRole(name string) (ShareRole, error) {
+	switch role := ShareRole(name); role {
+	case ShareRoleViewer, ShareRoleEditor:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown share role '%v'", name)
+	}
+}
+
+// Permissions returns the resource permissions granted by the role.
+func (role ShareRole) Permissions() *provider.ResourcePermissions {
+	perms := &provider.ResourcePermissions{
+		GetPath:              true,
+		GetQuota:             true,
+		InitiateFileDownload: true,
+		ListContainer:        true,
+		ListFileVersions:     true,
+		ListGrants:           true,
+		ListRecycle:          true,
+		Stat:                 true,
+	}
+
+	if role == ShareRoleEditor {
+		perms.CreateContainer = true
+		perms.Delete = true
+		perms.InitiateFileUpload = true
+		perms.Move = true
+		perms.RestoreFileVersion = true
+		perms.RestoreRecycleItem = true
+	}
+	return perms
+}
+
+// ShareAction is used to share resources with other users or via public links.
+type ShareAction struct {
+	action
+}
+
+// ShareWithUser shares the specified resource with the user of the given name, granting the permissions of the role.
+func (action *ShareAction) ShareWithUser(path string, username string, role ShareRole) (share *collaboration.Share, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "ShareAction.ShareWithUser", attribute.String("path", path), attribute.String("grantee", username))
+	defer func() { endSpan(span, err) }()
+
+	info, err := MustNewFileOperationsAction(action.session).stat(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("the path '%v' was not found: %w", path, err)
+	}
+
+	// Shares are granted to user IDs, so the user name needs to be resolved first
+	userReq := &userpb.GetUserByClaimRequest{Claim: "username", Value: username}
+	userRes, err := action.session.Client().GetUserByClaim(ctx, userReq)
+	if err := net.CheckRPCInvocation("looking up user", userRes, err); err != nil {
+		return nil, err
+	}
+
+	req := &collaboration.CreateShareRequest{
+		ResourceInfo: info,
+		Grant: &collaboration.ShareGrant{
+			Grantee: &provider.Grantee{
+				Type: provider.GranteeType_GRANTEE_TYPE_USER,
+				Id:   userRes.User.Id,
+			},
+			Permissions: &collaboration.SharePermissions{Permissions: role.Permissions()},
+		},
+	}
+	res, err := action.session.Client().CreateShare(ctx, req)
+	if err := net.CheckRPCInvocation("creating share", res, err); err != nil {
+		return nil, err
+	}
+	return res.Share, nil
+}
+
+// CreatePublicLink creates a public link to the specified resource, granting the permissions of the role.
+// If a password is given, it is required to access the link; a non-zero expiration time limits its validity.
+func (action *ShareAction) CreatePublicLink(path string, role ShareRole, password string, expiration time.Time) (share *link.PublicShare, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "ShareAction.CreatePublicLink", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
+	info, err := MustNewFileOperationsAction(action.session).stat(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("the path '%v' was not found: %w", path, err)
+	}
+
+	grant := &link.Grant{
+		Permissions: &link.PublicSharePermissions{Permissions: role.Permissions()},
+		Password:    password,
+	}
+	if !expiration.IsZero() {
+		grant.Expiration = &types.Timestamp{Seconds: uint64(expiration.Unix()), Nanos: uint32(expiration.Nanosecond())}
+	}
+
+	req := &link.CreatePublicShareRequest{ResourceInfo: info, Grant: grant}
+	res, err := action.session.Client().CreatePublicShare(ctx, req)
+	if err := net.CheckRPCInvocation("creating public link", res, err); err != nil {
+		return nil, err
+	}
+	return res.Share, nil
+}
+
+// NewShareAction creates a new share action.
+func NewShareAction(session *reva.Session) (*ShareAction, error) {
+	action := &ShareAction{}
+	if err := action.initAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the ShareAction: %v", err)
+	}
+	return action, nil
+}
+
+// MustNewShareAction creates a new share action and panics on failure.
+func MustNewShareAction(session *reva.Session) *ShareAction {
+	action, err := NewShareAction(session)
+	if err != nil {
+		panic(err)
+	}
+	return action
+}
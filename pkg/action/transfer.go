@@ -0,0 +1,152 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"fmt"
+	"io"
+	p "path"
+	"sync"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// DefaultWorkers is the default number of files transferred in parallel by directory transfers.
+const DefaultWorkers = 4
+
+// TransferFilter selects which files and directories are transferred by directory transfers.
+// Patterns use the syntax of path.Match and are matched against both the relative path (using forward slashes) and the base name.
+type TransferFilter struct {
+	// Include lists the patterns of files to transfer; if empty, all files are transferred.
+	Include []string
+	// Exclude lists the patterns of files and directories to skip; excluded directories are skipped entirely.
+	Exclude []string
+}
+
+// Matches checks whether the given relative path passes the filter.
+func (filter *TransferFilter) Matches(path string, isDir bool) bool {
+	if matchesAny(filter.Exclude, path) {
+		return false
+	}
+	if isDir || len(filter.Include) == 0 {
+		return true
+	}
+	return matchesAny(filter.Include, path)
+}
+
+// excludesParent checks whether any parent directory of the given relative path is excluded.
+func (filter *TransferFilter) excludesParent(path string) bool {
+	for dir := p.Dir(path); dir != "." && dir != "/"; dir = p.Dir(dir) {
+		if matchesAny(filter.Exclude, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferResult holds the outcome of a single file transfer performed as part of a directory transfer.
+type TransferResult struct {
+	// LocalPath is the path of the local file.
+	LocalPath string
+	// RemotePath is the path of the remote file.
+	RemotePath string
+	// Size is the number of transferred bytes.
+	Size int64
+	// Info describes the remote file; it might be nil if the transfer failed.
+	Info *storage.ResourceInfo
+	// Checksums holds the checksums computed while uploading the file, mapped by their algorithm names.
+	Checksums map[string]string
+	// Skipped is set if the file didn't need to be transferred.
+	Skipped bool
+	// Err is set if the transfer failed.
+	Err error
+}
+
+// countingReader counts the number of bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (reader *countingReader) Read(data []byte) (int, error) {
+	n, err := reader.reader.Read(data)
+	reader.count += int64(n)
+	return n, err
+}
+
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := p.Match(pattern, path); matched {
+			return true
+		}
+		if matched, _ := p.Match(pattern, p.Base(path)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// runParallel calls the given function for all indices in [0, count), running at most the given number of calls at once.
+func runParallel(workers int, count int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+func checkTransferResults(results []TransferResult, operation string) error {
+	failed := 0
+	var firstErr error
+	for _, result := range results {
+		if result.Err != nil {
+			if firstErr == nil {
+				firstErr = result.Err
+			}
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v files failed to %v: %w", failed, len(results), operation, firstErr)
+	}
+	return nil
+}
@@ -20,17 +20,23 @@ package action
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	p "path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
 	provider "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
 	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common"
 	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
@@ -44,6 +50,15 @@ type UploadAction struct {
 	action
 
 	EnableTUS bool
+
+	// Workers is the number of files uploaded in parallel by UploadDirectory.
+	Workers int
+	// Filter selects which files and directories are uploaded by UploadDirectory.
+	Filter TransferFilter
+	// LocalChecksums lists checksum algorithms (like "sha256" or "xxhash") that are computed locally while uploading, in addition to the checksum
+	// required by the server. Supported algorithms are adler32, md5, sha1, sha256, sha512, crc32c and xxhash. The results are reported by
+	// UploadWithChecksums and in the Checksums field of transfer results.
+	LocalChecksums []string
 }
 
 // UploadFile uploads the provided file to the target.
@@ -53,7 +68,8 @@ func (action *UploadAction) UploadFile(file *os.File, target string) (*storage.R
 		return nil, fmt.Errorf("unable to stat the specified file: %v", err)
 	}
 
-	return action.upload(file, fileInfo, target)
+	info, _, err := action.upload(action.session.Context(), file, fileInfo, target, true)
+	return info, err
 }
 
 // UploadFileTo uploads the provided file to the target directory, keeping the original file name.
@@ -67,60 +83,367 @@ func (action *UploadAction) UploadBytes(data []byte, target string) (*storage.Re
 }
 
 // Upload uploads data from the provided reader to the target.
+// If the size of the data isn't known in advance, -1 can be passed as the size; the data is then streamed using chunked transfer encoding
+// or, if TUS is enabled, using TUS's "creation-defer-length" extension. If neither is possible, an error is returned.
 func (action *UploadAction) Upload(data io.Reader, size int64, target string) (*storage.ResourceInfo, error) {
+	info, _, err := action.UploadWithChecksums(data, size, target)
+	return info, err
+}
+
+// UploadWithChecksums works like Upload, but also returns the checksums computed while uploading, mapped by their algorithm names.
+// These include all checksums listed in the LocalChecksums field as well as the one sent to the server (if any).
+func (action *UploadAction) UploadWithChecksums(data io.Reader, size int64, target string) (*storage.ResourceInfo, map[string]string, error) {
 	dataDesc := common.CreateDataDescriptor(p.Base(target), size)
-	return action.upload(data, &dataDesc, target)
+	return action.upload(action.session.Context(), data, &dataDesc, target, true)
 }
 
-func (action *UploadAction) upload(data io.Reader, dataInfo os.FileInfo, target string) (*storage.ResourceInfo, error) {
-	fileOpsAct := MustNewFileOperationsAction(action.session)
+// UploadDirectory uploads all files and subdirectories of the local directory to the remote directory.
+// Files are uploaded in parallel, using the number of workers specified by the Workers field; only files and directories passing the
+// Filter are uploaded. The result contains an entry for every file; if any upload failed, an error is returned as well.
+func (action *UploadAction) UploadDirectory(localDir string, remoteDir string) (results []TransferResult, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "UploadAction.UploadDirectory", attribute.String("source", localDir), attribute.String("target", remoteDir))
+	defer func() { endSpan(span, err) }()
+
+	// Collect all directories and files first; directories with filtered-out contents are only created if any file is uploaded into them
+	dirs := []string{remoteDir}
+	filteredDirs := make(map[string]bool)
+	files := make([]TransferResult, 0)
+	err = filepath.Walk(localDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(localDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if !action.Filter.Matches(rel, info.IsDir()) {
+			filteredDirs[p.Join(remoteDir, p.Dir(rel))] = true
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
-	dir := p.Dir(target)
-	if err := fileOpsAct.MakePath(dir); err != nil {
-		return nil, fmt.Errorf("unable to create target directory '%v': %v", dir, err)
+		if info.IsDir() {
+			dirs = append(dirs, p.Join(remoteDir, rel))
+		} else if info.Mode().IsRegular() {
+			files = append(files, TransferResult{LocalPath: path, RemotePath: p.Join(remoteDir, rel), Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk the local directory '%v': %v", localDir, err)
 	}
 
-	// Issue a file upload request to Reva; this will provide the endpoint to write the file data to
-	upload, err := action.initiateUpload(target, dataInfo.Size())
+	creator := newDirCreator(action.session)
+	for _, dir := range dirs {
+		if dir == remoteDir || !filteredDirs[dir] {
+			if err := creator.makePath(ctx, dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, file := range files {
+		if err := creator.makePath(ctx, p.Dir(file.RemotePath)); err != nil {
+			return nil, err
+		}
+	}
+
+	runParallel(action.Workers, len(files), func(i int) {
+		result := &files[i]
+		action.logDebug("uploading file", "source", result.LocalPath, "target", result.RemotePath)
+
+		file, err := os.Open(result.LocalPath)
+		if err != nil {
+			result.Err = fmt.Errorf("unable to open '%v': %v", result.LocalPath, err)
+			return
+		}
+		defer file.Close()
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			result.Err = fmt.Errorf("unable to stat '%v': %v", result.LocalPath, err)
+			return
+		}
+
+		result.Size = fileInfo.Size()
+		result.Info, result.Checksums, result.Err = action.upload(ctx, file, fileInfo, result.RemotePath, false)
+	})
+
+	return files, checkTransferResults(files, "upload")
+}
+
+// UploadArchive extracts an archive of the given format read from the provided reader into the remote directory.
+// All directories and regular files contained in the archive are created; links and special files are ignored. Only files and
+// directories passing the Filter are uploaded. Entries pointing outside of the remote directory make the entire upload fail.
+// The result contains an entry for every file, using its name inside the archive as the local path.
+func (action *UploadAction) UploadArchive(r io.Reader, format ArchiveFormat, remoteDir string) (results []TransferResult, err error) {
+	ctx, span := action.startSpan(action.session.Context(), "UploadAction.UploadArchive", attribute.String("target", remoteDir), attribute.String("format", string(format)))
+	defer func() { endSpan(span, err) }()
+
+	archive, err := openArchive(r, format)
 	if err != nil {
 		return nil, err
 	}
+	defer archive.Close()
 
-	// Try to upload the file via WebDAV first
-	if client, values, err := net.NewWebDAVClientWithOpaque(upload.UploadEndpoint, upload.Opaque); err == nil {
-		if err := client.Write(values[net.WebDAVPathName], data, dataInfo.Size()); err != nil {
-			return nil, fmt.Errorf("error while writing to '%v' via WebDAV: %v", upload.UploadEndpoint, err)
+	// Check all entries before uploading anything, so that invalid archives never lead to partial uploads
+	paths := make([]string, len(archive.entries))
+	for i, entry := range archive.entries {
+		if paths[i], err = common.CleanRelativePath(entry.name); err != nil {
+			return nil, fmt.Errorf("invalid archive entry: %v", err)
+		}
+	}
+
+	// Make sure that each remote directory is only created once
+	creator := newDirCreator(action.session)
+	if err := creator.makePath(ctx, remoteDir); err != nil {
+		return nil, err
+	}
+
+	results = make([]TransferResult, 0)
+	for i, entry := range archive.entries {
+		rel := paths[i]
+		if rel == "" || !action.Filter.Matches(rel, entry.isDir) || action.Filter.excludesParent(rel) {
+			continue
+		}
+
+		target := p.Join(remoteDir, rel)
+		if entry.isDir {
+			if err := creator.makePath(ctx, target); err != nil {
+				return results, err
+			}
+			continue
+		}
+		if err := creator.makePath(ctx, p.Dir(target)); err != nil {
+			return results, err
+		}
+
+		action.logDebug("uploading archive entry", "entry", entry.name, "target", target, "size", entry.size)
+		result := TransferResult{LocalPath: entry.name, RemotePath: target, Size: entry.size}
+		result.Info, result.Checksums, result.Err = action.uploadArchiveEntry(ctx, entry, target)
+		results = append(results, result)
+	}
+
+	return results, checkTransferResults(results, "upload")
+}
+
+func (action *UploadAction) uploadArchiveEntry(ctx context.Context, entry archiveEntry, target string) (*storage.ResourceInfo, map[string]string, error) {
+	// The size of all entries is known, so their data can be streamed directly
+	data, err := entry.open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the archive entry '%v': %v", entry.name, err)
+	}
+	defer data.Close()
+
+	dataDesc := common.CreateDataDescriptor(p.Base(target), entry.size)
+	return action.upload(ctx, data, &dataDesc, target, false)
+}
+
+func (action *UploadAction) upload(ctx context.Context, data io.Reader, dataInfo os.FileInfo, target string, createDir bool) (info *storage.ResourceInfo, checksums map[string]string, err error) {
+	ctx, span := action.startSpan(ctx, "UploadAction.Upload", attribute.String("target", target), attribute.Int64("size", dataInfo.Size()))
+	defer func() { endSpan(span, err) }()
+
+	// Make sure that all requested local checksums are supported before uploading anything
+	hasher, err := crypto.NewMultiHasher(action.LocalChecksums...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileOpsAct := MustNewFileOperationsAction(action.session)
+
+	if createDir {
+		dir := p.Dir(target)
+		if err := fileOpsAct.makePath(ctx, dir); err != nil {
+			return nil, nil, fmt.Errorf("unable to create target directory '%v': %v", dir, err)
+		}
+	}
+
+	// The size of seekable data can always be determined
+	if seeker, ok := data.(io.Seeker); ok && dataInfo.Size() < 0 {
+		size, err := seeker.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = seeker.Seek(0, io.SeekStart)
 		}
-	} else {
-		// WebDAV is not supported, so directly write to the HTTP endpoint
-		checksumType := action.selectChecksumType(upload.AvailableChecksums)
-		checksumTypeName := crypto.GetChecksumTypeName(checksumType)
-		checksum, err := crypto.ComputeChecksum(checksumType, data)
 		if err != nil {
-			return nil, fmt.Errorf("unable to compute data checksum: %v", err)
+			return nil, nil, fmt.Errorf("unable to determine the data size: %v", err)
+		}
+		dataDesc := common.CreateDataDescriptor(dataInfo.Name(), size)
+		dataInfo = &dataDesc
+	}
+
+	// Non-seekable data sources are spooled to a temporary file if the data needs to be read more than once
+	source := data
+	var spooled *os.File
+	defer func() {
+		if spooled != nil {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}
+	}()
+
+	// Transient failures are retried; interrupted TUS uploads are resumed, all other transfers restart using a fresh upload endpoint
+	var tusClient *net.TUSClient
+	retryPolicy := action.session.RetryPolicy()
+	err = retryPolicy.Retry(ctx, func(attempt int) error {
+		if tusClient != nil {
+			action.logDebug("resuming the upload via TUS", "target", target, "attempt", attempt)
+			start := time.Now()
+			err := tusClient.Resume(ctx)
+			action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolTUS, dataInfo.Size(), start, err)
+			if err != nil {
+				return fmt.Errorf("error while resuming the upload via TUS: %w", err)
+			}
+			return nil
 		}
 
-		// Check if the data object can be seeked; if so, reset it to its beginning
-		if seeker, ok := data.(io.Seeker); ok {
-			_, _ = seeker.Seek(0, 0)
+		if attempt > 1 {
+			if err := rewindData(source); err != nil {
+				return reva.Permanent(fmt.Errorf("unable to retry the upload: %v", err))
+			}
+		}
+
+		// Issue a file upload request to Reva; this will provide the endpoint to write the file data to
+		upload, err := action.initiateUpload(ctx, target, dataInfo.Size())
+		if err != nil {
+			return err
 		}
 
-		if action.EnableTUS {
-			if err := action.uploadFileTUS(upload, target, data, dataInfo, checksum, checksumTypeName); err != nil {
-				return nil, fmt.Errorf("error while writing to '%v' via TUS: %v", upload.UploadEndpoint, err)
+		// Try to upload the file via WebDAV first; this doesn't require a checksum, so the data can be streamed directly
+		if client, values, err := net.NewWebDAVClientWithOpaque(upload.UploadEndpoint, upload.Opaque, action.session.HTTPClient()); err == nil {
+			action.logDebug("uploading via WebDAV", "target", target, "endpoint", upload.UploadEndpoint, "attempt", attempt)
+
+			hasher.Reset()
+			reader := &countingReader{reader: io.TeeReader(source, hasher)}
+			start := time.Now()
+			err := client.Write(ctx, values[net.WebDAVPathName], reader, dataInfo.Size())
+			action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolWebDAV, reader.count, start, err)
+			if err != nil {
+				return fmt.Errorf("error while writing to '%v' via WebDAV: %w", upload.UploadEndpoint, err)
+			}
+			if dataInfo.Size() >= 0 && reader.count != dataInfo.Size() {
+				return reva.Permanent(fmt.Errorf("the data source provided %v bytes instead of %v", reader.count, dataInfo.Size()))
 			}
 		} else {
-			if err := action.uploadFilePUT(upload, data, checksum, checksumTypeName); err != nil {
-				return nil, fmt.Errorf("error while writing to '%v' via HTTP: %v", upload.UploadEndpoint, err)
+			// WebDAV is not supported, so directly write to the HTTP endpoint
+			action.logDebug("WebDAV is not supported by the upload endpoint", "endpoint", upload.UploadEndpoint, "reason", err)
+
+			if dataInfo.Size() < 0 {
+				hasher.Reset()
+				return action.uploadUnknownSize(ctx, upload, io.TeeReader(source, hasher), target, attempt)
+			}
+
+			// The checksum required by the server is computed along with the local ones
+			checksumType, err := action.selectChecksumType(upload.AvailableChecksums)
+			if err != nil {
+				return reva.Permanent(err)
+			}
+			checksumTypeName := crypto.GetChecksumTypeName(checksumType)
+			action.logDebug("selected checksum type", "type", checksumTypeName, "available", upload.AvailableChecksums)
+			if checksumType != provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET {
+				if hasher, err = crypto.NewMultiHasher(append([]string{checksumTypeName}, action.LocalChecksums...)...); err != nil {
+					return reva.Permanent(err)
+				}
+			} else {
+				hasher.Reset()
+			}
+
+			// The checksum has to be sent before the data, so the data needs to be read twice
+			if _, ok := source.(io.Seeker); ok {
+				if _, err := io.Copy(hasher, source); err != nil {
+					return reva.Permanent(fmt.Errorf("unable to compute data checksum: %v", err))
+				}
+				if err := rewindData(source); err != nil {
+					return reva.Permanent(fmt.Errorf("unable to rewind the data source after computing its checksum: %v", err))
+				}
+			} else {
+				action.logDebug("spooling non-seekable data to a temporary file", "target", target)
+				file, err := spoolData(source, hasher, dataInfo.Size())
+				if err != nil {
+					return reva.Permanent(err)
+				}
+				spooled, source = file, file
+			}
+			checksum := hasher.Checksum(checksumTypeName)
+
+			if action.EnableTUS {
+				client, err := net.NewTUSClient(upload.UploadEndpoint, action.session.Token(), upload.Token, action.session.HTTPClient())
+				if err != nil {
+					return fmt.Errorf("unable to create TUS client: %v", err)
+				}
+				action.logDebug("uploading via TUS", "target", target, "endpoint", upload.UploadEndpoint, "attempt", attempt, "creation", client.SupportsResourceCreation())
+
+				start := time.Now()
+				err = client.Write(ctx, source, target, dataInfo, checksumTypeName, checksum)
+				action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolTUS, dataInfo.Size(), start, err)
+				if err != nil {
+					// If the upload has already been started, resume it instead of starting over
+					if client.CanResume() {
+						tusClient = client
+					}
+					return fmt.Errorf("error while writing to '%v' via TUS: %w", upload.UploadEndpoint, err)
+				}
+			} else {
+				action.logDebug("uploading via HTTP PUT", "target", target, "endpoint", upload.UploadEndpoint, "attempt", attempt)
+				start := time.Now()
+				err := action.uploadFilePUT(ctx, upload, source, checksum, checksumTypeName)
+				action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolPUT, dataInfo.Size(), start, err)
+				if err != nil {
+					return fmt.Errorf("error while writing to '%v' via HTTP: %w", upload.UploadEndpoint, err)
+				}
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Return information about the just-uploaded file
-	return fileOpsAct.Stat(target)
+	info, err = fileOpsAct.stat(ctx, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, hasher.Checksums(), nil
+}
+
+func (action *UploadAction) uploadUnknownSize(ctx context.Context, upload *gateway.InitiateFileUploadResponse, data io.Reader, target string, attempt int) error {
+	// The data is streamed as-is, so no checksum can be sent along with it
+	if action.EnableTUS {
+		client, err := net.NewTUSClient(upload.UploadEndpoint, action.session.Token(), upload.Token, action.session.HTTPClient())
+		if err != nil {
+			return fmt.Errorf("unable to create TUS client: %v", err)
+		}
+		if !client.SupportsDeferredLength() {
+			return reva.Permanent(fmt.Errorf("the TUS endpoint '%v' doesn't support uploads of unknown size; either specify the size or disable TUS", upload.UploadEndpoint))
+		}
+		action.logDebug("uploading data of unknown size via TUS", "target", target, "endpoint", upload.UploadEndpoint, "attempt", attempt)
+
+		start := time.Now()
+		size, err := client.WriteDeferred(ctx, data, target)
+		action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolTUS, size, start, err)
+		if err != nil {
+			return fmt.Errorf("error while writing to '%v' via TUS: %w", upload.UploadEndpoint, err)
+		}
+		return nil
+	}
+
+	action.logDebug("uploading data of unknown size via chunked HTTP PUT", "target", target, "endpoint", upload.UploadEndpoint, "attempt", attempt)
+	reader := &countingReader{reader: data}
+	start := time.Now()
+	err := action.uploadFilePUT(ctx, upload, reader, "", "")
+	action.observeTransfer(reva.TransferDirectionUpload, reva.TransferProtocolPUT, reader.count, start, err)
+	if err != nil {
+		return fmt.Errorf("error while writing to '%v' via HTTP: %w", upload.UploadEndpoint, err)
+	}
+	return nil
 }
 
-func (action *UploadAction) initiateUpload(target string, size int64) (*gateway.InitiateFileUploadResponse, error) {
+func (action *UploadAction) initiateUpload(ctx context.Context, target string, size int64) (*gateway.InitiateFileUploadResponse, error) {
 	// Initiating an upload request gets us the upload endpoint for the specified target
 	req := &provider.InitiateFileUploadRequest{
 		Ref: &provider.Reference{
@@ -129,15 +452,15 @@ func (action *UploadAction) initiateUpload(target string, size int64) (*gateway.
 			},
 		},
 		Opaque: &types.Opaque{
-			Map: map[string]*types.OpaqueEntry{
-				"Upload-Length": {
-					Decoder: "plain",
-					Value:   []byte(strconv.FormatInt(size, 10)),
-				},
-			},
+			Map: map[string]*types.OpaqueEntry{},
 		},
 	}
-	res, err := action.session.Client().InitiateFileUpload(action.session.Context(), req)
+	if size >= 0 {
+		req.Opaque.Map["Upload-Length"] = &types.OpaqueEntry{Decoder: "plain", Value: []byte(strconv.FormatInt(size, 10))}
+	} else {
+		req.Opaque.Map["Upload-Defer-Length"] = &types.OpaqueEntry{Decoder: "plain", Value: []byte("1")}
+	}
+	res, err := action.session.Client().InitiateFileUpload(ctx, req)
 	if err := net.CheckRPCInvocation("initiating upload", res, err); err != nil {
 		return nil, err
 	}
@@ -145,44 +468,90 @@ func (action *UploadAction) initiateUpload(target string, size int64) (*gateway.
 	return res, nil
 }
 
-func (action *UploadAction) selectChecksumType(checksumTypes []*provider.ResourceChecksumPriority) provider.ResourceChecksumType {
-	var selChecksumType provider.ResourceChecksumType
+// selectChecksumType selects the checksum type with the highest priority among the ones offered by the server that
+// can be computed locally; UNSET means that no checksum is required.
+func (action *UploadAction) selectChecksumType(checksumTypes []*provider.ResourceChecksumPriority) (provider.ResourceChecksumType, error) {
+	selChecksumType := provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_INVALID
 	var maxPrio uint32 = math.MaxUint32
 	for _, xs := range checksumTypes {
-		if xs.Priority < maxPrio {
+		if _, err := crypto.NewChecksumHash(xs.Type); err != nil && xs.Type != provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_UNSET {
+			continue
+		}
+		if xs.Priority < maxPrio || selChecksumType == provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_INVALID {
 			maxPrio = xs.Priority
 			selChecksumType = xs.Type
 		}
 	}
-	return selChecksumType
+
+	if len(checksumTypes) == 0 {
+		return selChecksumType, fmt.Errorf("the server didn't offer any checksum types")
+	}
+	if selChecksumType == provider.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_INVALID {
+		names := make([]string, 0, len(checksumTypes))
+		for _, xs := range checksumTypes {
+			names = append(names, xs.Type.String())
+		}
+		return selChecksumType, fmt.Errorf("unsupported checksum type %v", strings.Join(names, ", "))
+	}
+	return selChecksumType, nil
 }
 
-func (action *UploadAction) uploadFilePUT(upload *gateway.InitiateFileUploadResponse, data io.Reader, checksum string, checksumType string) error {
-	request, err := action.session.NewHTTPRequest(upload.UploadEndpoint, "PUT", upload.Token, data)
+func (action *UploadAction) uploadFilePUT(ctx context.Context, upload *gateway.InitiateFileUploadResponse, data io.Reader, checksum string, checksumType string) error {
+	request, err := action.session.NewHTTPRequestWithContext(ctx, upload.UploadEndpoint, "PUT", upload.Token, data)
 	if err != nil {
 		return fmt.Errorf("unable to create HTTP request for '%v': %v", upload.UploadEndpoint, err)
 	}
 
-	request.AddParameters(map[string]string{
-		"xs":      checksum,
-		"xs_type": checksumType,
-	})
+	if checksum != "" {
+		request.AddParameters(map[string]string{
+			"xs":      checksum,
+			"xs_type": checksumType,
+		})
+	}
 
 	_, err = request.Do(true)
 	return err
 }
 
-func (action *UploadAction) uploadFileTUS(upload *gateway.InitiateFileUploadResponse, target string, data io.Reader, fileInfo os.FileInfo, checksum string, checksumType string) error {
-	tusClient, err := net.NewTUSClient(upload.UploadEndpoint, action.session.Token(), upload.Token)
+// spoolData stores the given data in a temporary file, feeding it to the hasher along the way; the caller must remove the file.
+func spoolData(data io.Reader, hasher *crypto.MultiHasher, size int64) (*os.File, error) {
+	file, err := ioutil.TempFile("", "libreva-upload-*")
 	if err != nil {
-		return fmt.Errorf("unable to create TUS client: %v", err)
+		return nil, fmt.Errorf("unable to create a temporary file for the data: %v", err)
+	}
+
+	reader := &countingReader{reader: data}
+	_, err = io.Copy(io.MultiWriter(file, hasher), reader)
+	if err == nil && reader.count != size {
+		err = fmt.Errorf("the data source provided %v bytes instead of %v", reader.count, size)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
 	}
-	return tusClient.Write(data, target, fileInfo, checksumType, checksum)
+
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("unable to spool the data to a temporary file: %v", err)
+	}
+	return file, nil
+}
+
+func rewindData(data io.Reader) error {
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("the data source can't be rewound")
+	}
+
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err
 }
 
 // NewUploadAction creates a new upload action.
 func NewUploadAction(session *reva.Session) (*UploadAction, error) {
-	action := &UploadAction{}
+	action := &UploadAction{
+		Workers: DefaultWorkers,
+	}
 	if err := action.initAction(session); err != nil {
 		return nil, fmt.Errorf("unable to create the UploadAction: %v", err)
 	}
@@ -0,0 +1,342 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package action
+
+import (
+	"context"
+	"fmt"
+	p "path"
+	"sort"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// DefaultWatchInterval is the default time between two polls of a Watcher.
+const DefaultWatchInterval = 30 * time.Second
+
+// WatchEventType specifies the kind of change reported by a WatchEvent.
+type WatchEventType int
+
+const (
+	// WatchEventCreated reports a new resource.
+	WatchEventCreated WatchEventType = iota
+	// WatchEventModified reports a file whose contents have changed.
+	WatchEventModified
+	// WatchEventDeleted reports a resource that has been removed.
+	WatchEventDeleted
+	// WatchEventRenamed reports a resource that has been moved or renamed.
+	WatchEventRenamed
+)
+
+// String returns the name of the event type.
+func (eventType WatchEventType) String() string {
+	switch eventType {
+	case WatchEventCreated:
+		return "created"
+	case WatchEventModified:
+		return "modified"
+	case WatchEventDeleted:
+		return "deleted"
+	case WatchEventRenamed:
+		return "renamed"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent describes a single change detected by a Watcher.
+type WatchEvent struct {
+	Type WatchEventType
+	// Path is the (new) path of the resource.
+	Path string
+	// OldPath is the previous path of a renamed resource.
+	OldPath string
+	// Info holds the information of the resource; for deleted resources, this is the last known information.
+	Info *storage.ResourceInfo
+}
+
+// Watcher polls a remote directory tree for changes. Containers whose ETag hasn't changed since the last poll aren't
+// descended, so unchanged parts of the tree cost no requests; renames are detected by the IDs of the resources.
+//
+// Events are reported for every affected resource, with one exception: If a directory is renamed, only the directory
+// itself is reported, not its contents.
+type Watcher struct {
+	action
+
+	// Interval is the time between two polls.
+	Interval time.Duration
+	// OnError is called whenever polling fails; the watcher keeps polling nonetheless.
+	OnError func(err error)
+}
+
+// watchNode is a resource of the watched tree; the children of pruned containers are taken over from the previous poll.
+type watchNode struct {
+	info     *storage.ResourceInfo
+	children []*watchNode
+}
+
+// Watch takes a snapshot of the specified directory tree and then polls it for changes until the context is canceled.
+// The changes are sent to the returned channel, which is closed once the watcher stops.
+func (watcher *Watcher) Watch(ctx context.Context, path string) (<-chan WatchEvent, error) {
+	if watcher.Interval <= 0 {
+		return nil, fmt.Errorf("invalid watch interval %v", watcher.Interval)
+	}
+
+	root, err := watcher.poll(ctx, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to watch '%v': %w", path, err)
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(watcher.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := watcher.poll(ctx, path, root)
+			if err != nil {
+				if ctx.Err() == nil {
+					watcher.reportError(err)
+				}
+				continue
+			}
+
+			for _, event := range diffWatchTrees(root, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			root = current
+		}
+	}()
+	return events, nil
+}
+
+// poll builds the current tree, descending only into containers that have changed compared to the previous tree.
+func (watcher *Watcher) poll(ctx context.Context, path string, previous *watchNode) (root *watchNode, err error) {
+	ctx, cancel := watcher.requestContext(ctx)
+	defer cancel()
+
+	ctx, span := watcher.startSpan(ctx, "Watcher.Poll", attribute.String("path", path))
+	defer func() { endSpan(span, err) }()
+
+	ref := &storage.Reference{
+		Spec: &storage.Reference_Path{Path: path},
+	}
+	res, err := watcher.session.Client().Stat(ctx, &storage.StatRequest{Ref: ref})
+	if err := net.CheckRPCInvocation("querying resource information", res, err); err != nil {
+		return nil, err
+	}
+	if res.Info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return nil, fmt.Errorf("'%v' is not a directory", path)
+	}
+
+	root = &watchNode{info: res.Info}
+	if err := watcher.scan(ctx, root, previous); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// requestContext returns the context for the requests of a single poll. The session context is read anew for every poll,
+// as the session might have logged in again in the meantime; the requests are still canceled along with the given context.
+func (watcher *Watcher) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	rpcCtx, cancel := context.WithCancel(watcher.session.Context())
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-rpcCtx.Done():
+		}
+	}()
+	return rpcCtx, cancel
+}
+
+func (watcher *Watcher) scan(ctx context.Context, node *watchNode, previous *watchNode) error {
+	if previous != nil && previous.info.Etag == node.info.Etag && previous.info.Type == node.info.Type {
+		node.children = previous.children
+		return nil
+	}
+
+	infos, err := MustNewEnumFilesAction(watcher.session).listAll(ctx, node.info.Path, false)
+	if err != nil {
+		return err
+	}
+
+	var previousChildren map[string]*watchNode
+	if previous != nil {
+		previousChildren = make(map[string]*watchNode, len(previous.children))
+		for _, child := range previous.children {
+			previousChildren[child.info.Path] = child
+		}
+	}
+
+	node.children = make([]*watchNode, 0, len(infos))
+	for _, info := range infos {
+		child := &watchNode{info: info}
+		if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			if err := watcher.scan(ctx, child, previousChildren[info.Path]); err != nil {
+				return err
+			}
+		}
+		node.children = append(node.children, child)
+	}
+	return nil
+}
+
+func (watcher *Watcher) reportError(err error) {
+	watcher.session.Logger().Log(reva.LogLevelError, "polling failed", "error", err)
+	if watcher.OnError != nil {
+		watcher.OnError(err)
+	}
+}
+
+// diffWatchTrees compares two trees and returns the resulting events: renames first, followed by creations
+// (parents before their contents), modifications and deletions (contents before their parents).
+func diffWatchTrees(previous *watchNode, current *watchNode) []WatchEvent {
+	oldInfos := flattenWatchTree(previous, make(map[string]*storage.ResourceInfo))
+	newInfos := flattenWatchTree(current, make(map[string]*storage.ResourceInfo))
+
+	created := make([]string, 0)
+	deleted := make([]string, 0)
+	modified := make([]string, 0)
+	for path, info := range newInfos {
+		oldInfo, ok := oldInfos[path]
+		switch {
+		case !ok:
+			created = append(created, path)
+		case oldInfo.Type != info.Type:
+			created = append(created, path)
+			deleted = append(deleted, path)
+		case info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER && oldInfo.Etag != info.Etag:
+			modified = append(modified, path)
+		}
+	}
+	for path := range oldInfos {
+		if _, ok := newInfos[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(created)
+	sort.Sort(sort.Reverse(sort.StringSlice(deleted)))
+
+	// A deleted and a created resource sharing the same ID have been renamed
+	deletedIDs := make(map[string]string, len(deleted))
+	for _, path := range deleted {
+		if id := watchResourceID(oldInfos[path]); id != "" {
+			deletedIDs[id] = path
+		}
+	}
+	renamedFrom := make(map[string]string) // Maps the new paths of renamed resources to their old ones
+	renamedTo := make(map[string]string)   // And vice versa
+	for _, path := range created {
+		if oldPath, ok := deletedIDs[watchResourceID(newInfos[path])]; ok && oldInfos[oldPath].Type == newInfos[path].Type {
+			renamedFrom[path] = oldPath
+			renamedTo[oldPath] = path
+
+			// Renamed files (including the ones within renamed directories) might have been changed as well
+			if info := newInfos[path]; info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER && oldInfos[oldPath].Etag != info.Etag {
+				modified = append(modified, path)
+			}
+		}
+	}
+	sort.Strings(modified)
+
+	events := make([]WatchEvent, 0, len(created)+len(modified)+len(deleted))
+	for _, path := range created {
+		oldPath, ok := renamedFrom[path]
+		if !ok {
+			continue
+		}
+		// Renames of the contents of renamed directories are implied by the rename of the directory
+		if oldParent, ok := renamedFrom[p.Dir(path)]; !ok || p.Join(oldParent, p.Base(path)) != oldPath {
+			events = append(events, WatchEvent{Type: WatchEventRenamed, Path: path, OldPath: oldPath, Info: newInfos[path]})
+		}
+	}
+	for _, path := range created {
+		if _, ok := renamedFrom[path]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventCreated, Path: path, Info: newInfos[path]})
+		}
+	}
+	for _, path := range modified {
+		events = append(events, WatchEvent{Type: WatchEventModified, Path: path, Info: newInfos[path]})
+	}
+	for _, path := range deleted {
+		if _, ok := renamedTo[path]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventDeleted, Path: path, Info: oldInfos[path]})
+		}
+	}
+	return events
+}
+
+func flattenWatchTree(node *watchNode, infos map[string]*storage.ResourceInfo) map[string]*storage.ResourceInfo {
+	for _, child := range node.children {
+		infos[child.info.Path] = child.info
+		flattenWatchTree(child, infos)
+	}
+	return infos
+}
+
+func watchResourceID(info *storage.ResourceInfo) string {
+	if info.Id == nil || info.Id.OpaqueId == "" {
+		return ""
+	}
+	return strings.Join([]string{info.Id.StorageId, info.Id.OpaqueId}, ":")
+}
+
+// NewWatcher creates a new watcher.
+func NewWatcher(session *reva.Session) (*Watcher, error) {
+	watcher := &Watcher{
+		Interval: DefaultWatchInterval,
+	}
+	if err := watcher.initAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the Watcher: %v", err)
+	}
+	return watcher, nil
+}
+
+// MustNewWatcher creates a new watcher and panics on failure.
+func MustNewWatcher(session *reva.Session) *Watcher {
+	watcher, err := NewWatcher(session)
+	if err != nil {
+		panic(err)
+	}
+	return watcher
+}
@@ -0,0 +1,109 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
+	"github.com/Daniel-WWU-IT/libreva/pkg/metrics"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	collector := metrics.NewPrometheusCollector("libreva")
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatalf(testintl.FormatTestError("Registry.Register", err, collector))
+	}
+
+	tests := []struct {
+		direction reva.TransferDirection
+		protocol  reva.TransferProtocol
+		bytes     int64
+		err       error
+	}{
+		{reva.TransferDirectionUpload, reva.TransferProtocolTUS, 100, nil},
+		{reva.TransferDirectionUpload, reva.TransferProtocolTUS, 50, nil},
+		{reva.TransferDirectionUpload, reva.TransferProtocolTUS, 0, fmt.Errorf("upload failed")},
+		{reva.TransferDirectionDownload, reva.TransferProtocolWebDAV, 42, nil},
+	}
+
+	for _, test := range tests {
+		collector.ObserveTransfer(test.direction, test.protocol, test.bytes, time.Second, test.err)
+	}
+	collector.ObserveChecksumMismatch()
+
+	if count := testutil.CollectAndCount(collector, "libreva_transfer_duration_seconds"); count != 2 {
+		t.Errorf(testintl.FormatTestResult("PrometheusCollector.ObserveTransfer", 2, count))
+	}
+	if count := testutil.CollectAndCount(collector, "libreva_transfer_failures_total"); count != 1 {
+		t.Errorf(testintl.FormatTestResult("PrometheusCollector.ObserveTransfer", 1, count))
+	}
+	if count := testutil.CollectAndCount(collector, "libreva_checksum_mismatches_total"); count != 1 {
+		t.Errorf(testintl.FormatTestResult("PrometheusCollector.ObserveChecksumMismatch", 1, count))
+	}
+
+	// Sessions report all retries and gRPC calls to the collector
+	session := reva.MustNewSession(reva.WithMetrics(collector), reva.WithRetryPolicy(reva.RetryPolicy{MaxAttempts: 3}))
+	retryPolicy := session.RetryPolicy()
+	_ = retryPolicy.Retry(context.Background(), func(attempt int) error {
+		return &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}
+	})
+	if err := session.Initiate("127.0.0.1:1", true); err != nil {
+		t.Fatalf(testintl.FormatTestError("Session.Initiate", err, "127.0.0.1:1", true))
+	}
+	_, _ = session.GetLoginMethods()
+
+	expected := `
+# HELP libreva_retries_total Number of operations retried due to transient errors.
+# TYPE libreva_retries_total counter
+libreva_retries_total 2
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "libreva_retries_total"); err != nil {
+		t.Errorf(testintl.FormatTestError("RetryPolicy.Retry", err))
+	}
+
+	expected = `
+# HELP libreva_grpc_calls_total Number of gRPC calls by method and status code.
+# TYPE libreva_grpc_calls_total counter
+libreva_grpc_calls_total{code="Unavailable",method="/cs3.gateway.v1beta1.GatewayAPI/ListAuthProviders"} 1
+# HELP libreva_transfer_bytes_total Number of bytes successfully transferred by direction and protocol.
+# TYPE libreva_transfer_bytes_total counter
+libreva_transfer_bytes_total{direction="download",protocol="WebDAV"} 42
+libreva_transfer_bytes_total{direction="upload",protocol="TUS"} 150
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "libreva_grpc_calls_total", "libreva_transfer_bytes_total"); err != nil {
+		t.Errorf(testintl.FormatTestError("PrometheusCollector.Collect", err))
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// PrometheusCollector records all measurements of a session as Prometheus metrics.
+// It implements both reva.MetricsCollector and prometheus.Collector, so it can be passed to a session and registered with a Prometheus registry.
+type PrometheusCollector struct {
+	rpcCalls          *prometheus.CounterVec
+	rpcDurations      *prometheus.HistogramVec
+	transferBytes     *prometheus.CounterVec
+	transferDurations *prometheus.HistogramVec
+	transferFailures  *prometheus.CounterVec
+	retries           prometheus.Counter
+	checksumFailures  prometheus.Counter
+}
+
+// ObserveRPC records a gRPC call attempt.
+func (collector *PrometheusCollector) ObserveRPC(method string, code string, duration time.Duration) {
+	collector.rpcCalls.WithLabelValues(method, code).Inc()
+	collector.rpcDurations.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ObserveTransfer records a data transfer attempt.
+func (collector *PrometheusCollector) ObserveTransfer(direction reva.TransferDirection, protocol reva.TransferProtocol, bytes int64, duration time.Duration, err error) {
+	if err != nil {
+		collector.transferFailures.WithLabelValues(string(direction), string(protocol)).Inc()
+	}
+	collector.transferBytes.WithLabelValues(string(direction), string(protocol)).Add(float64(bytes))
+	collector.transferDurations.WithLabelValues(string(direction), string(protocol)).Observe(duration.Seconds())
+}
+
+// ObserveRetry records a retried operation.
+func (collector *PrometheusCollector) ObserveRetry() {
+	collector.retries.Inc()
+}
+
+// ObserveChecksumMismatch records a checksum mismatch.
+func (collector *PrometheusCollector) ObserveChecksumMismatch() {
+	collector.checksumFailures.Inc()
+}
+
+// Describe sends the descriptors of all metrics to the provided channel.
+func (collector *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range collector.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect sends the current values of all metrics to the provided channel.
+func (collector *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range collector.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (collector *PrometheusCollector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		collector.rpcCalls,
+		collector.rpcDurations,
+		collector.transferBytes,
+		collector.transferDurations,
+		collector.transferFailures,
+		collector.retries,
+		collector.checksumFailures,
+	}
+}
+
+// NewPrometheusCollector creates a new Prometheus collector; all metric names are prefixed with the given namespace (e.g., "libreva").
+func NewPrometheusCollector(namespace string) *PrometheusCollector {
+	return &PrometheusCollector{
+		rpcCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_calls_total",
+			Help:      "Number of gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		rpcDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_call_duration_seconds",
+			Help:      "Duration of gRPC calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		transferBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_bytes_total",
+			Help:      "Number of bytes successfully transferred by direction and protocol.",
+		}, []string{"direction", "protocol"}),
+		transferDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transfer_duration_seconds",
+			Help:      "Duration of data transfers by direction and protocol.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"direction", "protocol"}),
+		transferFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_failures_total",
+			Help:      "Number of failed data transfers by direction and protocol.",
+		}, []string{"direction", "protocol"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Number of operations retried due to transient errors.",
+		}),
+		checksumFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "checksum_mismatches_total",
+			Help:      "Number of transfers whose data didn't match the expected checksum.",
+		}),
+	}
+}
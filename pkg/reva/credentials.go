@@ -0,0 +1,214 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNoCredentials is returned by credential providers that don't have any credentials for a host.
+var ErrNoCredentials = errors.New("no credentials available")
+
+// Credentials are used to log into Reva.
+type Credentials struct {
+	// User is the user name.
+	User string `json:"user"`
+	// Password is the password or any other secret accepted by the login method.
+	Password string `json:"password"`
+}
+
+// CredentialProvider supplies the credentials used to log into a Reva gateway.
+type CredentialProvider interface {
+	// Credentials returns the credentials for the given gateway host; if none are available, an error matching ErrNoCredentials is returned.
+	Credentials(ctx context.Context, host string) (*Credentials, error)
+}
+
+// CredentialFeedback is implemented by providers that want to know whether their credentials worked (e.g., to store or erase them).
+type CredentialFeedback interface {
+	// Approve is called after a successful login.
+	Approve(ctx context.Context, host string, creds *Credentials) error
+	// Reject is called if the credentials were rejected by the gateway.
+	Reject(ctx context.Context, host string, creds *Credentials) error
+}
+
+// EnvCredentialProvider reads the credentials from environment variables.
+type EnvCredentialProvider struct {
+	// UserVar and PasswordVar are the names of the environment variables.
+	UserVar     string
+	PasswordVar string
+	// User, if set, is used instead of the user name from the environment.
+	User string
+}
+
+// Credentials implements CredentialProvider.
+func (provider *EnvCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	creds := &Credentials{User: provider.User, Password: os.Getenv(provider.PasswordVar)}
+	if creds.User == "" {
+		creds.User = os.Getenv(provider.UserVar)
+	}
+	if creds.User == "" || creds.Password == "" {
+		return nil, fmt.Errorf("%v and %v are not set: %w", provider.UserVar, provider.PasswordVar, ErrNoCredentials)
+	}
+	return creds, nil
+}
+
+// NewEnvCredentialProvider creates a provider reading the credentials from the given environment variables;
+// empty names default to LIBREVA_USER and LIBREVA_PASSWORD.
+func NewEnvCredentialProvider(userVar string, passwordVar string) *EnvCredentialProvider {
+	return &EnvCredentialProvider{
+		UserVar:     valueOrDefault(userVar, defaultUserEnvVar),
+		PasswordVar: valueOrDefault(passwordVar, defaultPasswordEnvVar),
+	}
+}
+
+// StaticCredentialProvider always returns the same credentials; it is mainly meant for tests.
+type StaticCredentialProvider struct {
+	creds Credentials
+}
+
+// Credentials implements CredentialProvider.
+func (provider *StaticCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	creds := provider.creds
+	return &creds, nil
+}
+
+// NewStaticCredentialProvider creates a provider that always returns the given credentials.
+func NewStaticCredentialProvider(user string, password string) *StaticCredentialProvider {
+	return &StaticCredentialProvider{creds: Credentials{User: user, Password: password}}
+}
+
+// PromptCredentialProvider asks the user for the credentials; the password isn't echoed if the input is a terminal.
+type PromptCredentialProvider struct {
+	// In and Out are used to read the input and write the prompts.
+	In  io.Reader
+	Out io.Writer
+	// User is the user name; if set, only the password is asked for.
+	User string
+
+	reader *bufio.Reader
+}
+
+// Credentials implements CredentialProvider.
+func (provider *PromptCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	creds := &Credentials{User: provider.User}
+	if creds.User == "" {
+		user, err := provider.readLine(fmt.Sprintf("Username for %v: ", host), false)
+		if err != nil {
+			return nil, err
+		}
+		creds.User = strings.TrimSpace(user)
+	}
+
+	password, err := provider.readLine(fmt.Sprintf("Password for %v@%v: ", creds.User, host), true)
+	if err != nil {
+		return nil, err
+	}
+	creds.Password = password
+
+	if creds.User == "" || creds.Password == "" {
+		return nil, fmt.Errorf("no credentials entered: %w", ErrNoCredentials)
+	}
+	return creds, nil
+}
+
+func (provider *PromptCredentialProvider) readLine(prompt string, hidden bool) (string, error) {
+	fmt.Fprint(provider.Out, prompt)
+
+	if file, ok := provider.In.(*os.File); ok && hidden && term.IsTerminal(int(file.Fd())) {
+		value, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(provider.Out)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the input: %v", err)
+		}
+		return string(value), nil
+	}
+
+	// The reader is kept, so that buffered input isn't lost between prompts
+	if provider.reader == nil {
+		provider.reader = bufio.NewReader(provider.In)
+	}
+	value, err := provider.reader.ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("unable to read the input: %v", err)
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+// NewPromptCredentialProvider creates a provider that prompts on stderr and reads from stdin; if user is set, only the password is asked for.
+func NewPromptCredentialProvider(user string) *PromptCredentialProvider {
+	return &PromptCredentialProvider{In: os.Stdin, Out: os.Stderr, User: user}
+}
+
+// ChainCredentialProvider asks several providers in turn, returning the credentials of the first one that has any.
+type ChainCredentialProvider struct {
+	providers []CredentialProvider
+	// used is the provider that supplied the last credentials; feedback is passed on to it.
+	used CredentialProvider
+}
+
+// Credentials implements CredentialProvider.
+func (chain *ChainCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	for _, provider := range chain.providers {
+		creds, err := provider.Credentials(ctx, host)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		chain.used = provider
+		return creds, nil
+	}
+	return nil, fmt.Errorf("none of the credential providers has credentials for '%v': %w", host, ErrNoCredentials)
+}
+
+// Approve implements CredentialFeedback.
+func (chain *ChainCredentialProvider) Approve(ctx context.Context, host string, creds *Credentials) error {
+	if feedback, ok := chain.used.(CredentialFeedback); ok {
+		return feedback.Approve(ctx, host, creds)
+	}
+	return nil
+}
+
+// Reject implements CredentialFeedback.
+func (chain *ChainCredentialProvider) Reject(ctx context.Context, host string, creds *Credentials) error {
+	if feedback, ok := chain.used.(CredentialFeedback); ok {
+		return feedback.Reject(ctx, host, creds)
+	}
+	return nil
+}
+
+// NewChainCredentialProvider creates a provider that asks the given providers in order.
+func NewChainCredentialProvider(providers ...CredentialProvider) *ChainCredentialProvider {
+	return &ChainCredentialProvider{providers: providers}
+}
@@ -0,0 +1,281 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	credentialFileVersion  = 1
+	credentialFileSaltSize = 16
+
+	// DefaultCredentialFileIterations is the number of PBKDF2 iterations used to derive the key of new credential files.
+	DefaultCredentialFileIterations = 600000
+	// MinCredentialFileIterations is the lowest number of PBKDF2 iterations accepted for credential files.
+	MinCredentialFileIterations = 100000
+	// MaxCredentialFileIterations is the highest number of PBKDF2 iterations accepted for credential files.
+	MaxCredentialFileIterations = 10000000
+)
+
+// EncryptedFileCredentialProvider reads the credentials from a local file that is encrypted using AES-256-GCM;
+// the key is derived from a passphrase using PBKDF2. Credentials can be added using Store; they are also stored
+// automatically after a successful login (and removed if rejected).
+type EncryptedFileCredentialProvider struct {
+	// Path is the location of the credential file.
+	Path string
+	// Passphrase is called whenever the passphrase of the file is needed.
+	Passphrase func() ([]byte, error)
+	// Iterations is the number of PBKDF2 iterations used when creating a new file.
+	Iterations int
+
+	mutex sync.Mutex
+
+	// The derived key is cached, so that the passphrase is only needed once
+	key           []byte
+	keySalt       []byte
+	keyIterations int
+}
+
+// encryptedCredentialFile is the on-disk format of the credential file; the encrypted data is a JSON map from hosts to credentials.
+type encryptedCredentialFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Credentials implements CredentialProvider.
+func (provider *EncryptedFileCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if _, err := os.Stat(provider.Path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("the credential file '%v' doesn't exist: %w", provider.Path, ErrNoCredentials)
+	}
+	entries, _, err := provider.load()
+	if err != nil {
+		return nil, err
+	}
+	creds, ok := entries[host]
+	if !ok {
+		return nil, fmt.Errorf("the credential file has no entry for '%v': %w", host, ErrNoCredentials)
+	}
+	return creds, nil
+}
+
+// Store adds or replaces the credentials of a host; the file is created if necessary.
+func (provider *EncryptedFileCredentialProvider) Store(host string, creds *Credentials) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	entries, file, err := provider.loadOrCreate()
+	if err != nil {
+		return err
+	}
+	if existing, ok := entries[host]; ok && *existing == *creds {
+		return nil
+	}
+	entries[host] = creds
+	return provider.save(entries, file)
+}
+
+// Remove deletes the credentials of a host.
+func (provider *EncryptedFileCredentialProvider) Remove(host string) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	if _, err := os.Stat(provider.Path); os.IsNotExist(err) {
+		return nil
+	}
+	entries, file, err := provider.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[host]; !ok {
+		return nil
+	}
+	delete(entries, host)
+	return provider.save(entries, file)
+}
+
+// Approve implements CredentialFeedback by storing the credentials.
+func (provider *EncryptedFileCredentialProvider) Approve(ctx context.Context, host string, creds *Credentials) error {
+	return provider.Store(host, creds)
+}
+
+// Reject implements CredentialFeedback by removing the credentials.
+func (provider *EncryptedFileCredentialProvider) Reject(ctx context.Context, host string, creds *Credentials) error {
+	return provider.Remove(host)
+}
+
+func (provider *EncryptedFileCredentialProvider) load() (map[string]*Credentials, *encryptedCredentialFile, error) {
+	data, err := ioutil.ReadFile(provider.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the credential file: %v", err)
+	}
+	file := &encryptedCredentialFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, nil, fmt.Errorf("the credential file is corrupt: %v", err)
+	}
+	if file.Version != credentialFileVersion {
+		return nil, nil, fmt.Errorf("unsupported credential file version %v", file.Version)
+	}
+
+	aead, err := provider.cipher(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, nil, fmt.Errorf("the credential file is corrupt: invalid nonce length %v", len(file.Nonce))
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		provider.key = nil
+		return nil, nil, fmt.Errorf("unable to decrypt the credential file (wrong passphrase?)")
+	}
+
+	entries := make(map[string]*Credentials)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, nil, fmt.Errorf("the credential file is corrupt: %v", err)
+	}
+	return entries, file, nil
+}
+
+func (provider *EncryptedFileCredentialProvider) loadOrCreate() (map[string]*Credentials, *encryptedCredentialFile, error) {
+	if _, err := os.Stat(provider.Path); err == nil {
+		return provider.load()
+	}
+
+	file := &encryptedCredentialFile{
+		Version:    credentialFileVersion,
+		Iterations: provider.Iterations,
+		Salt:       make([]byte, credentialFileSaltSize),
+	}
+	if file.Iterations <= 0 {
+		file.Iterations = DefaultCredentialFileIterations
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return nil, nil, fmt.Errorf("unable to generate a salt: %v", err)
+	}
+	return make(map[string]*Credentials), file, nil
+}
+
+func (provider *EncryptedFileCredentialProvider) save(entries map[string]*Credentials, file *encryptedCredentialFile) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	aead, err := provider.cipher(file)
+	if err != nil {
+		return err
+	}
+	// A fresh nonce is required for every encryption
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return fmt.Errorf("unable to generate a nonce: %v", err)
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(provider.Path), 0700); err != nil {
+		return fmt.Errorf("unable to create the directory of the credential file: %v", err)
+	}
+
+	// Write to a temporary file first, so that an interrupted write never destroys the existing credentials
+	tmpFile, err := ioutil.TempFile(filepath.Dir(provider.Path), filepath.Base(provider.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write the credential file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to write the credential file: %v", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to write the credential file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("unable to write the credential file: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), provider.Path); err != nil {
+		return fmt.Errorf("unable to replace the credential file: %v", err)
+	}
+	return nil
+}
+
+func (provider *EncryptedFileCredentialProvider) cipher(file *encryptedCredentialFile) (cipher.AEAD, error) {
+	// The parameters are read from the file, so they mustn't be trusted blindly
+	if file.Iterations < MinCredentialFileIterations || file.Iterations > MaxCredentialFileIterations {
+		return nil, fmt.Errorf("invalid number of PBKDF2 iterations %v for the credential file (must be between %v and %v)", file.Iterations, MinCredentialFileIterations, MaxCredentialFileIterations)
+	}
+	if len(file.Salt) < credentialFileSaltSize {
+		return nil, fmt.Errorf("the credential file is corrupt: the salt must be at least %v bytes long", credentialFileSaltSize)
+	}
+
+	if provider.key == nil || !bytes.Equal(provider.keySalt, file.Salt) || provider.keyIterations != file.Iterations {
+		if provider.Passphrase == nil {
+			return nil, fmt.Errorf("no passphrase source for the credential file")
+		}
+		passphrase, err := provider.Passphrase()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the passphrase of the credential file: %v", err)
+		}
+		provider.key = pbkdf2.Key(passphrase, file.Salt, file.Iterations, 32, sha256.New)
+		provider.keySalt = file.Salt
+		provider.keyIterations = file.Iterations
+	}
+
+	block, err := aes.NewCipher(provider.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewEncryptedFileCredentialProvider creates a provider for the given credential file, using the passphrase function to unlock it.
+func NewEncryptedFileCredentialProvider(path string, passphrase func() ([]byte, error)) *EncryptedFileCredentialProvider {
+	return &EncryptedFileCredentialProvider{Path: path, Passphrase: passphrase, Iterations: DefaultCredentialFileIterations}
+}
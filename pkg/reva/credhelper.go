@@ -0,0 +1,106 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// HelperCredentialProvider asks an external helper program for the credentials, using the protocol of Git credential helpers:
+// The helper is run with the action ("get", "store" or "erase") as its last argument and receives key=value lines
+// (protocol, host and, except for "get", username and password) on its standard input, terminated by an empty line.
+// For "get", it prints the username and password in the same format.
+type HelperCredentialProvider struct {
+	// Command is the helper program and its arguments.
+	Command []string
+}
+
+// Credentials implements CredentialProvider.
+func (provider *HelperCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	output, err := provider.run(ctx, "get", host, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			values[key] = value
+		}
+	}
+
+	if values["quit"] == "1" || values["quit"] == "true" || values["password"] == "" {
+		return nil, fmt.Errorf("the credential helper has no credentials for '%v': %w", host, ErrNoCredentials)
+	}
+	return &Credentials{User: values["username"], Password: values["password"]}, nil
+}
+
+// Approve implements CredentialFeedback by asking the helper to store the credentials.
+func (provider *HelperCredentialProvider) Approve(ctx context.Context, host string, creds *Credentials) error {
+	_, err := provider.run(ctx, "store", host, creds)
+	return err
+}
+
+// Reject implements CredentialFeedback by asking the helper to erase the credentials.
+func (provider *HelperCredentialProvider) Reject(ctx context.Context, host string, creds *Credentials) error {
+	_, err := provider.run(ctx, "erase", host, creds)
+	return err
+}
+
+func (provider *HelperCredentialProvider) run(ctx context.Context, action string, host string, creds *Credentials) ([]byte, error) {
+	if len(provider.Command) == 0 {
+		return nil, fmt.Errorf("no credential helper specified")
+	}
+
+	var input strings.Builder
+	fmt.Fprintf(&input, "protocol=grpc\nhost=%v\n", host)
+	if creds != nil {
+		fmt.Fprintf(&input, "username=%v\npassword=%v\n", creds.User, creds.Password)
+	}
+	input.WriteString("\n")
+
+	args := append(append([]string{}, provider.Command[1:]...), action)
+	cmd := exec.CommandContext(ctx, provider.Command[0], args...)
+	cmd.Stdin = strings.NewReader(input.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("the credential helper failed (%v): %v", err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// NewHelperCredentialProvider creates a provider that runs the given helper program.
+func NewHelperCredentialProvider(command ...string) *HelperCredentialProvider {
+	return &HelperCredentialProvider{Command: command}
+}
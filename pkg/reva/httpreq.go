@@ -19,11 +19,11 @@
 package reva
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"time"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 )
@@ -36,17 +36,15 @@ type httpRequest struct {
 	request *http.Request
 }
 
-func (request *httpRequest) initRequest(session *Session, endpoint string, method string, transportToken string, data io.Reader) error {
+func (request *httpRequest) initRequest(ctx context.Context, session *Session, endpoint string, method string, transportToken string, data io.Reader) error {
 	request.endpoint = endpoint
 	request.data = data
 
-	// Initialize the HTTP client
-	request.client = &http.Client{
-		Timeout: time.Duration(24 * int64(time.Hour)),
-	}
+	// Use the shared HTTP client of the session
+	request.client = session.HTTPClient()
 
 	// Initialize the HTTP request
-	httpReq, err := http.NewRequestWithContext(session.Context(), method, endpoint, data)
+	httpReq, err := http.NewRequestWithContext(ctx, method, endpoint, data)
 	if err != nil {
 		return fmt.Errorf("unable to create the HTTP request: %v", err)
 	}
@@ -62,10 +60,11 @@ func (request *httpRequest) initRequest(session *Session, endpoint string, metho
 func (request *httpRequest) do() (*http.Response, error) {
 	httpRes, err := request.client.Do(request.request)
 	if err != nil {
-		return nil, fmt.Errorf("unable to do the HTTP request: %v", err)
+		return nil, fmt.Errorf("unable to do the HTTP request: %w", err)
 	}
 	if httpRes.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("performing the HTTP request failed: %v", httpRes.Status)
+		httpRes.Body.Close()
+		return nil, &net.HTTPError{StatusCode: httpRes.StatusCode, Status: httpRes.Status}
 	}
 	return httpRes, nil
 }
@@ -85,7 +84,7 @@ func (request *httpRequest) AddParameters(params map[string]string) {
 func (request *httpRequest) Do(checkStatus bool) ([]byte, error) {
 	httpRes, err := request.do()
 	if err != nil {
-		return nil, fmt.Errorf("unable to perform the HTTP request for '%v': %v", request.endpoint, err)
+		return nil, fmt.Errorf("unable to perform the HTTP request for '%v': %w", request.endpoint, err)
 	}
 	defer httpRes.Body.Close()
 
@@ -100,9 +99,19 @@ func (request *httpRequest) Do(checkStatus bool) ([]byte, error) {
 	return data, nil
 }
 
-func newHTTPRequest(session *Session, endpoint string, method string, transportToken string, data io.Reader) (*httpRequest, error) {
+// Stream performs the request on the HTTP endpoint and returns a reader for the body data (which the caller must close) along with the response header.
+// The call will only succeed if the server returns a status code of 200.
+func (request *httpRequest) Stream() (io.ReadCloser, http.Header, error) {
+	httpRes, err := request.do()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to perform the HTTP request for '%v': %w", request.endpoint, err)
+	}
+	return httpRes.Body, httpRes.Header, nil
+}
+
+func newHTTPRequest(ctx context.Context, session *Session, endpoint string, method string, transportToken string, data io.Reader) (*httpRequest, error) {
 	request := &httpRequest{}
-	if err := request.initRequest(session, endpoint, method, transportToken, data); err != nil {
+	if err := request.initRequest(ctx, session, endpoint, method, transportToken, data); err != nil {
 		return nil, fmt.Errorf("unable to initialize the HTTP request: %v", err)
 	}
 	return request, nil
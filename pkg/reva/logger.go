@@ -0,0 +1,205 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	protov1 "github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// LogLevel specifies the severity of a log message.
+type LogLevel int
+
+const (
+	// LogLevelDebug is used for detailed information about the inner workings of the library.
+	LogLevelDebug LogLevel = iota
+	// LogLevelInfo is used for general information.
+	LogLevelInfo
+	// LogLevelWarn is used for unexpected, but non-critical situations.
+	LogLevelWarn
+	// LogLevelError is used for errors.
+	LogLevelError
+)
+
+// String returns the name of the log level.
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Logger is used to emit structured log messages.
+// Each message is accompanied by an arbitrary number of alternating key-value pairs.
+type Logger interface {
+	// Log emits a single message with the given level.
+	Log(level LogLevel, msg string, keysAndValues ...interface{})
+}
+
+// RedactedValue replaces all sensitive values (like tokens and passwords) in log messages.
+const RedactedValue = "[REDACTED]"
+
+var sensitiveLogKeys = []string{"token", "password", "secret", "authorization"}
+
+var (
+	// urlUserInfoRegexp matches the user information (like "user:password@") of URLs
+	urlUserInfoRegexp = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#\s@]+@`)
+	// sensitiveQueryRegexp matches the values of query parameters carrying credentials (like "?access_token=...")
+	sensitiveQueryRegexp = regexp.MustCompile(`(?i)([?&][^=&#\s]*(?:` + strings.Join(sensitiveLogKeys, "|") + `|signature)[^=&#\s]*=)[^&#\s]*`)
+)
+
+type nopLogger struct {
+}
+
+func (logger *nopLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+}
+
+type stdLogger struct {
+	logger   *log.Logger
+	minLevel LogLevel
+}
+
+func (logger *stdLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	if level < logger.minLevel {
+		return
+	}
+
+	var line strings.Builder
+	_, _ = fmt.Fprintf(&line, "%s %s", level, msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		_, _ = fmt.Fprintf(&line, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	logger.logger.Println(line.String())
+}
+
+// NewStdLogger creates a logger that writes all messages of at least the given level to a standard library logger.
+func NewStdLogger(logger *log.Logger, minLevel LogLevel) Logger {
+	return &stdLogger{
+		logger:   logger,
+		minLevel: minLevel,
+	}
+}
+
+type redactingLogger struct {
+	logger Logger
+}
+
+func (logger *redactingLogger) Log(level LogLevel, msg string, keysAndValues ...interface{}) {
+	// Never pass sensitive values on to the actual logger, neither via sensitive keys nor embedded in other values
+	redacted := make([]interface{}, len(keysAndValues))
+	for i, value := range keysAndValues {
+		if i%2 == 1 && isSensitiveLogKey(fmt.Sprint(keysAndValues[i-1])) {
+			redacted[i] = RedactedValue
+		} else {
+			redacted[i] = redactLogValue(value)
+		}
+	}
+	logger.logger.Log(level, Redact(msg), redacted...)
+}
+
+func isSensitiveLogKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitiveKey := range sensitiveLogKeys {
+		if strings.Contains(key, sensitiveKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactLogValue redacts credentials contained in a single value; values without any credentials are returned unchanged.
+func redactLogValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return Redact(v)
+	case *url.URL:
+		if v != nil {
+			return Redact(v.String())
+		}
+	case protov1.Message:
+		// Requests and responses (like AuthenticateRequest) carry credentials in their token, password or secret fields
+		return redactMessage(v)
+	case error:
+		if text := v.Error(); Redact(text) != text {
+			return Redact(text)
+		}
+	case fmt.Stringer:
+		if text := v.String(); Redact(text) != text {
+			return Redact(text)
+		}
+	}
+	return value
+}
+
+func redactMessage(msg protov1.Message) protov1.Message {
+	clone := protov1.Clone(msg)
+	redactMessageFields(protov1.MessageReflect(clone))
+	return clone
+}
+
+func redactMessageFields(msg protoreflect.Message) {
+	sensitiveFields := make([]protoreflect.FieldDescriptor, 0)
+	msg.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case field.IsList() || field.IsMap():
+		case field.Kind() == protoreflect.StringKind && isSensitiveLogKey(string(field.Name())):
+			sensitiveFields = append(sensitiveFields, field)
+		case field.Kind() == protoreflect.MessageKind:
+			redactMessageFields(value.Message())
+		}
+		return true
+	})
+	for _, field := range sensitiveFields {
+		msg.Set(field, protoreflect.ValueOfString(RedactedValue))
+	}
+}
+
+// Redact replaces credentials embedded in the given text, namely the user information of URLs and the values of
+// query parameters like "access_token" or "password".
+func Redact(text string) string {
+	text = urlUserInfoRegexp.ReplaceAllString(text, "${1}"+RedactedValue+"@")
+	return sensitiveQueryRegexp.ReplaceAllString(text, "${1}"+RedactedValue)
+}
+
+func newRedactingLogger(logger Logger) Logger {
+	if logger == nil {
+		logger = &nopLogger{}
+	}
+	return &redactingLogger{logger: logger}
+}
@@ -0,0 +1,99 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"context"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// TransferDirection specifies whether data is uploaded or downloaded.
+type TransferDirection string
+
+// TransferProtocol specifies the protocol used to transfer data.
+type TransferProtocol string
+
+const (
+	// TransferDirectionUpload is used for all uploads.
+	TransferDirectionUpload TransferDirection = "upload"
+	// TransferDirectionDownload is used for all downloads.
+	TransferDirectionDownload TransferDirection = "download"
+
+	// TransferProtocolPUT is used for uploads via plain HTTP PUT requests.
+	TransferProtocolPUT TransferProtocol = "PUT"
+	// TransferProtocolTUS is used for uploads via TUS.
+	TransferProtocolTUS TransferProtocol = "TUS"
+	// TransferProtocolWebDAV is used for uploads and downloads via WebDAV.
+	TransferProtocolWebDAV TransferProtocol = "WebDAV"
+	// TransferProtocolHTTP is used for downloads via plain HTTP GET requests.
+	TransferProtocolHTTP TransferProtocol = "HTTP"
+)
+
+// MetricsCollector receives measurements about all gRPC calls and data transfers made through a session.
+// Implementations must be safe for concurrent use; the metrics package provides a Prometheus-based collector.
+type MetricsCollector interface {
+	// ObserveRPC is called after each gRPC call attempt; the code is either the gRPC error code or the CS3 status code of the reply.
+	ObserveRPC(method string, code string, duration time.Duration)
+	// ObserveTransfer is called after each data transfer attempt; bytes is only set if the transfer succeeded.
+	ObserveTransfer(direction TransferDirection, protocol TransferProtocol, bytes int64, duration time.Duration, err error)
+	// ObserveRetry is called whenever a failed operation is retried.
+	ObserveRetry()
+	// ObserveChecksumMismatch is called whenever transferred data didn't match its checksum.
+	ObserveChecksumMismatch()
+}
+
+type nopMetricsCollector struct {
+}
+
+func (collector *nopMetricsCollector) ObserveRPC(string, string, time.Duration) {
+}
+
+func (collector *nopMetricsCollector) ObserveTransfer(TransferDirection, TransferProtocol, int64, time.Duration, error) {
+}
+
+func (collector *nopMetricsCollector) ObserveRetry() {
+}
+
+func (collector *nopMetricsCollector) ObserveChecksumMismatch() {
+}
+
+func (session *Session) metricsInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	code := status.Code(err).String()
+	if err == nil {
+		if res, ok := reply.(interface{ GetStatus() *rpc.Status }); ok && res.GetStatus() != nil {
+			code = res.GetStatus().Code.String()
+		}
+	}
+	session.metrics.ObserveRPC(method, code, time.Since(start))
+
+	return err
+}
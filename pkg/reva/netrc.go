@@ -0,0 +1,144 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NetrcCredentialProvider reads the credentials from a netrc file; the login and password of the machine matching the gateway host
+// (with or without its port) are used, falling back to the default entry.
+type NetrcCredentialProvider struct {
+	// Path is the location of the netrc file.
+	Path string
+}
+
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// Credentials implements CredentialProvider.
+func (provider *NetrcCredentialProvider) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	data, err := ioutil.ReadFile(provider.Path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("the netrc file '%v' doesn't exist: %w", provider.Path, ErrNoCredentials)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read the netrc file: %v", err)
+	}
+
+	entries := parseNetrc(string(data))
+	hostname := host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		hostname = name
+	}
+
+	var fallback *netrcEntry
+	for _, candidate := range []string{host, hostname} {
+		for i := range entries {
+			entry := &entries[i]
+			if entry.machine == candidate && entry.password != "" {
+				return &Credentials{User: entry.login, Password: entry.password}, nil
+			} else if entry.machine == "" && fallback == nil {
+				fallback = entry
+			}
+		}
+	}
+	if fallback != nil && fallback.password != "" {
+		return &Credentials{User: fallback.login, Password: fallback.password}, nil
+	}
+	return nil, fmt.Errorf("the netrc file has no entry for '%v': %w", host, ErrNoCredentials)
+}
+
+// parseNetrc parses the contents of a netrc file; the default entry is stored with an empty machine name.
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	var entry *netrcEntry
+
+	lines := strings.Split(data, "\n")
+	for lineIndex := 0; lineIndex < len(lines); lineIndex++ {
+		line := lines[lineIndex]
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		for i := 0; i < len(tokens); i++ {
+			value := func() string {
+				if i+1 < len(tokens) {
+					i++
+					return tokens[i]
+				}
+				return ""
+			}
+
+			switch tokens[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: value()})
+				entry = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				entry = &entries[len(entries)-1]
+			case "login":
+				if entry != nil {
+					entry.login = value()
+				}
+			case "password":
+				if entry != nil {
+					entry.password = value()
+				}
+			case "account":
+				value()
+			case "macdef":
+				// Macro definitions end with an empty line
+				for lineIndex+1 < len(lines) && strings.TrimSpace(lines[lineIndex+1]) != "" {
+					lineIndex++
+				}
+				i = len(tokens)
+			}
+		}
+	}
+	return entries
+}
+
+// NewNetrcCredentialProvider creates a provider reading the given netrc file; an empty path defaults to $NETRC or ~/.netrc.
+func NewNetrcCredentialProvider(path string) *NetrcCredentialProvider {
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".netrc")
+		}
+	}
+	return &NetrcCredentialProvider{Path: path}
+}
@@ -0,0 +1,105 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+)
+
+// HTTPMiddleware wraps the round tripper used for data transfers, e.g., to add custom headers or to log requests.
+type HTTPMiddleware func(http.RoundTripper) http.RoundTripper
+
+// SessionOption is used to configure a session when creating it.
+type SessionOption func(*Session)
+
+// WithTransferConfig sets the configuration of the HTTP transport used for all data transfers.
+func WithTransferConfig(config TransferConfig) SessionOption {
+	return func(session *Session) {
+		session.transferConfig = config
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry operations that failed due to transient errors.
+func WithRetryPolicy(policy RetryPolicy) SessionOption {
+	return func(session *Session) {
+		session.retryPolicy = policy
+	}
+}
+
+// WithUnaryInterceptors registers gRPC interceptors that are invoked for every unary call made through the session.
+// The interceptors are called in the given order.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) SessionOption {
+	return func(session *Session) {
+		session.unaryInterceptors = append(session.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors registers gRPC interceptors that are invoked for every streaming call made through the session.
+// The interceptors are called in the given order.
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) SessionOption {
+	return func(session *Session) {
+		session.streamInterceptors = append(session.streamInterceptors, interceptors...)
+	}
+}
+
+// WithHTTPMiddleware registers middleware that wraps the round tripper used for all data transfers.
+// The first middleware is the outermost one, meaning that it sees each request first.
+func WithHTTPMiddleware(middleware ...HTTPMiddleware) SessionOption {
+	return func(session *Session) {
+		session.httpMiddleware = append(session.httpMiddleware, middleware...)
+	}
+}
+
+// WithLogger sets the logger used to emit log messages; sensitive values like tokens are always redacted.
+func WithLogger(logger Logger) SessionOption {
+	return func(session *Session) {
+		session.logger = newRedactingLogger(logger)
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used to create spans for all actions and transfers.
+// If this option isn't used, the global provider is used; passing nil disables tracing.
+func WithTracerProvider(provider trace.TracerProvider) SessionOption {
+	return func(session *Session) {
+		if provider == nil {
+			provider = noop.NewTracerProvider()
+		}
+		session.tracerProvider = provider
+	}
+}
+
+// WithMetrics sets the collector that receives measurements about all gRPC calls and data transfers; passing nil disables metrics.
+func WithMetrics(collector MetricsCollector) SessionOption {
+	return func(session *Session) {
+		if collector == nil {
+			collector = &nopMetricsCollector{}
+		}
+		session.metrics = collector
+	}
+}
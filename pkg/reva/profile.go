@@ -0,0 +1,403 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ProfilesEnvVar is the environment variable that overrides the location of the default profiles file.
+	ProfilesEnvVar = "LIBREVA_PROFILES"
+
+	// DefaultLoginMethod is used if a profile doesn't specify a login method.
+	DefaultLoginMethod = "basic"
+	// DefaultHomePath is used if a profile doesn't specify a home path.
+	DefaultHomePath = "/home"
+
+	// CredentialSourceNone doesn't provide any credentials, so sessions aren't logged in automatically.
+	CredentialSourceNone = "none"
+	// CredentialSourceEnv reads the credentials from environment variables.
+	CredentialSourceEnv = "env"
+	// CredentialSourceStatic uses the user and password stored in the profile itself; this is meant for tests and local setups only.
+	CredentialSourceStatic = "static"
+	// CredentialSourcePrompt asks the user for the password (and the user name, if not configured) on the terminal.
+	CredentialSourcePrompt = "prompt"
+	// CredentialSourceNetrc reads the credentials from a netrc file.
+	CredentialSourceNetrc = "netrc"
+	// CredentialSourceHelper asks an external credential helper (see HelperCredentialProvider).
+	CredentialSourceHelper = "helper"
+	// CredentialSourceFile reads the credentials from an encrypted credential file (see EncryptedFileCredentialProvider).
+	CredentialSourceFile = "file"
+
+	defaultUserEnvVar       = "LIBREVA_USER"
+	defaultPasswordEnvVar   = "LIBREVA_PASSWORD"
+	defaultPassphraseEnvVar = "LIBREVA_CREDENTIALS_PASSPHRASE"
+)
+
+// TLSSettings describes how the connection to the gateway is secured.
+type TLSSettings struct {
+	// Insecure disables TLS altogether.
+	Insecure bool `yaml:"insecure"`
+	// CAFile is a PEM file holding additional certificate authorities to trust.
+	CAFile string `yaml:"caFile"`
+	// SkipVerify disables the verification of the server certificate.
+	SkipVerify bool `yaml:"skipVerify"`
+	// ServerName overrides the name used to verify the server certificate.
+	ServerName string `yaml:"serverName"`
+}
+
+// CredentialSettings describes where the credentials used to log in come from.
+type CredentialSettings struct {
+	// Source is the credential source (see the CredentialSource constants); defaults to "env".
+	Source string `yaml:"source"`
+	// User is the user name; for the "env" source, it takes precedence over the environment variable.
+	User string `yaml:"user"`
+	// Password is the password used by the "static" source.
+	Password string `yaml:"password"`
+	// UserEnv and PasswordEnv are the environment variables read by the "env" source (LIBREVA_USER and LIBREVA_PASSWORD by default).
+	UserEnv     string `yaml:"userEnv"`
+	PasswordEnv string `yaml:"passwordEnv"`
+	// NetrcFile is the netrc file read by the "netrc" source ($NETRC or ~/.netrc by default).
+	NetrcFile string `yaml:"netrcFile"`
+	// Helper is the command line of the credential helper used by the "helper" source.
+	Helper string `yaml:"helper"`
+	// File is the encrypted credential file used by the "file" source.
+	File string `yaml:"file"`
+	// PassphraseEnv is the environment variable holding the passphrase of the credential file (LIBREVA_CREDENTIALS_PASSPHRASE by default);
+	// if it isn't set, the passphrase is asked for on the terminal.
+	PassphraseEnv string `yaml:"passphraseEnv"`
+}
+
+// Profile describes how to connect to and log into a Reva instance (a "remote").
+type Profile struct {
+	// Name is the name of the profile within its profiles file.
+	Name string `yaml:"-"`
+
+	// Gateway is the address (host:port) of the Reva gateway.
+	Gateway string `yaml:"gateway"`
+	// TLS configures the security of the gateway connection.
+	TLS TLSSettings `yaml:"tls"`
+	// LoginMethod is the default login method; defaults to "basic".
+	LoginMethod string `yaml:"loginMethod"`
+	// Credentials configures where the login credentials come from.
+	Credentials CredentialSettings `yaml:"credentials"`
+	// Home is the remote directory that relative paths refer to; defaults to "/home".
+	Home string `yaml:"home"`
+}
+
+// Profiles holds all named profiles read from a profiles file.
+type Profiles struct {
+	// Default is the name of the profile used if no name is given.
+	Default string `yaml:"default"`
+	// Remotes maps the profile names to the profiles.
+	Remotes map[string]*Profile `yaml:"remotes"`
+}
+
+// Names returns the sorted names of all profiles.
+func (profiles *Profiles) Names() []string {
+	names := make([]string, 0, len(profiles.Remotes))
+	for name := range profiles.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profile returns the named profile; if the name is empty, the default profile (or the only existing one) is returned.
+func (profiles *Profiles) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = profiles.Default
+	}
+	if name == "" && len(profiles.Remotes) == 1 {
+		for n := range profiles.Remotes {
+			name = n
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no profile name given and no default profile set")
+	}
+
+	profile, ok := profiles.Remotes[name]
+	if !ok {
+		return nil, fmt.Errorf("no profile named '%v' found (available: %v)", name, strings.Join(profiles.Names(), ", "))
+	}
+	return profile, nil
+}
+
+// TLSConfig returns the TLS configuration of the gateway connection; it is nil if TLS is disabled.
+func (profile *Profile) TLSConfig() (*tls.Config, error) {
+	if profile.TLS.Insecure {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		InsecureSkipVerify: profile.TLS.SkipVerify,
+		ServerName:         profile.TLS.ServerName,
+	}
+	if profile.TLS.CAFile != "" {
+		data, err := ioutil.ReadFile(profile.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA file: %v", err)
+		}
+
+		// The CA is trusted in addition to the system's certificate authorities
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in the CA file '%v'", profile.TLS.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
+
+// Connect creates a session and connects it to the gateway of the profile, without logging in.
+func (profile *Profile) Connect(opts ...SessionOption) (*Session, error) {
+	tlsConfig, err := profile.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("profile '%v': %v", profile.Name, err)
+	}
+
+	session, err := NewSession(opts...)
+	if err != nil {
+		return nil, err
+	}
+	session.profile = profile
+	if err := session.initiate(profile.Gateway, tlsConfig); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// CredentialProvider creates the credential provider described by the credential settings of the profile.
+func (profile *Profile) CredentialProvider() (CredentialProvider, error) {
+	creds := profile.Credentials
+	switch creds.Source {
+	case CredentialSourceEnv:
+		provider := NewEnvCredentialProvider(creds.UserEnv, creds.PasswordEnv)
+		provider.User = creds.User
+		return provider, nil
+
+	case CredentialSourceStatic:
+		return NewStaticCredentialProvider(creds.User, creds.Password), nil
+
+	case CredentialSourcePrompt:
+		return NewPromptCredentialProvider(creds.User), nil
+
+	case CredentialSourceNetrc:
+		return NewNetrcCredentialProvider(creds.NetrcFile), nil
+
+	case CredentialSourceHelper:
+		return NewHelperCredentialProvider(strings.Fields(creds.Helper)...), nil
+
+	case CredentialSourceFile:
+		passphraseVar := valueOrDefault(creds.PassphraseEnv, defaultPassphraseEnvVar)
+		return NewEncryptedFileCredentialProvider(creds.File, func() ([]byte, error) {
+			if passphrase := os.Getenv(passphraseVar); passphrase != "" {
+				return []byte(passphrase), nil
+			}
+			prompt := &PromptCredentialProvider{In: os.Stdin, Out: os.Stderr}
+			passphrase, err := prompt.readLine(fmt.Sprintf("Passphrase for %v: ", creds.File), true)
+			return []byte(passphrase), err
+		}), nil
+
+	case CredentialSourceNone:
+		return nil, fmt.Errorf("profile '%v' doesn't provide any credentials: %w", profile.Name, ErrNoCredentials)
+
+	default:
+		return nil, fmt.Errorf("unknown credential source '%v'", creds.Source)
+	}
+}
+
+// LoginCredentials returns the user name and password supplied by the credential provider of the profile.
+func (profile *Profile) LoginCredentials() (string, string, error) {
+	provider, err := profile.CredentialProvider()
+	if err != nil {
+		return "", "", err
+	}
+	creds, err := provider.Credentials(context.Background(), profile.Gateway)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.User, creds.Password, nil
+}
+
+// Login logs the session into Reva using the login method and credential provider of the profile; the session logs in again
+// through the provider when its token expires.
+func (profile *Profile) Login(session *Session) error {
+	provider, err := profile.CredentialProvider()
+	if err != nil {
+		return err
+	}
+	if profile.storesPassword() {
+		session.logger.Log(LogLevelWarn, "the profile stores a plaintext password; use another credential source outside of tests", "profile", profile.Name)
+	}
+	return session.LoginWithProvider(profile.LoginMethod, provider)
+}
+
+func (profile *Profile) storesPassword() bool {
+	return profile.Credentials.Source == CredentialSourceStatic && profile.Credentials.Password != ""
+}
+
+// NewSession creates a session that is connected to the gateway of the profile and logged in using its credentials.
+func (profile *Profile) NewSession(opts ...SessionOption) (*Session, error) {
+	session, err := profile.Connect(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := profile.Login(session); err != nil {
+		return nil, fmt.Errorf("unable to log in using profile '%v': %w", profile.Name, err)
+	}
+	return session, nil
+}
+
+func (profile *Profile) normalize() error {
+	if profile.Gateway == "" {
+		return fmt.Errorf("profile '%v' doesn't specify a gateway", profile.Name)
+	}
+	if profile.TLS.Insecure && (profile.TLS.CAFile != "" || profile.TLS.SkipVerify) {
+		return fmt.Errorf("profile '%v' disables TLS but also configures it", profile.Name)
+	}
+
+	profile.LoginMethod = valueOrDefault(profile.LoginMethod, DefaultLoginMethod)
+	profile.Credentials.Source = strings.ToLower(valueOrDefault(profile.Credentials.Source, CredentialSourceEnv))
+	if profile.Credentials.Source == CredentialSourceHelper && strings.TrimSpace(profile.Credentials.Helper) == "" {
+		return fmt.Errorf("profile '%v' uses a credential helper but doesn't specify it", profile.Name)
+	}
+	if profile.Credentials.Source == CredentialSourceFile && profile.Credentials.File == "" {
+		return fmt.Errorf("profile '%v' uses a credential file but doesn't specify it", profile.Name)
+	}
+	profile.Home = valueOrDefault(profile.Home, DefaultHomePath)
+	return nil
+}
+
+// ParseProfiles parses profiles given in YAML.
+func ParseProfiles(data []byte) (*Profiles, error) {
+	profiles := &Profiles{}
+	if err := yaml.Unmarshal(data, profiles); err != nil {
+		return nil, fmt.Errorf("unable to parse the profiles: %v", err)
+	}
+
+	for name, profile := range profiles.Remotes {
+		if profile == nil {
+			return nil, fmt.Errorf("profile '%v' is empty", name)
+		}
+		profile.Name = name
+		if err := profile.normalize(); err != nil {
+			return nil, err
+		}
+	}
+	if profiles.Default != "" {
+		if _, ok := profiles.Remotes[profiles.Default]; !ok {
+			return nil, fmt.Errorf("the default profile '%v' doesn't exist", profiles.Default)
+		}
+	}
+	return profiles, nil
+}
+
+// LoadProfiles reads the profiles from a YAML file.
+// Files storing plaintext passwords (via the "static" credential source) must not be accessible by other users (i.e., use mode 0600).
+func LoadProfiles(path string) (*Profiles, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the profiles file: %w", err)
+	}
+
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	if profiles.storePasswords() && runtime.GOOS != "windows" {
+		if fileInfo, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("unable to stat the profiles file: %v", err)
+		} else if fileInfo.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("%v: the file stores plaintext passwords but is accessible by other users (mode %v); restrict its mode to 0600", path, fileInfo.Mode().Perm())
+		}
+	}
+	return profiles, nil
+}
+
+func (profiles *Profiles) storePasswords() bool {
+	for _, profile := range profiles.Remotes {
+		if profile.storesPassword() {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultProfilesPath returns the location of the default profiles file: the file specified by LIBREVA_PROFILES or,
+// if that isn't set, libreva/profiles.yaml in the user's configuration directory.
+func DefaultProfilesPath() (string, error) {
+	if path := os.Getenv(ProfilesEnvVar); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the configuration directory: %v", err)
+	}
+	return filepath.Join(dir, "libreva", "profiles.yaml"), nil
+}
+
+// NewSessionFromProfile creates a session according to the named profile in the default profiles file (see DefaultProfilesPath).
+// The session is connected to the gateway and logged in; an empty name selects the default profile.
+func NewSessionFromProfile(name string, opts ...SessionOption) (*Session, error) {
+	path, err := DefaultProfilesPath()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := profiles.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	return profile.NewSession(opts...)
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,230 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	stdnet "net"
+	"net/http"
+	"time"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common"
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+)
+
+// RetryPolicy specifies how operations that failed due to transient errors are retried.
+// It is applied to idempotent gRPC calls (Stat, ListContainer and InitiateFileDownload) as well as to data transfers.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts (including the first one); values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the time to wait between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each attempt.
+	Multiplier float64
+	// Jitter randomizes each backoff by up to the given fraction (0.0 - 1.0) in either direction.
+	Jitter float64
+
+	// RetryableRPCCodes lists all CS3 status codes (as returned by the gateway) that are considered transient.
+	RetryableRPCCodes []rpc.Code
+	// RetryableGRPCCodes lists all gRPC error codes that are considered transient.
+	RetryableGRPCCodes []codes.Code
+	// RetryableHTTPCodes lists all HTTP status codes that are considered transient.
+	RetryableHTTPCodes []int
+
+	onRetry func()
+}
+
+type permanentError struct {
+	err error
+}
+
+func (err *permanentError) Error() string {
+	return err.err.Error()
+}
+
+func (err *permanentError) Unwrap() error {
+	return err.err
+}
+
+// Permanent marks the given error as non-transient, so that the operation returning it will not be retried.
+// This is useful if an operation consists of several steps, some of which already retry on their own.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+var idempotentRPCMethods = []string{
+	"/cs3.gateway.v1beta1.GatewayAPI/Stat",
+	"/cs3.gateway.v1beta1.GatewayAPI/ListContainer",
+	"/cs3.gateway.v1beta1.GatewayAPI/InitiateFileDownload",
+}
+
+// Backoff returns the time to wait after the given (1-based) attempt has failed.
+func (policy *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(policy.InitialBackoff) * math.Pow(policy.Multiplier, float64(attempt-1))
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+
+	if policy.Jitter > 0 {
+		backoff += backoff * policy.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(backoff)
+}
+
+// IsRetryable checks whether the given error is a transient one which justifies another attempt.
+func (policy *RetryPolicy) IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var permErr *permanentError
+	if errors.As(err, &permErr) {
+		return false
+	}
+
+	var rpcErr *net.RPCError
+	if errors.As(err, &rpcErr) {
+		return policy.isRetryableRPCCode(rpcErr.Code)
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		for _, code := range policy.RetryableGRPCCodes {
+			if grpcErr.GRPCStatus().Code() == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	var httpErr *net.HTTPError
+	if errors.As(err, &httpErr) {
+		for _, code := range policy.RetryableHTTPCodes {
+			if httpErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Network errors (like refused or reset connections) are always considered transient
+	var netErr stdnet.Error
+	return errors.As(err, &netErr)
+}
+
+func (policy *RetryPolicy) isRetryableRPCCode(code rpc.Code) bool {
+	for _, retryableCode := range policy.RetryableRPCCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Retry runs the given operation until it succeeds, fails with a non-transient error or the maximum number of attempts has been reached.
+// The operation receives the current (1-based) attempt number; the last error is returned if all attempts failed.
+func (policy *RetryPolicy) Retry(ctx context.Context, operation func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := operation(attempt)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.IsRetryable(err) {
+			// Wrapped permanent errors keep their context, as the marker is transparent to errors.Is and errors.As anyway
+			var permErr *permanentError
+			if errors.As(err, &permErr) && err == error(permErr) {
+				return permErr.err
+			}
+			return err
+		}
+
+		if policy.onRetry != nil {
+			policy.onRetry()
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+
+		case <-timer.C:
+		}
+	}
+}
+
+func (policy *RetryPolicy) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	// Only idempotent calls may safely be repeated
+	if common.FindString(idempotentRPCMethods, method) == -1 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	err := policy.Retry(ctx, func(attempt int) error {
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+
+		// The gateway reports most failures through the status of the reply
+		if res, ok := reply.(interface{ GetStatus() *rpc.Status }); ok {
+			if status := res.GetStatus(); status != nil && status.Code != rpc.Code_CODE_OK {
+				return net.NewRPCError(method, status)
+			}
+		}
+		return nil
+	})
+
+	// A failed status is still part of the reply, so it is up to the caller to handle it
+	var rpcErr *net.RPCError
+	if errors.As(err, &rpcErr) {
+		return nil
+	}
+	return err
+}
+
+// DefaultRetryPolicy returns the retry policy used if none has been specified.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:        3,
+		InitialBackoff:     time.Duration(500 * int64(time.Millisecond)),
+		MaxBackoff:         time.Duration(30 * int64(time.Second)),
+		Multiplier:         2.0,
+		Jitter:             0.2,
+		RetryableRPCCodes:  []rpc.Code{rpc.Code_CODE_UNAVAILABLE, rpc.Code_CODE_ABORTED, rpc.Code_CODE_DEADLINE_EXCEEDED},
+		RetryableGRPCCodes: []codes.Code{codes.Unavailable, codes.Aborted},
+		RetryableHTTPCodes: []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
@@ -27,59 +27,171 @@ package reva
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	registry "github.com/cs3org/go-cs3apis/cs3/auth/registry/v1beta1"
 	gateway "github.com/cs3org/go-cs3apis/cs3/gateway/v1beta1"
+	userpb "github.com/cs3org/go-cs3apis/cs3/identity/user/v1beta1"
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/Daniel-WWU-IT/libreva/internal/common"
 	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
 )
 
+const (
+	authenticateMethod      = "/cs3.gateway.v1beta1.GatewayAPI/Authenticate"
+	listAuthProvidersMethod = "/cs3.gateway.v1beta1.GatewayAPI/ListAuthProviders"
+)
+
 // Session stores information about a Reva session.
 // It is also responsible for managing the Reva gateway client.
 type Session struct {
-	ctx    context.Context
-	client gateway.GatewayAPIClient
+	parentCtx context.Context
+	client    gateway.GatewayAPIClient
+	host      string
+
+	// The token and the context carrying it are replaced when logging in again, which might happen concurrently to other calls
+	tokenMutex sync.RWMutex
+	ctx        context.Context
+	token      string
+
+	// The credential provider is remembered, so that the session can log in again once its token has expired
+	credentials  CredentialProvider
+	loginMethod  string
+	reloginMutex sync.Mutex
+
+	transferConfig TransferConfig
+	httpClient     *http.Client
+
+	retryPolicy RetryPolicy
 
-	token string
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+	httpMiddleware     []HTTPMiddleware
+
+	logger Logger
+
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+
+	metrics MetricsCollector
+
+	profile *Profile
 }
 
-func (session *Session) initSession(ctx context.Context) error {
+func (session *Session) initSession(ctx context.Context, opts []SessionOption) error {
+	session.parentCtx = ctx
 	session.ctx = ctx
+	session.transferConfig = DefaultTransferConfig()
+	session.retryPolicy = DefaultRetryPolicy()
+	session.logger = newRedactingLogger(nil)
+	session.tracerProvider = defaultTracerProvider()
+	session.propagator = defaultPropagator()
+	session.metrics = &nopMetricsCollector{}
+
+	for _, opt := range opts {
+		opt(session)
+	}
+
+	session.retryPolicy.onRetry = session.metrics.ObserveRetry
+	session.initHTTPClient()
 
 	return nil
 }
 
+func (session *Session) initHTTPClient() {
+	// All data transfers share a single HTTP client (and thus its connection pool); tracing is done closest to the actual transport
+	middleware := append([]HTTPMiddleware{}, session.httpMiddleware...)
+	middleware = append(middleware, session.tracingMiddleware)
+	session.httpClient = session.transferConfig.newHTTPClient(middleware)
+}
+
 // Initiate initiates the session by creating a connection to the host and preparing the gateway client.
 func (session *Session) Initiate(host string, insecure bool) error {
-	conn, err := session.getConnection(host, insecure)
+	if insecure {
+		return session.initiate(host, nil)
+	}
+	return session.InitiateWithTLS(host, &tls.Config{InsecureSkipVerify: false})
+}
+
+// InitiateWithTLS initiates the session like Initiate, but uses the given TLS configuration (e.g., to trust a custom CA).
+func (session *Session) InitiateWithTLS(host string, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	return session.initiate(host, tlsConfig)
+}
+
+func (session *Session) initiate(host string, tlsConfig *tls.Config) error {
+	conn, err := session.getConnection(host, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("unable to establish a gRPC connection to '%v': %v", host, err)
 	}
 	session.client = gateway.NewGatewayAPIClient(conn)
+	session.host = host
+
+	// Data transfers use the same TLS configuration as the gateway connection (like a custom CA), unless one has been set explicitly
+	if tlsConfig != nil && session.transferConfig.TLSConfig == nil {
+		session.transferConfig.TLSConfig = tlsConfig
+		session.initHTTPClient()
+	}
 
 	return nil
 }
 
-func (session *Session) getConnection(host string, insecure bool) (*grpc.ClientConn, error) {
-	if insecure {
-		return grpc.Dial(host, grpc.WithInsecure())
+// getConnection dials the host; without a TLS configuration, an insecure connection is used.
+func (session *Session) getConnection(host string, tlsConfig *tls.Config) (*grpc.ClientConn, error) {
+	// The caller's interceptors come first, so they see each call only once; idempotent calls are then automatically retried on transient errors
+	unaryInterceptors := append([]grpc.UnaryClientInterceptor{}, session.unaryInterceptors...)
+	unaryInterceptors = append(unaryInterceptors, session.tracingInterceptor, session.reloginInterceptor, session.retryPolicy.unaryInterceptor, session.metricsInterceptor, session.loggingInterceptor)
+
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(session.streamInterceptors...),
+	}
+
+	if tlsConfig == nil {
+		opts = append(opts, grpc.WithInsecure())
 	} else {
-		tlsconf := &tls.Config{InsecureSkipVerify: false}
-		creds := credentials.NewTLS(tlsconf)
-		return grpc.Dial(host, grpc.WithTransportCredentials(creds))
+		creds := credentials.NewTLS(tlsConfig)
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	}
+
+	return grpc.Dial(host, opts...)
+}
+
+func (session *Session) loggingInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	keysAndValues := []interface{}{"method", method, "latency", time.Since(start)}
+	if err != nil {
+		keysAndValues = append(keysAndValues, "error", err)
+	} else if res, ok := reply.(interface{ GetStatus() *rpc.Status }); ok && res.GetStatus() != nil {
+		keysAndValues = append(keysAndValues, "code", res.GetStatus().Code)
 	}
+	session.logger.Log(LogLevelDebug, "gRPC call finished", keysAndValues...)
+
+	return err
 }
 
 // GetLoginMethods returns a list of all available login methods supported by the Reva instance.
 func (session *Session) GetLoginMethods() ([]string, error) {
 	req := &registry.ListAuthProvidersRequest{}
-	res, err := session.client.ListAuthProviders(session.ctx, req)
+	res, err := session.client.ListAuthProviders(session.Context(), req)
 	if err := net.CheckRPCInvocation("listing authorization providers", res, err); err != nil {
 		return []string{}, err
 	}
@@ -98,7 +210,7 @@ func (session *Session) Login(method string, username string, password string) e
 		ClientId:     username,
 		ClientSecret: password,
 	}
-	res, err := session.client.Authenticate(session.ctx, req)
+	res, err := session.client.Authenticate(session.Context(), req)
 	if err := net.CheckRPCInvocation("authenticating", res, err); err != nil {
 		return err
 	}
@@ -106,15 +218,133 @@ func (session *Session) Login(method string, username string, password string) e
 	if res.Token == "" {
 		return fmt.Errorf("invalid token received: %q", res.Token)
 	}
-	session.token = res.Token
+	session.setToken(res.Token)
+
+	session.logger.Log(LogLevelDebug, "logged into Reva", "method", method, "user", username)
+
+	return nil
+}
+
+// LoginWithToken uses a token obtained by a previous login (e.g., one stored by a command-line client) for the session.
+// The token isn't verified; use WhoAmI to check whether it is (still) valid.
+func (session *Session) LoginWithToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("no token provided")
+	}
+	session.setToken(token)
+	return nil
+}
+
+// WhoAmI returns the user the session is logged in as.
+func (session *Session) WhoAmI() (*userpb.User, error) {
+	req := &gateway.WhoAmIRequest{Token: session.Token()}
+	res, err := session.client.WhoAmI(session.Context(), req)
+	if err := net.CheckRPCInvocation("querying the current user", res, err); err != nil {
+		return nil, err
+	}
+	return res.User, nil
+}
 
-	// Now that we have a valid token, we can append this to our context
-	session.ctx = context.WithValue(session.ctx, net.AccessTokenIndex, session.token)
+func (session *Session) setToken(token string) {
+	session.tokenMutex.Lock()
+	defer session.tokenMutex.Unlock()
+
+	session.token = token
+
+	// The token is attached to a fresh context, so that logging in again doesn't stack old tokens
+	session.ctx = context.WithValue(session.parentCtx, net.AccessTokenIndex, session.token)
 	session.ctx = metadata.AppendToOutgoingContext(session.ctx, net.AccessTokenName, session.token)
+}
 
+// LoginWithProvider logs into Reva using the specified method and the credentials supplied by the provider.
+// The provider is remembered, so that the session logs in again automatically once its token has been rejected.
+func (session *Session) LoginWithProvider(method string, provider CredentialProvider) error {
+	if err := session.loginWithProvider(method, provider); err != nil {
+		return err
+	}
+	session.credentials = provider
+	session.loginMethod = method
 	return nil
 }
 
+func (session *Session) loginWithProvider(method string, provider CredentialProvider) error {
+	creds, err := provider.Credentials(session.parentCtx, session.host)
+	if err != nil {
+		return fmt.Errorf("unable to get the credentials for '%v': %w", session.host, err)
+	}
+
+	if strings.EqualFold(method, "basic") {
+		err = session.BasicLogin(creds.User, creds.Password)
+	} else {
+		err = session.Login(method, creds.User, creds.Password)
+	}
+
+	// Providers may want to store working credentials or forget rejected ones; failing to do so doesn't affect the login
+	if feedback, ok := provider.(CredentialFeedback); ok {
+		var feedbackErr error
+		var rpcErr *net.RPCError
+		if err == nil {
+			feedbackErr = feedback.Approve(session.parentCtx, session.host, creds)
+		} else if errors.As(err, &rpcErr) && rpcErr.Code == rpc.Code_CODE_UNAUTHENTICATED {
+			feedbackErr = feedback.Reject(session.parentCtx, session.host, creds)
+		}
+		if feedbackErr != nil {
+			session.logger.Log(LogLevelWarn, "passing feedback to the credential provider failed", "error", feedbackErr)
+		}
+	}
+	return err
+}
+
+// Relogin logs into Reva again using the credential provider passed to LoginWithProvider, e.g., after the token has expired.
+func (session *Session) Relogin() error {
+	if session.credentials == nil {
+		return fmt.Errorf("the session wasn't logged in using a credential provider")
+	}
+	return session.loginWithProvider(session.loginMethod, session.credentials)
+}
+
+// reloginInterceptor logs in again and repeats a call if it was rejected as unauthenticated, which usually means that the token has expired.
+func (session *Session) reloginInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if session.credentials == nil || method == authenticateMethod || method == listAuthProvidersMethod || !isUnauthenticated(reply, err) {
+		return err
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	staleToken := ""
+	if values := md.Get(net.AccessTokenName); len(values) > 0 {
+		staleToken = values[len(values)-1]
+	}
+
+	// Concurrent calls failing at the same time only lead to a single login
+	session.reloginMutex.Lock()
+	if session.Token() == staleToken {
+		if loginErr := session.Relogin(); loginErr != nil {
+			session.reloginMutex.Unlock()
+			session.logger.Log(LogLevelWarn, "logging in again failed", "error", loginErr)
+			return err
+		}
+		session.logger.Log(LogLevelDebug, "logged in again after the token was rejected", "method", method)
+	}
+	token := session.Token()
+	session.reloginMutex.Unlock()
+
+	md = md.Copy()
+	md.Set(net.AccessTokenName, token)
+	ctx = metadata.NewOutgoingContext(context.WithValue(ctx, net.AccessTokenIndex, token), md)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func isUnauthenticated(reply interface{}, err error) bool {
+	if err != nil {
+		return status.Code(err) == codes.Unauthenticated
+	}
+	if res, ok := reply.(interface{ GetStatus() *rpc.Status }); ok {
+		return res.GetStatus().GetCode() == rpc.Code_CODE_UNAUTHENTICATED
+	}
+	return false
+}
+
 // BasicLogin tries to log into Reva using basic authentication.
 // Before the actual login attempt, the method verifies that the Reva instance does support the "basic" login method.
 func (session *Session) BasicLogin(username string, password string) error {
@@ -133,7 +363,42 @@ func (session *Session) BasicLogin(username string, password string) error {
 
 // NewHTTPRequest returns an HTTP request instance.
 func (session *Session) NewHTTPRequest(endpoint string, method string, transportToken string, data io.Reader) (*httpRequest, error) {
-	return newHTTPRequest(session, endpoint, method, transportToken, data)
+	return newHTTPRequest(session.Context(), session, endpoint, method, transportToken, data)
+}
+
+// NewHTTPRequestWithContext returns an HTTP request instance that uses the provided context instead of the session context.
+func (session *Session) NewHTTPRequestWithContext(ctx context.Context, endpoint string, method string, transportToken string, data io.Reader) (*httpRequest, error) {
+	return newHTTPRequest(ctx, session, endpoint, method, transportToken, data)
+}
+
+// HTTPClient returns the HTTP client used for all data transfers.
+func (session *Session) HTTPClient() *http.Client {
+	return session.httpClient
+}
+
+// TransferConfig returns the configuration of the data transfers.
+func (session *Session) TransferConfig() TransferConfig {
+	return session.transferConfig
+}
+
+// Logger returns the logger of the session.
+func (session *Session) Logger() Logger {
+	return session.logger
+}
+
+// RetryPolicy returns a copy of the policy used to retry operations that failed due to transient errors; the policy
+// can only be set using WithRetryPolicy.
+func (session *Session) RetryPolicy() RetryPolicy {
+	policy := session.retryPolicy
+	policy.RetryableRPCCodes = append([]rpc.Code(nil), policy.RetryableRPCCodes...)
+	policy.RetryableGRPCCodes = append([]codes.Code(nil), policy.RetryableGRPCCodes...)
+	policy.RetryableHTTPCodes = append([]int(nil), policy.RetryableHTTPCodes...)
+	return policy
+}
+
+// Metrics returns the collector that receives measurements about all gRPC calls and data transfers.
+func (session *Session) Metrics() MetricsCollector {
+	return session.metrics
 }
 
 // Client gets the gateway client instance.
@@ -143,36 +408,46 @@ func (session *Session) Client() gateway.GatewayAPIClient {
 
 // Context returns the session context.
 func (session *Session) Context() context.Context {
+	session.tokenMutex.RLock()
+	defer session.tokenMutex.RUnlock()
 	return session.ctx
 }
 
 // Token returns the session token.
 func (session *Session) Token() string {
+	session.tokenMutex.RLock()
+	defer session.tokenMutex.RUnlock()
 	return session.token
 }
 
+// Profile returns the profile the session was created from; it is nil if the session wasn't created from a profile.
+func (session *Session) Profile() *Profile {
+	return session.profile
+}
+
 // IsValid checks whether the session has been initialized and fully established.
 func (session *Session) IsValid() bool {
-	return session.client != nil && session.ctx != nil && session.token != ""
+	return session.client != nil && session.Context() != nil && session.Token() != ""
 }
 
 // NewSessionWithContext creates a new Reva session using the provided context.
-func NewSessionWithContext(ctx context.Context) (*Session, error) {
+// The session can be further configured by passing any number of options.
+func NewSessionWithContext(ctx context.Context, opts ...SessionOption) (*Session, error) {
 	session := &Session{}
-	if err := session.initSession(ctx); err != nil {
+	if err := session.initSession(ctx, opts); err != nil {
 		return nil, fmt.Errorf("unable to initialize the session: %v", err)
 	}
 	return session, nil
 }
 
 // NewSession creates a new Reva session using a default background context.
-func NewSession() (*Session, error) {
-	return NewSessionWithContext(context.Background())
+func NewSession(opts ...SessionOption) (*Session, error) {
+	return NewSessionWithContext(context.Background(), opts...)
 }
 
 // MustNewSession creates a new session and panics on failure.
-func MustNewSession() *Session {
-	session, err := NewSession()
+func MustNewSession(opts ...SessionOption) *Session {
+	session, err := NewSession(opts...)
 	if err != nil {
 		panic(err)
 	}
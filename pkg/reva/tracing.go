@@ -0,0 +1,171 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+)
+
+// TracerName is the name of the tracer used to create all spans of the library.
+const TracerName = net.TracerName
+
+type metadataCarrier metadata.MD
+
+func (carrier metadataCarrier) Get(key string) string {
+	if values := metadata.MD(carrier).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (carrier metadataCarrier) Set(key string, value string) {
+	metadata.MD(carrier).Set(key, value)
+}
+
+func (carrier metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(carrier))
+	for key := range carrier {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+type tracingTransport struct {
+	session   *Session
+	transport http.RoundTripper
+}
+
+// RoundTrip performs the request within a new client span and propagates the trace context via the request headers.
+func (transport *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := transport.session.Tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.URL.Redacted()),
+		),
+	)
+
+	req = req.Clone(ctx)
+	transport.session.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := transport.transport.RoundTrip(req)
+	if err != nil {
+		RecordSpanError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, res.Status)
+	}
+
+	// The transfer isn't finished before the body has been read, so the span is ended once the body is closed
+	res.Body = &spanBody{ReadCloser: res.Body, span: span}
+	return res, nil
+}
+
+type spanBody struct {
+	io.ReadCloser
+
+	span trace.Span
+	once sync.Once
+}
+
+// Close closes the body and ends the span of the request.
+func (body *spanBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() { body.span.End() })
+	return err
+}
+
+func (session *Session) tracingMiddleware(transport http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{
+		session:   session,
+		transport: transport,
+	}
+}
+
+func (session *Session) tracingInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, span := session.Tracer().Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+		),
+	)
+	defer span.End()
+
+	// Propagate the trace context to the gateway through the outgoing metadata
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	session.propagator.Inject(ctx, metadataCarrier(md))
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if err != nil {
+		RecordSpanError(span, err)
+	} else if res, ok := reply.(interface{ GetStatus() *rpc.Status }); ok && res.GetStatus() != nil {
+		status := res.GetStatus()
+		span.SetAttributes(attribute.String("rpc.cs3.code", status.Code.String()))
+		if status.Code != rpc.Code_CODE_OK {
+			span.SetStatus(codes.Error, status.Message)
+		}
+	}
+	return err
+}
+
+// Tracer returns the tracer used to create spans for all operations performed through the session.
+func (session *Session) Tracer() trace.Tracer {
+	return session.tracerProvider.Tracer(TracerName)
+}
+
+// RecordSpanError records the given error in the span and marks the span as failed; nil errors are ignored.
+func RecordSpanError(span trace.Span, err error) {
+	net.RecordSpanError(span, err)
+}
+
+func defaultTracerProvider() trace.TracerProvider {
+	return otel.GetTracerProvider()
+}
+
+func defaultPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
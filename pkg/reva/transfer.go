@@ -0,0 +1,108 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package reva
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+)
+
+// TransferConfig holds the settings of the HTTP transport used for all data transfers.
+// Downloads, PUT uploads, TUS and WebDAV all share the same transport and thus the same connection pool.
+type TransferConfig struct {
+	// Transport specifies a custom round tripper to use; if set, the connection pooling, proxy and timeout settings below (except Timeout) are ignored.
+	Transport http.RoundTripper
+
+	// MaxIdleConns controls the maximum number of idle connections across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost controls the maximum number of idle connections to keep per host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the total number of connections per host; zero means no limit.
+	MaxConnsPerHost int
+
+	// Proxy returns the proxy to use for a given request; if nil, the proxy settings are taken from the environment.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Timeout is the time limit for a single request, including reading the response body.
+	Timeout time.Duration
+	// IdleTimeout is the maximum amount of time an idle connection remains open.
+	IdleTimeout time.Duration
+	// ReadTimeout is the amount of time to wait for the response headers after a request has been sent.
+	ReadTimeout time.Duration
+
+	// UserAgent is sent along with every request; if empty, no User-Agent header is set explicitly.
+	UserAgent string
+
+	// TLSConfig secures HTTPS transfers; if nil, the TLS configuration of the gateway connection is used (ignored if Transport is set).
+	TLSConfig *tls.Config
+}
+
+func (config *TransferConfig) newHTTPClient(middleware []HTTPMiddleware) *http.Client {
+	transport := config.Transport
+	if transport == nil {
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.MaxIdleConns = config.MaxIdleConns
+		httpTransport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+		httpTransport.MaxConnsPerHost = config.MaxConnsPerHost
+		httpTransport.IdleConnTimeout = config.IdleTimeout
+		httpTransport.ResponseHeaderTimeout = config.ReadTimeout
+		if config.Proxy != nil {
+			httpTransport.Proxy = config.Proxy
+		}
+		if config.TLSConfig != nil {
+			httpTransport.TLSClientConfig = config.TLSConfig.Clone()
+		}
+		transport = httpTransport
+	}
+
+	if config.UserAgent != "" {
+		transport = net.NewHeaderTransport(transport, map[string]string{"User-Agent": config.UserAgent})
+	}
+
+	// Apply the middleware in reverse order, so that the first one ends up being the outermost
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+	}
+}
+
+// DefaultTransferConfig returns the transfer configuration used if none has been specified.
+func DefaultTransferConfig() TransferConfig {
+	return TransferConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		Timeout:             time.Duration(24 * int64(time.Hour)),
+		IdleTimeout:         time.Duration(90 * int64(time.Second)),
+		UserAgent:           "libreva",
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revafs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+// file is an open Reva file; its data is streamed from Reva, starting with the first read.
+type file struct {
+	fsys *FS
+	name string
+	info *storage.ResourceInfo
+
+	stream *io.PipeReader
+	offset int64
+	closed bool
+}
+
+var (
+	_ fs.File   = (*file)(nil)
+	_ io.Seeker = (*file)(nil)
+)
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return NewFileInfo(f.info), nil
+}
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.offset >= int64(f.info.Size) {
+		return 0, io.EOF
+	}
+
+	if f.stream == nil {
+		if err := f.openStream(); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	}
+
+	n, err := f.stream.Read(b)
+	f.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = f.fsys.pathError("read", f.name, err)
+	}
+	return n, err
+}
+
+// Seek changes the offset of the next read; as Reva downloads can't start at arbitrary offsets, seeking restarts
+// the download and skips the data before the offset. Seeking without reading (e.g., to determine the size) is cheap.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(f.info.Size)
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != f.offset {
+		f.closeStream()
+		f.offset = offset
+	}
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closeStream()
+	f.closed = true
+	return nil
+}
+
+// openStream starts downloading the file in the background, skipping everything before the current offset.
+func (f *file) openStream() error {
+	downloadAct, err := action.NewDownloadAction(f.fsys.session)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	offset := f.offset
+	go func() {
+		var w io.Writer = writer
+		if offset > 0 {
+			w = &skippingWriter{writer: writer, skip: offset}
+		}
+		_, err := downloadAct.DownloadTo(f.info, w)
+		writer.CloseWithError(err)
+	}()
+	f.stream = reader
+	return nil
+}
+
+func (f *file) closeStream() {
+	if f.stream != nil {
+		// Closing the reading end aborts the download
+		f.stream.CloseWithError(fmt.Errorf("the file has been closed"))
+		f.stream = nil
+	}
+}
+
+// skippingWriter discards the first bytes written to it.
+type skippingWriter struct {
+	writer io.Writer
+	skip   int64
+}
+
+func (w *skippingWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if w.skip > 0 {
+		if int64(n) <= w.skip {
+			w.skip -= int64(n)
+			return n, nil
+		}
+		b = b[w.skip:]
+		w.skip = 0
+	}
+	if _, err := w.writer.Write(b); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// dir is an open Reva directory; its entries are listed on the first call to ReadDir.
+type dir struct {
+	fsys *FS
+	name string
+	info *storage.ResourceInfo
+
+	entries []fs.DirEntry
+	listed  bool
+	closed  bool
+}
+
+var _ fs.ReadDirFile = (*dir)(nil)
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return NewFileInfo(d.info), nil
+}
+
+func (d *dir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if !d.listed {
+		entries, err := d.fsys.readDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	// Behave like os.File.ReadDir: n <= 0 returns all remaining entries, otherwise io.EOF signals the end
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *dir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revafs
+
+import (
+	"io/fs"
+	p "path"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// FileInfo describes a Reva resource; it implements fs.FileInfo.
+type FileInfo struct {
+	info *storage.ResourceInfo
+}
+
+// Name returns the base name of the resource.
+func (fi *FileInfo) Name() string {
+	return p.Base(fi.info.Path)
+}
+
+// Size returns the size of the resource in bytes.
+func (fi *FileInfo) Size() int64 {
+	return int64(fi.info.Size)
+}
+
+// Mode returns the file mode of the resource (see ModeFromResourceInfo).
+func (fi *FileInfo) Mode() fs.FileMode {
+	return ModeFromResourceInfo(fi.info)
+}
+
+// ModTime returns the modification time of the resource.
+func (fi *FileInfo) ModTime() time.Time {
+	if fi.info.Mtime == nil {
+		return time.Time{}
+	}
+	return time.Unix(int64(fi.info.Mtime.Seconds), int64(fi.info.Mtime.Nanos))
+}
+
+// IsDir returns whether the resource is a directory.
+func (fi *FileInfo) IsDir() bool {
+	return fi.info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER
+}
+
+// Sys returns the underlying *storage.ResourceInfo.
+func (fi *FileInfo) Sys() interface{} {
+	return fi.info
+}
+
+// ModeFromResourceInfo derives the file mode of a resource from its type and permission set. As the permissions apply to the
+// current user, only the owner bits are set: read if the resource can be downloaded (files) or listed (directories), write if
+// it can be uploaded to (files) or if entries can be created in it (directories), and execute if a directory can be listed.
+// Resources without a permission set are treated as fully accessible.
+func ModeFromResourceInfo(info *storage.ResourceInfo) fs.FileMode {
+	var mode fs.FileMode
+	isDir := false
+	switch info.Type {
+	case storage.ResourceType_RESOURCE_TYPE_CONTAINER:
+		mode, isDir = fs.ModeDir, true
+	case storage.ResourceType_RESOURCE_TYPE_SYMLINK:
+		mode = fs.ModeSymlink
+	case storage.ResourceType_RESOURCE_TYPE_REFERENCE:
+		mode = fs.ModeIrregular
+	}
+
+	perms := info.PermissionSet
+	if perms == nil {
+		if isDir {
+			return mode | 0700
+		}
+		return mode | 0600
+	}
+
+	if isDir {
+		if perms.ListContainer {
+			mode |= 0500
+		}
+		if perms.CreateContainer || perms.InitiateFileUpload {
+			mode |= 0200
+		}
+	} else {
+		if perms.InitiateFileDownload {
+			mode |= 0400
+		}
+		if perms.InitiateFileUpload {
+			mode |= 0200
+		}
+	}
+	return mode
+}
+
+// NewFileInfo wraps a resource information object as an fs.FileInfo.
+func NewFileInfo(info *storage.ResourceInfo) *FileInfo {
+	return &FileInfo{info: info}
+}
@@ -0,0 +1,183 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package revafs exposes Reva resources through the io/fs interfaces, so that standard library tooling
+// like fs.WalkDir, template.ParseFS or http.FileServer can be used with Reva data.
+package revafs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	p "path"
+	"sort"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// FS is a read-only file system backed by a Reva directory; it implements fs.FS, fs.ReadDirFS and fs.StatFS.
+// Files are streamed from Reva while being read.
+type FS struct {
+	session *reva.Session
+	root    string
+}
+
+var (
+	_ fs.FS        = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// Open opens the named file or directory.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return &dir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &file{fsys: fsys, name: name, info: info}, nil
+}
+
+// Stat returns information about the named file or directory.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fsys.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info), nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by file name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return fsys.readDir(name)
+}
+
+// Sub returns a file system rooted at the given subdirectory.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	info, err := fsys.stat("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: errors.New("not a directory")}
+	}
+	return &FS{session: fsys.session, root: fsys.remotePath(dir)}, nil
+}
+
+// Root returns the Reva path of the root directory of the file system.
+func (fsys *FS) Root() string {
+	return fsys.root
+}
+
+func (fsys *FS) stat(op string, name string) (*storage.ResourceInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := action.MustNewFileOperationsAction(fsys.session).Stat(fsys.remotePath(name))
+	if err != nil {
+		return nil, fsys.pathError(op, name, err)
+	}
+	return info, nil
+}
+
+func (fsys *FS) readDir(name string) ([]fs.DirEntry, error) {
+	infos, err := action.MustNewEnumFilesAction(fsys.session).ListAll(fsys.remotePath(name), false)
+	if err != nil {
+		return nil, fsys.pathError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(NewFileInfo(info)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (fsys *FS) remotePath(name string) string {
+	if name == "." {
+		return fsys.root
+	}
+	return p.Join(fsys.root, name)
+}
+
+// pathError wraps the error of a Reva call in an fs.PathError, mapping it to the corresponding fs error (see translateError).
+func (fsys *FS) pathError(op string, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: fsys.translateError(op, name, err)}
+}
+
+// translateError maps the errors of Reva calls to the corresponding fs errors. The fs errors are returned as-is (instead of
+// wrapping the original error), as os.IsNotExist and friends, which are still widely used, only look into fs.PathError and
+// os.LinkError; the original error is logged instead, so that the message of Reva doesn't get lost.
+func (fsys *FS) translateError(op string, name string, err error) error {
+	var rpcErr *net.RPCError
+	if errors.As(err, &rpcErr) {
+		var fsErr error
+		switch rpcErr.Code {
+		case rpc.Code_CODE_NOT_FOUND:
+			fsErr = fs.ErrNotExist
+		case rpc.Code_CODE_ALREADY_EXISTS:
+			fsErr = fs.ErrExist
+		case rpc.Code_CODE_PERMISSION_DENIED:
+			fsErr = fs.ErrPermission
+		default:
+			return err
+		}
+		fsys.session.Logger().Log(reva.LogLevelDebug, "file system operation failed", "op", op, "path", name, "error", err)
+		return fsErr
+	}
+	return err
+}
+
+// New creates a file system rooted at the given Reva directory.
+func New(session *reva.Session, root string) (*FS, error) {
+	if !session.IsValid() {
+		return nil, fmt.Errorf("no valid session provided")
+	}
+	if root == "" {
+		return nil, fmt.Errorf("no root directory provided")
+	}
+	return &FS{session: session, root: p.Clean(root)}, nil
+}
+
+// MustNew creates a new file system and panics on failure.
+func MustNew(session *reva.Session, root string) *FS {
+	fsys, err := New(session, root)
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
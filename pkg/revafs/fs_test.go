@@ -0,0 +1,312 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revafs_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/spf13/afero"
+	"golang.org/x/net/webdav"
+
+	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
+	"github.com/Daniel-WWU-IT/libreva/pkg/revafs"
+)
+
+func TestFS(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+
+	files := map[string]string{
+		"/home/fs/hello.txt":           "HELLO FS WORLD!\n",
+		"/home/fs/empty.txt":           "",
+		"/home/fs/sub/nested.txt":      "HELLO NESTED WORLD!\n",
+		"/home/fs/sub/deeper/deep.txt": "HELLO DEEP WORLD!\n",
+	}
+	for path, data := range files {
+		gw.WriteFile(path, []byte(data), time.Now())
+	}
+
+	fsys := revafs.MustNew(session, "/home/fs")
+
+	if err := fstest.TestFS(fsys, "hello.txt", "empty.txt", "sub/nested.txt", "sub/deeper/deep.txt"); err != nil {
+		t.Errorf(testintl.FormatTestError("fstest.TestFS", err))
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"hello.txt", nil},
+		{"sub", nil},
+		{"missing.txt", fs.ErrNotExist},
+		{"/home/fs/hello.txt", fs.ErrInvalid},
+		{"sub/../hello.txt", fs.ErrInvalid},
+	}
+
+	for _, test := range tests {
+		if _, err := fsys.Stat(test.name); !errors.Is(err, test.err) {
+			t.Errorf(testintl.FormatTestResult("FS.Stat", test.err, err, test.name))
+		}
+	}
+}
+
+func TestFileSeek(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	gw.WriteFile("/home/seek.txt", []byte("0123456789"), time.Now())
+
+	fsys := revafs.MustNew(session, "/home")
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   string
+	}{
+		{0, io.SeekStart, "0123456789"},
+		{4, io.SeekStart, "456789"},
+		{-3, io.SeekEnd, "789"},
+		{10, io.SeekStart, ""},
+	}
+
+	for _, test := range tests {
+		f, err := fsys.Open("seek.txt")
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("FS.Open", err, "seek.txt"))
+		}
+
+		seeker, ok := f.(io.Seeker)
+		if !ok {
+			t.Fatalf(testintl.FormatTestError("FS.Open", fmt.Errorf("file is not seekable")))
+		}
+		if _, err := seeker.Seek(test.offset, test.whence); err != nil {
+			t.Errorf(testintl.FormatTestError("File.Seek", err, test.offset, test.whence))
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Errorf(testintl.FormatTestError("File.Read", err))
+		} else if string(data) != test.want {
+			t.Errorf(testintl.FormatTestResult("File.Read", test.want, string(data), test.offset, test.whence))
+		}
+		_ = f.Close()
+	}
+}
+
+func TestWritableFS(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	gw.WriteFile("/home/afero/existing.txt", []byte("HELLO"), time.Now())
+
+	// The same operations are performed on a local directory, which serves as the reference
+	localFs := afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	_ = afero.WriteFile(localFs, "/existing.txt", []byte("HELLO"), 0644)
+	revaFs := revafs.MustNewWritable(session, "/home/afero")
+
+	tests := []struct {
+		name string
+		op   func(afero.Fs) (string, error)
+	}{
+		{"mkdir", func(fsys afero.Fs) (string, error) { return "", fsys.Mkdir("/dir", 0755) }},
+		{"mkdir existing", func(fsys afero.Fs) (string, error) { return "", fsys.Mkdir("/dir", 0755) }},
+		{"mkdir without parent", func(fsys afero.Fs) (string, error) { return "", fsys.Mkdir("/a/b", 0755) }},
+		{"mkdir all", func(fsys afero.Fs) (string, error) { return "", fsys.MkdirAll("/a/b/c", 0755) }},
+		{"write", func(fsys afero.Fs) (string, error) {
+			return "", afero.WriteFile(fsys, "/dir/file.txt", []byte("HELLO WORLD!"), 0644)
+		}},
+		{"write without parent", func(fsys afero.Fs) (string, error) {
+			return "", afero.WriteFile(fsys, "/missing/file.txt", []byte("-"), 0644)
+		}},
+		{"read", func(fsys afero.Fs) (string, error) { return readString(fsys, "dir/file.txt") }},
+		{"append", func(fsys afero.Fs) (string, error) {
+			f, err := fsys.OpenFile("/existing.txt", os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return "", err
+			}
+			_, _ = f.WriteString(" APPENDED")
+			if err := f.Close(); err != nil {
+				return "", err
+			}
+			return readString(fsys, "/existing.txt")
+		}},
+		{"overwrite in place", func(fsys afero.Fs) (string, error) {
+			f, err := fsys.OpenFile("/existing.txt", os.O_RDWR, 0644)
+			if err != nil {
+				return "", err
+			}
+			_, _ = f.WriteAt([]byte("J"), 0)
+			if err := f.Close(); err != nil {
+				return "", err
+			}
+			return readString(fsys, "/existing.txt")
+		}},
+		{"exclusive create", func(fsys afero.Fs) (string, error) {
+			_, err := fsys.OpenFile("/existing.txt", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+			return "", err
+		}},
+		{"create empty", func(fsys afero.Fs) (string, error) {
+			f, err := fsys.Create("/empty.txt")
+			if err != nil {
+				return "", err
+			}
+			if err := f.Close(); err != nil {
+				return "", err
+			}
+			info, err := fsys.Stat("/empty.txt")
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprint(info.Name(), info.Size()), nil
+		}},
+		{"read at", func(fsys afero.Fs) (string, error) {
+			f, err := fsys.Open("/dir/file.txt")
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			b := make([]byte, 5)
+			_, err = f.ReadAt(b, 6)
+			return string(b), err
+		}},
+		{"write read-only", func(fsys afero.Fs) (string, error) {
+			f, err := fsys.Open("/dir/file.txt")
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			_, err = f.WriteString("-")
+			return "", err
+		}},
+		{"list", func(fsys afero.Fs) (string, error) {
+			names, err := afero.ReadDir(fsys, "/")
+			list := make([]string, 0, len(names))
+			for _, info := range names {
+				list = append(list, fmt.Sprint(info.Name(), info.IsDir()))
+			}
+			return strings.Join(list, ","), err
+		}},
+		{"rename", func(fsys afero.Fs) (string, error) {
+			if err := fsys.Rename("/dir/file.txt", "/a/moved.txt"); err != nil {
+				return "", err
+			}
+			return readString(fsys, "/a/moved.txt")
+		}},
+		{"rename replacing", func(fsys afero.Fs) (string, error) {
+			if err := fsys.Rename("/a/moved.txt", "/existing.txt"); err != nil {
+				return "", err
+			}
+			return readString(fsys, "/existing.txt")
+		}},
+		{"remove non-empty", func(fsys afero.Fs) (string, error) { return "", fsys.Remove("/a") }},
+		{"remove all", func(fsys afero.Fs) (string, error) { return "", fsys.RemoveAll("/a") }},
+		{"remove all missing", func(fsys afero.Fs) (string, error) { return "", fsys.RemoveAll("/a") }},
+		{"remove", func(fsys afero.Fs) (string, error) { return "", fsys.Remove("/dir") }},
+		{"stat removed", func(fsys afero.Fs) (string, error) {
+			_, err := fsys.Stat("/dir")
+			return fmt.Sprint(os.IsNotExist(err)), nil
+		}},
+	}
+
+	for _, test := range tests {
+		want, wantErr := test.op(localFs)
+		got, err := test.op(revaFs)
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf(testintl.FormatTestResult(test.name, wantErr, err))
+		} else if got != want {
+			t.Errorf(testintl.FormatTestResult(test.name, want, got))
+		}
+	}
+
+	// Errors must keep the path while still matching the standard errors
+	_, err := revaFs.Stat("/missing.txt")
+	var pathErr *fs.PathError
+	if !os.IsNotExist(err) || !errors.As(err, &pathErr) || pathErr.Path != "/missing.txt" {
+		t.Errorf(testintl.FormatTestResult("Stat", "not exist error for /missing.txt", err))
+	}
+}
+
+func readString(fsys afero.Fs, name string) (string, error) {
+	data, err := afero.ReadFile(fsys, name)
+	return string(data), err
+}
+
+func TestWebDAVFS(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	gw.WriteFile("/home/dav/existing.txt", []byte("EXISTING\n"), time.Now())
+
+	server := httptest.NewServer(&webdav.Handler{FileSystem: revafs.MustNewWebDAV(session, "/home/dav"), LockSystem: webdav.NewMemLS()})
+	defer server.Close()
+
+	tests := []struct {
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		status  int
+		output  string
+	}{
+		{"PROPFIND", "/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus, "/existing.txt"},
+		{"MKCOL", "/docs", nil, "", http.StatusCreated, ""},
+		{"MKCOL", "/docs", nil, "", http.StatusMethodNotAllowed, ""},
+		{"MKCOL", "/missing/docs", nil, "", http.StatusConflict, ""},
+		{"PUT", "/docs/hello.txt", nil, "HELLO WEBDAV WORLD!\n", http.StatusCreated, ""},
+		{"GET", "/docs/hello.txt", nil, "", http.StatusOK, "HELLO WEBDAV WORLD!\n"},
+		{"GET", "/docs/hello.txt", map[string]string{"Range": "bytes=6-11"}, "", http.StatusPartialContent, "WEBDAV"},
+		{"PROPFIND", "/docs/hello.txt", map[string]string{"Depth": "0"}, "", http.StatusMultiStatus, "<D:getcontentlength>20</D:getcontentlength>"},
+		{"MOVE", "/docs/hello.txt", map[string]string{"Destination": "/moved.txt"}, "", http.StatusCreated, ""},
+		{"GET", "/moved.txt", nil, "", http.StatusOK, "HELLO WEBDAV WORLD!\n"},
+		{"MOVE", "/moved.txt", map[string]string{"Destination": "/existing.txt", "Overwrite": "F"}, "", http.StatusPreconditionFailed, ""},
+		{"DELETE", "/docs", nil, "", http.StatusNoContent, ""},
+		{"GET", "/docs/hello.txt", nil, "", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		uploads := gw.Uploads()
+		req, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("http.Client.Do", err, test.method, test.path))
+		}
+		data, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf(testintl.FormatTestResult(test.method, test.status, res.StatusCode, test.path))
+		} else if !strings.Contains(string(data), test.output) {
+			t.Errorf(testintl.FormatTestResult(test.method, test.output, string(data), test.path))
+		}
+		if test.method == "PUT" && gw.Uploads()-uploads != 1 {
+			t.Errorf(testintl.FormatTestResult("Uploads", 1, gw.Uploads()-uploads, test.path))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revafs
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// WebDAVFS is a webdav.FileSystem backed by a Reva directory, so that Reva can be served through a webdav.Handler; it
+// is based on a WritableFS and shares its semantics. The contexts passed by the handler aren't used, as all operations
+// run in the context of the session.
+type WebDAVFS struct {
+	fsys *WritableFS
+}
+
+var (
+	_ webdav.FileSystem = (*WebDAVFS)(nil)
+	_ webdav.File       = (*writableFile)(nil)
+
+	_ webdav.ETager       = (*FileInfo)(nil)
+	_ webdav.ContentTyper = (*FileInfo)(nil)
+)
+
+// Mkdir creates the named directory.
+func (dfs *WebDAVFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return dfs.fsys.Mkdir(name, perm)
+}
+
+// OpenFile opens the named file or directory.
+func (dfs *WebDAVFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := dfs.fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f.(*writableFile), nil
+}
+
+// RemoveAll removes the named file or directory along with everything it contains.
+func (dfs *WebDAVFS) RemoveAll(ctx context.Context, name string) error {
+	return dfs.fsys.RemoveAll(name)
+}
+
+// Rename moves the old path to the new one.
+func (dfs *WebDAVFS) Rename(ctx context.Context, oldName, newName string) error {
+	return dfs.fsys.Rename(oldName, newName)
+}
+
+// Stat returns information about the named file or directory.
+func (dfs *WebDAVFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return dfs.fsys.Stat(name)
+}
+
+// ETag returns the ETag of the resource, so that the WebDAV handler doesn't need to make one up.
+func (fi *FileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.info.Etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	if strings.HasPrefix(fi.info.Etag, `"`) {
+		return fi.info.Etag, nil
+	}
+	return `"` + fi.info.Etag + `"`, nil
+}
+
+// ContentType returns the MIME type of the resource; if Reva doesn't know it, the WebDAV handler determines it itself.
+func (fi *FileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.info.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.info.MimeType, nil
+}
+
+// NewWebDAV creates a WebDAV file system rooted at the given Reva directory.
+func NewWebDAV(session *reva.Session, root string) (*WebDAVFS, error) {
+	fsys, err := NewWritable(session, root)
+	if err != nil {
+		return nil, err
+	}
+	return &WebDAVFS{fsys: fsys}, nil
+}
+
+// MustNewWebDAV creates a new WebDAV file system and panics on failure.
+func MustNewWebDAV(session *reva.Session, root string) *WebDAVFS {
+	dfs, err := NewWebDAV(session, root)
+	if err != nil {
+		panic(err)
+	}
+	return dfs
+}
@@ -0,0 +1,524 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revafs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	p "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	"github.com/spf13/afero"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+var (
+	errIsDirectory = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errUnsupported = errors.New("operation not supported")
+)
+
+// WritableFS is a writable file system backed by a Reva directory; it implements afero.Fs, so that code written against
+// afero can switch between the local disk and Reva without any changes. Paths are interpreted relative to the root
+// directory, regardless of whether they start with a slash.
+//
+// Files opened for writing are buffered in a local temporary file which is uploaded when the file is synced or closed;
+// new files are created right away, though. Reva has no notion of file modes, owners or access times, so the
+// corresponding operations aren't supported.
+type WritableFS struct {
+	fsys *FS
+
+	// TempDir is the directory to buffer written files in; if empty, the default directory for temporary files is used.
+	TempDir string
+}
+
+var _ afero.Fs = (*WritableFS)(nil)
+
+// Name returns the name of the file system.
+func (wfs *WritableFS) Name() string {
+	return "RevaFs"
+}
+
+// Create creates or truncates the named file.
+func (wfs *WritableFS) Create(name string) (afero.File, error) {
+	return wfs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open opens the named file or directory for reading.
+func (wfs *WritableFS) Open(name string) (afero.File, error) {
+	return wfs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens the named file using the given flags (O_RDONLY etc.); the permissions are ignored.
+func (wfs *WritableFS) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	info, err := wfs.stat("open", name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	exists := err == nil
+
+	f := &writableFile{fsys: wfs, name: name, info: info}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		if !exists {
+			return nil, err
+		}
+
+		// Read-only files are streamed directly from Reva
+		if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			f.reader = &dir{fsys: wfs.fsys, name: name, info: info}
+		} else {
+			f.reader = &file{fsys: wfs.fsys, name: name, info: info}
+		}
+		return f, nil
+	}
+
+	if exists {
+		if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDirectory}
+		}
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+	} else {
+		if flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		if err := wfs.checkParent("open", name); err != nil {
+			return nil, err
+		}
+	}
+
+	// New files are only uploaded once they are synced or closed, so they can't be seen by Stat before then
+	if err := f.openBuffer(flag, exists); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// Stat returns information about the named file or directory.
+func (wfs *WritableFS) Stat(name string) (os.FileInfo, error) {
+	info, err := wfs.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return NewFileInfo(info), nil
+}
+
+// Mkdir creates the named directory; its parent directory must already exist.
+func (wfs *WritableFS) Mkdir(name string, perm os.FileMode) error {
+	if _, err := wfs.stat("mkdir", name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := wfs.checkParent("mkdir", name); err != nil {
+		return err
+	}
+
+	if err := action.MustNewFileOperationsAction(wfs.fsys.session).MakePath(wfs.remotePath(name)); err != nil {
+		return wfs.fsys.pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// MkdirAll creates the named directory along with all missing parent directories.
+func (wfs *WritableFS) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := wfs.stat("mkdir", path); err == nil {
+		if info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+		}
+		return nil
+	}
+
+	if err := action.MustNewFileOperationsAction(wfs.fsys.session).MakePath(wfs.remotePath(path)); err != nil {
+		return wfs.fsys.pathError("mkdir", path, err)
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (wfs *WritableFS) Remove(name string) error {
+	info, err := wfs.stat("remove", name)
+	if err != nil {
+		return err
+	}
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		entries, err := wfs.fsys.readDir(wfs.fsName(name))
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
+	}
+	return wfs.remove(name)
+}
+
+// RemoveAll removes the named path and everything it contains; it succeeds if the path doesn't exist.
+func (wfs *WritableFS) RemoveAll(path string) error {
+	if _, err := wfs.stat("remove", path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return wfs.remove(path)
+}
+
+// Rename moves the old path to the new one; an existing file at the new path is replaced. As Reva offers no atomic
+// replacement, the existing file is moved aside first and restored if the move fails.
+func (wfs *WritableFS) Rename(oldname, newname string) error {
+	info, err := wfs.stat("rename", oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errors.Unwrap(err)}
+	}
+	fileOps := action.MustNewFileOperationsAction(wfs.fsys.session)
+
+	// An existing target is first moved aside and only removed once the source has been moved in its place
+	backupName := ""
+	if targetInfo, err := wfs.stat("rename", newname); err == nil {
+		if targetInfo.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER || info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+		}
+		backupName = p.Join(p.Dir(wfs.fsName(newname)), fmt.Sprintf(".%v.libreva-%v", p.Base(wfs.fsName(newname)), time.Now().UnixNano()))
+		if err := fileOps.Move(wfs.remotePath(newname), wfs.remotePath(backupName)); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: wfs.fsys.translateError("rename", newname, err)}
+		}
+	}
+
+	if err := fileOps.Move(wfs.remotePath(oldname), wfs.remotePath(newname)); err != nil {
+		if backupName != "" {
+			if restoreErr := fileOps.Move(wfs.remotePath(backupName), wfs.remotePath(newname)); restoreErr != nil {
+				wfs.fsys.session.Logger().Log(reva.LogLevelError, "unable to restore the rename target", "path", newname, "backup", backupName, "error", restoreErr)
+			}
+		}
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: wfs.fsys.translateError("rename", oldname, err)}
+	}
+
+	if backupName != "" {
+		if err := wfs.remove(backupName); err != nil {
+			wfs.fsys.session.Logger().Log(reva.LogLevelWarn, "unable to remove the replaced rename target", "path", backupName, "error", err)
+		}
+	}
+	return nil
+}
+
+// Chmod isn't supported by Reva.
+func (wfs *WritableFS) Chmod(name string, mode os.FileMode) error {
+	return &fs.PathError{Op: "chmod", Path: name, Err: errUnsupported}
+}
+
+// Chown isn't supported by Reva.
+func (wfs *WritableFS) Chown(name string, uid, gid int) error {
+	return &fs.PathError{Op: "chown", Path: name, Err: errUnsupported}
+}
+
+// Chtimes isn't supported by Reva.
+func (wfs *WritableFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: name, Err: errUnsupported}
+}
+
+// FS returns the read-only view of the file system.
+func (wfs *WritableFS) FS() *FS {
+	return wfs.fsys
+}
+
+func (wfs *WritableFS) stat(op string, name string) (*storage.ResourceInfo, error) {
+	info, err := wfs.fsys.stat(op, wfs.fsName(name))
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		pathErr.Path = name // Report the name as passed by the caller
+	}
+	return info, err
+}
+
+func (wfs *WritableFS) checkParent(op string, name string) error {
+	parent := p.Dir(wfs.fsName(name))
+	info, err := wfs.stat(op, parent)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: errors.Unwrap(err)}
+	}
+	if info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+func (wfs *WritableFS) remove(name string) error {
+	if err := action.MustNewFileOperationsAction(wfs.fsys.session).Remove(wfs.remotePath(name)); err != nil {
+		return wfs.fsys.pathError("remove", name, err)
+	}
+	return nil
+}
+
+// fsName converts an afero path (which may be absolute or use OS separators) to an io/fs path relative to the root.
+func (wfs *WritableFS) fsName(name string) string {
+	name = strings.TrimPrefix(p.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (wfs *WritableFS) remotePath(name string) string {
+	return wfs.fsys.remotePath(wfs.fsName(name))
+}
+
+// writableFile is a file opened through a WritableFS; read-only files are streamed from Reva, while files opened
+// for writing are buffered in a local temporary file.
+type writableFile struct {
+	fsys *WritableFS
+	name string
+	info *storage.ResourceInfo
+
+	reader fs.File
+	buffer *os.File
+	dirty  bool
+}
+
+var _ afero.File = (*writableFile)(nil)
+
+func (f *writableFile) Name() string {
+	return f.name
+}
+
+func (f *writableFile) Stat() (os.FileInfo, error) {
+	if f.buffer != nil {
+		info, err := f.buffer.Stat()
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+		}
+		return &bufferInfo{FileInfo: info, name: p.Base(f.fsys.fsName(f.name))}, nil
+	}
+	return NewFileInfo(f.info), nil
+}
+
+func (f *writableFile) Read(b []byte) (int, error) {
+	if f.buffer != nil {
+		return f.buffer.Read(b)
+	}
+	return f.reader.Read(b)
+}
+
+func (f *writableFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.buffer != nil {
+		return f.buffer.ReadAt(b, off)
+	}
+	if _, ok := f.reader.(*file); !ok {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDirectory}
+	}
+
+	// Read from a separate stream to leave the offset of the file untouched
+	r := &file{fsys: f.fsys.fsys, name: f.name, info: f.info}
+	defer r.Close()
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *writableFile) Seek(offset int64, whence int) (int64, error) {
+	if f.buffer != nil {
+		return f.buffer.Seek(offset, whence)
+	}
+	if seeker, ok := f.reader.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errIsDirectory}
+}
+
+func (f *writableFile) Write(b []byte) (int, error) {
+	if err := f.checkWritable("write"); err != nil {
+		return 0, err
+	}
+	f.dirty = true
+	return f.buffer.Write(b)
+}
+
+func (f *writableFile) WriteAt(b []byte, off int64) (int, error) {
+	if err := f.checkWritable("write"); err != nil {
+		return 0, err
+	}
+	f.dirty = true
+	return f.buffer.WriteAt(b, off)
+}
+
+func (f *writableFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *writableFile) Truncate(size int64) error {
+	if err := f.checkWritable("truncate"); err != nil {
+		return err
+	}
+	f.dirty = true
+	return f.buffer.Truncate(size)
+}
+
+func (f *writableFile) Readdir(count int) ([]os.FileInfo, error) {
+	entries, err := f.readDir(count)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, _ := entry.Info() // Entries are created from file information, so this never fails
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *writableFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.readDir(n)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, err
+}
+
+// Sync uploads the buffered data if it has been modified.
+func (f *writableFile) Sync() error {
+	if f.buffer == nil || !f.dirty {
+		return nil
+	}
+
+	size, err := f.buffer.Seek(0, io.SeekEnd)
+	if err != nil {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: err}
+	}
+	info, err := action.MustNewUploadAction(f.fsys.fsys.session).Upload(io.NewSectionReader(f.buffer, 0, size), size, f.fsys.remotePath(f.name))
+	if err != nil {
+		return f.fsys.fsys.pathError("sync", f.name, err)
+	}
+	f.info = info
+	f.dirty = false
+	return nil
+}
+
+func (f *writableFile) Close() error {
+	if f.buffer != nil {
+		err := f.Sync()
+		if closeErr := f.closeBuffer(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return f.reader.Close()
+}
+
+// openBuffer creates the temporary buffer file, filling it with the current data of the file unless it is truncated.
+func (f *writableFile) openBuffer(flag int, exists bool) error {
+	buffer, err := ioutil.TempFile(f.fsys.TempDir, "libreva-*")
+	if err != nil {
+		return fmt.Errorf("unable to create the buffer file: %v", err)
+	}
+	f.buffer = buffer
+	f.dirty = !exists || flag&os.O_TRUNC != 0
+
+	if exists && flag&os.O_TRUNC == 0 {
+		if _, err := action.MustNewDownloadAction(f.fsys.fsys.session).DownloadTo(f.info, buffer); err != nil {
+			_ = f.closeBuffer()
+			return f.fsys.fsys.translateError("open", f.name, err)
+		}
+		if _, err := buffer.Seek(0, io.SeekStart); err != nil {
+			_ = f.closeBuffer()
+			return err
+		}
+	}
+
+	if flag&os.O_APPEND != 0 {
+		// Let the OS take care of always writing at the end of the file
+		appendBuffer, err := os.OpenFile(buffer.Name(), os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			_ = f.closeBuffer()
+			return fmt.Errorf("unable to reopen the buffer file: %v", err)
+		}
+		_ = buffer.Close()
+		f.buffer = appendBuffer
+	}
+	return nil
+}
+
+func (f *writableFile) closeBuffer() error {
+	err := f.buffer.Close()
+	_ = os.Remove(f.buffer.Name())
+	return err
+}
+
+func (f *writableFile) checkWritable(op string) error {
+	if f.buffer == nil {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *writableFile) readDir(n int) ([]fs.DirEntry, error) {
+	d, ok := f.reader.(*dir)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	return d.ReadDir(n)
+}
+
+// bufferInfo describes a buffered file under its actual name.
+type bufferInfo struct {
+	os.FileInfo
+
+	name string
+}
+
+func (info *bufferInfo) Name() string {
+	return info.name
+}
+
+// NewWritable creates a writable file system rooted at the given Reva directory.
+func NewWritable(session *reva.Session, root string) (*WritableFS, error) {
+	fsys, err := New(session, root)
+	if err != nil {
+		return nil, err
+	}
+	return &WritableFS{fsys: fsys}, nil
+}
+
+// MustNewWritable creates a new writable file system and panics on failure.
+func MustNewWritable(session *reva.Session, root string) *WritableFS {
+	wfs, err := NewWritable(session, root)
+	if err != nil {
+		panic(err)
+	}
+	return wfs
+}
@@ -0,0 +1,119 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revas3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// chunkedReader decodes request bodies using the aws-chunked content encoding. Each chunk consists of its hexadecimal
+// size (optionally followed by a signature), a CRLF, the data and another CRLF; a chunk of size 0 ends the data and may
+// be followed by trailing headers. As request signatures aren't verified, chunk signatures and trailers are ignored.
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (cr *chunkedReader) Read(b []byte) (int, error) {
+	if cr.done {
+		return 0, io.EOF
+	}
+
+	if cr.remaining == 0 {
+		size, err := cr.readChunkHeader()
+		if err != nil {
+			return 0, err
+		}
+		if size == 0 {
+			cr.done = true
+			return 0, cr.skipTrailers()
+		}
+		cr.remaining = size
+	}
+
+	if int64(len(b)) > cr.remaining {
+		b = b[:cr.remaining]
+	}
+	n, err := cr.reader.Read(b)
+	cr.remaining -= int64(n)
+	if cr.remaining == 0 {
+		// Each chunk is terminated by a CRLF
+		if crlf, err := cr.readLine(); err != nil || crlf != "" {
+			return n, errIncompleteBody
+		}
+	} else if err == io.EOF {
+		err = errIncompleteBody
+	}
+	return n, err
+}
+
+func (cr *chunkedReader) readChunkHeader() (int64, error) {
+	line, err := cr.readLine()
+	if err != nil {
+		return 0, errIncompleteBody
+	}
+	if i := strings.Index(line, ";"); i >= 0 {
+		line = line[:i]
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+	if err != nil || size < 0 {
+		return 0, errIncompleteBody
+	}
+	return size, nil
+}
+
+func (cr *chunkedReader) skipTrailers() error {
+	for {
+		line, err := cr.readLine()
+		if errors.Is(err, io.EOF) || (err == nil && line == "") {
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (cr *chunkedReader) readLine() (string, error) {
+	line, err := cr.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isAWSChunked checks whether the body of a request uses the aws-chunked encoding.
+func isAWSChunked(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") || strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked")
+}
+
+func newChunkedReader(r io.Reader) *chunkedReader {
+	return &chunkedReader{reader: bufio.NewReader(r)}
+}
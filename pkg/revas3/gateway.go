@@ -0,0 +1,270 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package revas3 provides a small S3-compatible API frontend for Reva, so that tools which only speak S3 can access Reva data.
+// Buckets map to the directories directly beneath a root directory, and object keys to the paths of the files within them.
+package revas3
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	p "path"
+	"regexp"
+	"strings"
+	"sync"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+	"github.com/Daniel-WWU-IT/libreva/pkg/revafs"
+)
+
+// Gateway is an http.Handler serving a subset of the S3 API backed by a Reva session: ListBuckets, CreateBucket, HeadBucket,
+// ListObjectsV2, GetObject (including ranges), HeadObject, PutObject, DeleteObject and multipart uploads.
+//
+// Only path-style requests (http://host/bucket/key) are supported. Request signatures aren't verified, as all requests are
+// performed on behalf of the user of the session; the gateway should therefore only be reachable locally.
+type Gateway struct {
+	session *reva.Session
+	root    string
+	fsys    *revafs.FS
+
+	// TempDir is the directory to spool the parts of multipart uploads in; if empty, the default directory for temporary files is used.
+	TempDir string
+	// MaxPartSize is the maximum size of a single part of a multipart upload; if zero, the limit of S3 (5 GiB) is used.
+	MaxPartSize int64
+
+	uploads      map[string]*multipartUpload
+	uploadsMutex sync.Mutex
+}
+
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+var (
+	_ http.Handler = (*Gateway)(nil)
+	_ io.Closer    = (*Gateway)(nil)
+)
+
+// ServeHTTP dispatches an S3 request to the corresponding operation.
+func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key := splitPath(r.URL.Path)
+	query := r.URL.Query()
+
+	var err error
+	switch {
+	case (bucket == "" && key != "") || (bucket != "" && !validBucket(bucket)):
+		err = errInvalidBucketName
+
+	case bucket == "":
+		if r.Method == http.MethodGet {
+			err = gw.listBuckets(w, r)
+		} else {
+			err = errMethodNotAllowed
+		}
+
+	case key == "":
+		switch r.Method {
+		case http.MethodGet:
+			if query.Get("list-type") != "2" {
+				err = errNotImplemented // Only ListObjectsV2 is supported
+			} else {
+				err = gw.listObjects(w, r, bucket)
+			}
+		case http.MethodHead:
+			err = gw.headBucket(w, r, bucket)
+		case http.MethodPut:
+			err = gw.createBucket(w, r, bucket)
+		default:
+			err = errMethodNotAllowed
+		}
+
+	case query.Has("uploads") || query.Has("uploadId"):
+		switch r.Method {
+		case http.MethodPost:
+			if query.Has("uploads") {
+				err = gw.createMultipartUpload(w, r, bucket, key)
+			} else {
+				err = gw.completeMultipartUpload(w, r, bucket, key, query.Get("uploadId"))
+			}
+		case http.MethodPut:
+			err = gw.uploadPart(w, r, bucket, key, query.Get("uploadId"), query.Get("partNumber"))
+		case http.MethodDelete:
+			err = gw.abortMultipartUpload(w, r, bucket, key, query.Get("uploadId"))
+		default:
+			err = errMethodNotAllowed
+		}
+
+	default:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			err = gw.getObject(w, r, bucket, key)
+		case http.MethodPut:
+			err = gw.putObject(w, r, bucket, key)
+		case http.MethodDelete:
+			err = gw.deleteObject(w, r, bucket, key)
+		default:
+			err = errMethodNotAllowed
+		}
+	}
+
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// Close discards all unfinished multipart uploads.
+func (gw *Gateway) Close() error {
+	gw.uploadsMutex.Lock()
+	defer gw.uploadsMutex.Unlock()
+
+	for id, upload := range gw.uploads {
+		_ = os.RemoveAll(upload.dir)
+		delete(gw.uploads, id)
+	}
+	return nil
+}
+
+// Root returns the Reva path of the directory holding the buckets.
+func (gw *Gateway) Root() string {
+	return gw.root
+}
+
+func (gw *Gateway) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	infos, err := action.MustNewEnumFilesAction(gw.session).ListDirs(gw.root, false)
+	if err != nil {
+		return err
+	}
+
+	res := &listAllMyBucketsResult{Xmlns: s3Namespace}
+	for _, info := range infos {
+		// Directories whose names can't be used as bucket names are skipped
+		if name := p.Base(info.Path); validBucket(name) {
+			res.Buckets = append(res.Buckets, bucketEntry{Name: name, CreationDate: formatTime(info.Mtime)})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (gw *Gateway) headBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if err := gw.checkBucket(bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (gw *Gateway) createBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	fileOpsAct := action.MustNewFileOperationsAction(gw.session)
+	if fileOpsAct.ResourceExists(gw.bucketPath(bucket)) {
+		return errBucketAlreadyOwnedByYou
+	}
+	if err := fileOpsAct.MakePath(gw.bucketPath(bucket)); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// checkBucket makes sure that the given bucket exists.
+func (gw *Gateway) checkBucket(bucket string) error {
+	if !action.MustNewFileOperationsAction(gw.session).DirExists(gw.bucketPath(bucket)) {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+// statObject queries the information of an object, telling apart missing buckets and missing objects.
+func (gw *Gateway) statObject(bucket string, key string) (*storage.ResourceInfo, error) {
+	if err := gw.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	info, err := action.MustNewFileOperationsAction(gw.session).Stat(gw.objectPath(bucket, key))
+	if err != nil {
+		return nil, notFoundAs(err, errNoSuchKey)
+	}
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		return nil, errNoSuchKey
+	}
+	return info, nil
+}
+
+func (gw *Gateway) bucketPath(bucket string) string {
+	return p.Join(gw.root, bucket)
+}
+
+func (gw *Gateway) objectPath(bucket string, key string) string {
+	return p.Join(gw.root, bucket, key)
+}
+
+// splitPath splits a path-style request path into the bucket and the object key.
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// validBucket checks whether a bucket name follows the S3 naming rules, which also ensures that it maps to a single directory
+// beneath the root: 3 to 63 lowercase letters, digits, dots and hyphens, starting and ending with a letter or digit, without
+// consecutive dots and not formatted like an IP address.
+func validBucket(bucket string) bool {
+	if !bucketNameRegexp.MatchString(bucket) || strings.Contains(bucket, "..") || net.ParseIP(bucket) != nil {
+		return false
+	}
+	return p.Clean(bucket) == bucket && !strings.Contains(bucket, "/")
+}
+
+// validKey checks whether an object key can be mapped to a Reva path; keys with empty or relative path elements can't.
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && p.Clean("/"+key) == "/"+strings.TrimSuffix(key, "/")
+}
+
+// New creates a new S3 gateway serving the directories beneath the given Reva directory as buckets.
+func New(session *reva.Session, root string) (*Gateway, error) {
+	fsys, err := revafs.New(session, root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the S3 gateway: %v", err)
+	}
+	return &Gateway{
+		session: session,
+		root:    fsys.Root(),
+		fsys:    fsys,
+		uploads: make(map[string]*multipartUpload),
+	}, nil
+}
+
+// MustNew creates a new S3 gateway and panics on failure.
+func MustNew(session *reva.Session, root string) *Gateway {
+	gw, err := New(session, root)
+	if err != nil {
+		panic(err)
+	}
+	return gw
+}
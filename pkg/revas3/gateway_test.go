@@ -0,0 +1,199 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revas3_test
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
+	"github.com/Daniel-WWU-IT/libreva/pkg/revas3"
+)
+
+func TestGateway(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	gw.WriteFile("/home/s3/data/existing.txt", []byte("EXISTING\n"), time.Now())
+
+	s3gw := revas3.MustNew(session, "/home/s3")
+	s3gw.TempDir = t.TempDir()
+	s3gw.MaxPartSize = 16
+	defer s3gw.Close()
+	server := httptest.NewServer(s3gw)
+	defer server.Close()
+
+	md5Hex := func(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+	md5Base64 := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	chunked := map[string]string{"X-Amz-Content-Sha256": "STREAMING-UNSIGNED-PAYLOAD-TRAILER", "Content-Encoding": "aws-chunked", "X-Amz-Decoded-Content-Length": "11"}
+	chunkedUndeclared := map[string]string{"X-Amz-Content-Sha256": "STREAMING-UNSIGNED-PAYLOAD-TRAILER", "Content-Encoding": "aws-chunked", "X-Amz-Decoded-Content-Length": "6"}
+	completeBody := func(parts ...int) string {
+		body := "<CompleteMultipartUpload>"
+		for _, part := range parts {
+			body += fmt.Sprintf("<Part><PartNumber>%v</PartNumber><ETag>\"%v\"</ETag></Part>", part, md5Hex(fmt.Sprintf("PART%v-", part)))
+		}
+		return body + "</CompleteMultipartUpload>"
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		status  int
+		output  string
+	}{
+		{"GET", "/", nil, "", http.StatusOK, "<Name>data</Name>"},
+		{"PUT", "/photos", nil, "", http.StatusOK, ""},
+		{"PUT", "/photos", nil, "", http.StatusConflict, "BucketAlreadyOwnedByYou"},
+		{"HEAD", "/photos", nil, "", http.StatusOK, ""},
+		{"HEAD", "/missing", nil, "", http.StatusNotFound, ""},
+		{"PUT", "/photos/2020/jan/a.jpg", nil, "AAAA", http.StatusOK, ""},
+		{"PUT", "/photos/2020/feb/b.jpg", chunked, "5\r\nHELLO\r\n6;chunk-signature=abc\r\n WORLD\r\n0\r\nx-amz-checksum-crc32:xyz\r\n\r\n", http.StatusOK, ""},
+		{"PUT", "/photos/2020/mar/", nil, "", http.StatusOK, ""},
+		{"PUT", "/photos/../escape.txt", nil, "-", http.StatusBadRequest, "InvalidArgument"},
+		{"PUT", "/missing/file.txt", nil, "-", http.StatusNotFound, "NoSuchBucket"},
+		{"PUT", "/photos/md5.txt", map[string]string{"Content-MD5": md5Base64("VERIFIED")}, "VERIFIED", http.StatusOK, ""},
+		{"GET", "/photos/md5.txt", nil, "", http.StatusOK, "VERIFIED"},
+		{"PUT", "/photos/bad-md5.txt", map[string]string{"Content-MD5": md5Base64("OTHER")}, "VERIFIED", http.StatusBadRequest, "BadDigest"},
+		{"PUT", "/photos/bad-md5.txt", map[string]string{"Content-MD5": "invalid"}, "VERIFIED", http.StatusBadRequest, "InvalidDigest"},
+		{"GET", "/photos/bad-md5.txt", nil, "", http.StatusNotFound, "NoSuchKey"},
+		{"DELETE", "/photos/md5.txt", nil, "", http.StatusNoContent, ""},
+		{"GET", "/..", nil, "", http.StatusBadRequest, "InvalidBucketName"},
+		{"GET", "/.", nil, "", http.StatusBadRequest, "InvalidBucketName"},
+		{"GET", "/..%2F..?list-type=2", nil, "", http.StatusBadRequest, "InvalidBucketName"},
+		{"PUT", "/../escape.txt", nil, "-", http.StatusBadRequest, "InvalidBucketName"},
+		{"PUT", "/Photos", nil, "", http.StatusBadRequest, "InvalidBucketName"},
+		{"GET", "//photos", nil, "", http.StatusBadRequest, "InvalidBucketName"},
+		{"GET", "/photos/2020/feb/b.jpg", nil, "", http.StatusOK, "HELLO WORLD"},
+		{"GET", "/photos/2020/feb/b.jpg", map[string]string{"Range": "bytes=6-10"}, "", http.StatusPartialContent, "WORLD"},
+		{"HEAD", "/photos/2020/jan/a.jpg", nil, "", http.StatusOK, ""},
+		{"GET", "/photos/2020/jan", nil, "", http.StatusNotFound, "NoSuchKey"},
+		{"GET", "/photos/missing.jpg", nil, "", http.StatusNotFound, "NoSuchKey"},
+		{"GET", "/missing/a.jpg", nil, "", http.StatusNotFound, "NoSuchBucket"},
+		{"GET", "/photos?list-type=2", nil, "", http.StatusOK, "<KeyCount>2</KeyCount>"},
+		{"GET", "/photos?list-type=2&prefix=2020/f", nil, "", http.StatusOK, "<Key>2020/feb/b.jpg</Key>"},
+		{"GET", "/photos?list-type=2&prefix=2020/&delimiter=/", nil, "", http.StatusOK, "<CommonPrefixes><Prefix>2020/feb/</Prefix></CommonPrefixes><CommonPrefixes><Prefix>2020/jan/</Prefix></CommonPrefixes><CommonPrefixes><Prefix>2020/mar/</Prefix>"},
+		{"GET", "/photos?list-type=2&max-keys=1", nil, "", http.StatusOK, "<IsTruncated>true</IsTruncated>"},
+		{"GET", "/photos?list-type=2&max-keys=1&continuation-token=" + base64.StdEncoding.EncodeToString([]byte("2020/feb/b.jpg")), nil, "", http.StatusOK, "<Key>2020/jan/a.jpg</Key>"},
+		{"GET", "/photos?list-type=2&prefix=nothing/", nil, "", http.StatusOK, "<KeyCount>0</KeyCount>"},
+		{"GET", "/photos", nil, "", http.StatusNotImplemented, "NotImplemented"},
+		{"POST", "/photos/big.bin?uploads", nil, "", http.StatusOK, "<UploadId>"},
+		{"PUT", "/photos/big.bin?partNumber=2&uploadId={upload}", nil, "PART2-", http.StatusOK, ""},
+		{"PUT", "/photos/big.bin?partNumber=1&uploadId={upload}", nil, "PART1-", http.StatusOK, ""},
+		{"PUT", "/photos/big.bin?partNumber=1&uploadId=unknown", nil, "PART1-", http.StatusNotFound, "NoSuchUpload"},
+		{"PUT", "/photos/big.bin?partNumber=1&uploadId={upload}", map[string]string{"Content-MD5": md5Base64("OTHER")}, "CORRUPT", http.StatusBadRequest, "BadDigest"},
+		{"PUT", "/photos/big.bin?partNumber=3&uploadId={upload}", nil, "PART3-PART3-PART3-", http.StatusBadRequest, "EntityTooLarge"},
+		{"PUT", "/photos/big.bin?partNumber=3&uploadId={upload}", chunkedUndeclared, "12\r\nPART3-PART3-PART3-\r\n0\r\n\r\n", http.StatusBadRequest, "EntityTooLarge"},
+		{"POST", "/photos/big.bin?uploadId={upload}", nil, completeBody(2, 1), http.StatusBadRequest, "InvalidPartOrder"},
+		{"POST", "/photos/big.bin?uploadId={upload}", nil, completeBody(1, 3), http.StatusBadRequest, "InvalidPart"},
+		{"POST", "/photos/big.bin?uploadId={upload}", nil, completeBody(1, 2), http.StatusOK, "-2&#34;</ETag>"},
+		{"GET", "/photos/big.bin", nil, "", http.StatusOK, "PART1-PART2-"},
+		{"DELETE", "/photos/big.bin?uploadId={upload}", nil, "", http.StatusNotFound, "NoSuchUpload"},
+		{"DELETE", "/photos/2020/jan/a.jpg", nil, "", http.StatusNoContent, ""},
+		{"DELETE", "/photos/2020/jan/a.jpg", nil, "", http.StatusNoContent, ""},
+		{"GET", "/photos/2020/jan/a.jpg", nil, "", http.StatusNotFound, "NoSuchKey"},
+	}
+
+	uploadIDRegexp := regexp.MustCompile("<UploadId>([0-9a-f]+)</UploadId>")
+	uploadID := ""
+	for _, test := range tests {
+		path := strings.ReplaceAll(test.path, "{upload}", uploadID)
+		req, _ := http.NewRequest(test.method, server.URL+path, strings.NewReader(test.body))
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("http.Client.Do", err, test.method, path))
+		}
+		data, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		if match := uploadIDRegexp.FindSubmatch(data); match != nil {
+			uploadID = string(match[1])
+		}
+		if res.StatusCode != test.status {
+			t.Errorf(testintl.FormatTestResult(test.method, test.status, res.StatusCode, path, string(data)))
+		} else if !strings.Contains(string(data), test.output) {
+			t.Errorf(testintl.FormatTestResult(test.method, test.output, string(data), path))
+		}
+	}
+}
+
+func TestListObjectsPagination(t *testing.T) {
+	gw, session := testintl.NewTestSession(t)
+	keys := []string{"a-c.txt", "a/b.txt", "a/c/d.txt", "a0.txt", "b/x/y/z.txt", "b/y.txt", "c.txt"}
+	for _, key := range keys {
+		gw.WriteFile("/home/s3/bucket/"+key, []byte(key), time.Now())
+	}
+
+	s3gw := revas3.MustNew(session, "/home/s3")
+	defer s3gw.Close()
+	server := httptest.NewServer(s3gw)
+	defer server.Close()
+
+	keyRegexp := regexp.MustCompile("<Key>([^<]+)</Key>")
+	tokenRegexp := regexp.MustCompile("<NextContinuationToken>([^<]+)</NextContinuationToken>")
+	var listed []string
+	token := ""
+	for page := 0; page <= len(keys); page++ {
+		listings := gw.Listings()
+		res, err := http.Get(server.URL + "/bucket?list-type=2&max-keys=2&continuation-token=" + url.QueryEscape(token))
+		if err != nil {
+			t.Fatalf(testintl.FormatTestError("http.Get", err, token))
+		}
+		data, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+
+		for _, match := range keyRegexp.FindAllSubmatch(data, -1) {
+			listed = append(listed, string(match[1]))
+		}
+
+		match := tokenRegexp.FindSubmatch(data)
+		if match == nil {
+			// Directories preceding the continuation token must not be listed again
+			if gw.Listings()-listings > 2 {
+				t.Errorf(testintl.FormatTestResult("Listings", 2, gw.Listings()-listings, token))
+			}
+			break
+		}
+		token = string(match[1])
+	}
+
+	if strings.Join(listed, ",") != strings.Join(keys, ",") {
+		t.Errorf(testintl.FormatTestResult("ListObjectsV2", keys, listed))
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revas3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+const (
+	// maxParts is the highest part number allowed by S3.
+	maxParts = 10000
+	// defaultMaxPartSize is the maximum size of a single part allowed by S3.
+	defaultMaxPartSize = 5 << 30
+)
+
+// multipartUpload is an unfinished multipart upload; its parts are spooled to a local temporary directory and
+// uploaded to Reva as a whole once the upload is completed.
+type multipartUpload struct {
+	bucket string
+	key    string
+	dir    string
+
+	parts map[int]*uploadPart
+}
+
+type uploadPart struct {
+	path string
+	etag string
+	size int64
+}
+
+func (gw *Gateway) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	if !validKey(key) || strings.HasSuffix(key, "/") {
+		return errInvalidKey
+	}
+	if err := gw.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("unable to generate an upload ID: %v", err)
+	}
+	dir, err := ioutil.TempDir(gw.TempDir, "libreva-s3-*")
+	if err != nil {
+		return fmt.Errorf("unable to create the spool directory: %v", err)
+	}
+
+	upload := &multipartUpload{bucket: bucket, key: key, dir: dir, parts: make(map[int]*uploadPart)}
+	uploadID := hex.EncodeToString(id)
+	gw.uploadsMutex.Lock()
+	gw.uploads[uploadID] = upload
+	gw.uploadsMutex.Unlock()
+
+	return writeXML(w, http.StatusOK, &initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: uploadID})
+}
+
+func (gw *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, bucket string, key string, uploadID string, partNumber string) error {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil || number < 1 || number > maxParts {
+		return errInvalidArgument
+	}
+	upload, err := gw.getUpload(bucket, key, uploadID, false)
+	if err != nil {
+		return err
+	}
+	expected, err := contentMD5(r)
+	if err != nil {
+		return err
+	}
+
+	// Reject parts that are too large right away; parts without a declared size are limited while being read
+	maxSize := gw.maxPartSize()
+	body, declaredSize := requestBody(r)
+	if declaredSize > maxSize {
+		return errEntityTooLarge
+	}
+	body = http.MaxBytesReader(w, ioutil.NopCloser(body), maxSize)
+
+	// Parts may be uploaded in parallel, so each one gets its own file; uploading a part again replaces it
+	// The part is spooled to a temporary file first, so that a failed upload doesn't affect a previous one
+	path := filepath.Join(upload.dir, strconv.Itoa(number))
+	f, err := ioutil.TempFile(upload.dir, "incomplete-*")
+	if err != nil {
+		return fmt.Errorf("unable to spool part %v: %v", number, err)
+	}
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), body)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		err = errEntityTooLarge
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && expected != nil && !bytes.Equal(hash.Sum(nil), expected) {
+		err = errBadDigest
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	part := &uploadPart{path: path, etag: hex.EncodeToString(hash.Sum(nil)), size: size}
+	gw.uploadsMutex.Lock()
+	upload.parts[number] = part
+	gw.uploadsMutex.Unlock()
+
+	w.Header().Set("ETag", `"`+part.etag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (gw *Gateway) maxPartSize() int64 {
+	if gw.MaxPartSize > 0 {
+		return gw.MaxPartSize
+	}
+	return defaultMaxPartSize
+}
+
+func (gw *Gateway) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string, uploadID string) error {
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	// The upload is removed while it is being completed, so that it can't be completed twice
+	upload, err := gw.getUpload(bucket, key, uploadID, true)
+	if err != nil {
+		return err
+	}
+	restore := true
+	defer func() {
+		if restore {
+			gw.uploadsMutex.Lock()
+			gw.uploads[uploadID] = upload
+			gw.uploadsMutex.Unlock()
+		}
+	}()
+
+	// Assemble the requested parts in order; the ETag of the object is computed from the ETags of its parts, just like S3 does
+	parts := &partsReaderAt{}
+	hash := md5.New()
+	size := int64(0)
+	for i, reqPart := range req.Parts {
+		if i > 0 && reqPart.PartNumber <= req.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		gw.uploadsMutex.Lock()
+		part, ok := upload.parts[reqPart.PartNumber]
+		gw.uploadsMutex.Unlock()
+		if !ok || strings.Trim(reqPart.ETag, `"`) != part.etag {
+			return errInvalidPart
+		}
+
+		f, err := os.Open(part.path)
+		if err != nil {
+			return fmt.Errorf("unable to open part %v: %v", reqPart.PartNumber, err)
+		}
+		defer f.Close()
+		parts.files = append(parts.files, f)
+		parts.offsets = append(parts.offsets, size)
+		sum, _ := hex.DecodeString(part.etag)
+		hash.Write(sum)
+		size += part.size
+	}
+
+	// The parts are passed on as a single seekable stream, so that they don't need to be spooled again
+	if _, err := action.MustNewUploadAction(gw.session).Upload(io.NewSectionReader(parts, 0, size), size, gw.objectPath(bucket, key)); err != nil {
+		return err
+	}
+	restore = false
+	_ = os.RemoveAll(upload.dir)
+
+	etag := fmt.Sprintf(`"%v-%v"`, hex.EncodeToString(hash.Sum(nil)), len(req.Parts))
+	return writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+}
+
+func (gw *Gateway) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string, uploadID string) error {
+	upload, err := gw.getUpload(bucket, key, uploadID, true)
+	if err != nil {
+		return err
+	}
+	_ = os.RemoveAll(upload.dir)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// getUpload looks up a multipart upload, optionally removing it from the list of unfinished uploads.
+func (gw *Gateway) getUpload(bucket string, key string, uploadID string, remove bool) (*multipartUpload, error) {
+	gw.uploadsMutex.Lock()
+	defer gw.uploadsMutex.Unlock()
+
+	upload, ok := gw.uploads[uploadID]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return nil, errNoSuchUpload
+	}
+	if remove {
+		delete(gw.uploads, uploadID)
+	}
+	return upload, nil
+}
+
+// partsReaderAt reads the concatenated data of the spooled parts of a multipart upload.
+type partsReaderAt struct {
+	files []*os.File
+	// offsets holds the offset of each part within the concatenated data
+	offsets []int64
+}
+
+func (parts *partsReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	// Find the last part starting at or before the offset; empty parts are skipped automatically
+	i := sort.Search(len(parts.offsets), func(i int) bool { return parts.offsets[i] > off }) - 1
+	if i < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+
+	n := 0
+	for ; i < len(parts.files) && n < len(b); i++ {
+		m, err := parts.files[i].ReadAt(b[n:], off+int64(n)-parts.offsets[i])
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,372 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revas3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	p "path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+)
+
+const (
+	defaultMaxKeys = 1000
+
+	// emptyETag is the ETag of an object without any data (its MD5 checksum).
+	emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+)
+
+func (gw *Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	if !validKey(key) || strings.HasSuffix(key, "/") {
+		return errNoSuchKey
+	}
+	info, err := gw.statObject(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// The file is streamed from Reva; seeking (for range requests) restarts the download at the requested offset
+	f, err := gw.fsys.Open(p.Join(bucket, key))
+	if err != nil {
+		return notFoundAs(err, errNoSuchKey)
+	}
+	defer f.Close()
+
+	contentType := info.MimeType
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", objectETag(info))
+	http.ServeContent(w, r, "", modTime(info.Mtime), f.(io.ReadSeeker))
+	return nil
+}
+
+func (gw *Gateway) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		return errNotImplemented
+	}
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	if err := gw.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	// Keys ending in a slash are commonly used to represent (empty) directories
+	if strings.HasSuffix(key, "/") {
+		if err := action.MustNewFileOperationsAction(gw.session).MakePath(gw.objectPath(bucket, key)); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", emptyETag)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	body, size := requestBody(r)
+	if r.Header.Get("Content-MD5") != "" {
+		// The data must not reach Reva before it has been verified, so it is spooled first
+		spool, err := gw.spoolVerified(r, body)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		body, size = spool, -1
+	}
+
+	uploadAct := action.MustNewUploadAction(gw.session)
+	uploadAct.LocalChecksums = []string{"md5"}
+	_, checksums, err := uploadAct.UploadWithChecksums(body, size, gw.objectPath(bucket, key))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+checksums["md5"]+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (gw *Gateway) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	if err := gw.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	// Deleting a missing object isn't an error in S3; directories are only removed via their (empty) directory objects
+	if validKey(key) {
+		fileOpsAct := action.MustNewFileOperationsAction(gw.session)
+		path := gw.objectPath(bucket, key)
+		if info, err := fileOpsAct.Stat(path); err == nil {
+			isDir := info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER
+			if isDir == strings.HasSuffix(key, "/") && (!isDir || gw.isEmptyDir(path)) {
+				if err := fileOpsAct.Remove(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (gw *Gateway) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		return errNotImplemented // Only the directory separator can be mapped to Reva
+	}
+	maxKeys := defaultMaxKeys
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxKeys = n
+	}
+	marker := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		data, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return errInvalidArgument
+		}
+		marker = string(data)
+	}
+
+	if err := gw.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	// Listing starts in the deepest directory covered by the prefix; without a delimiter, all objects beneath it are listed
+	var items []listItem
+	bucketPath := gw.bucketPath(bucket)
+	listPath := p.Join(bucketPath, p.Dir("/"+prefix))
+	if delimiter == "" {
+		// Only one more object than requested is needed to tell whether the listing is truncated
+		if err := gw.walkObjects(listPath, bucketPath, prefix, marker, maxKeys+1, &items); err != nil {
+			return err
+		}
+	} else {
+		infos, err := action.MustNewEnumFilesAction(gw.session).ListAll(listPath, false)
+		if err != nil && notFoundAs(err, errNoSuchKey) != errNoSuchKey {
+			return err
+		}
+		for _, info := range infos {
+			key := objectKey(info, bucketPath)
+			if strings.HasPrefix(key, prefix) && key > marker {
+				if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+					info = nil
+				}
+				items = append(items, listItem{key: key, info: info})
+			}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	}
+
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.PathEscape
+	}
+	res := &listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		MaxKeys:           maxKeys,
+		EncodingType:      query.Get("encoding-type"),
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        encode(query.Get("start-after")),
+	}
+	if len(items) > maxKeys {
+		items = items[:maxKeys]
+		res.IsTruncated = true
+		if maxKeys > 0 {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(items[len(items)-1].key))
+		}
+	}
+	for _, item := range items {
+		if item.info == nil {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encode(item.key)})
+		} else {
+			res.Contents = append(res.Contents, objectEntry{
+				Key:          encode(item.key),
+				LastModified: formatTime(item.info.Mtime),
+				ETag:         objectETag(item.info),
+				Size:         int64(item.info.Size),
+				StorageClass: "STANDARD",
+			})
+		}
+	}
+	res.KeyCount = len(items)
+	return writeXML(w, http.StatusOK, res)
+}
+
+// listItem is an entry of an object listing; info is nil for common prefixes.
+type listItem struct {
+	key  string
+	info *storage.ResourceInfo
+}
+
+// walkObjects appends the objects beneath the given directory whose keys match the prefix and follow the marker, in
+// lexicographical order, until the limit is reached; directories which can't contain any such objects aren't listed at all.
+func (gw *Gateway) walkObjects(path string, bucketPath string, prefix string, marker string, limit int, items *[]listItem) error {
+	infos, err := action.MustNewEnumFilesAction(gw.session).ListAll(path, false)
+	if err != nil {
+		if notFoundAs(err, errNoSuchKey) == errNoSuchKey {
+			return nil // A prefix not matching any directory (or a directory removed meanwhile) simply yields no objects
+		}
+		return err
+	}
+
+	// Directory keys end in a slash, so that the objects beneath them are visited in the order of their keys
+	sort.Slice(infos, func(i, j int) bool { return objectKey(infos[i], bucketPath) < objectKey(infos[j], bucketPath) })
+	for _, info := range infos {
+		if len(*items) >= limit {
+			return nil
+		}
+
+		key := objectKey(info, bucketPath)
+		if info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			if strings.HasPrefix(key, prefix) && key > marker {
+				*items = append(*items, listItem{key: key, info: info})
+			}
+			continue
+		}
+		if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+			continue
+		}
+		if marker >= key && !strings.HasPrefix(marker, key) {
+			continue // All keys beneath the directory precede the marker
+		}
+		if err := gw.walkObjects(info.Path, bucketPath, prefix, marker, limit, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectKey returns the key of a resource within its bucket; the keys of directories end in a slash.
+func objectKey(info *storage.ResourceInfo, bucketPath string) string {
+	key := strings.TrimPrefix(strings.TrimPrefix(info.Path, bucketPath), "/")
+	if info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+		key += "/"
+	}
+	return key
+}
+
+func (gw *Gateway) isEmptyDir(path string) bool {
+	infos, err := action.MustNewEnumFilesAction(gw.session).ListAll(path, false)
+	return err == nil && len(infos) == 0
+}
+
+// spoolVerified writes the body of a request to a temporary file, verifying it against the Content-MD5 header; the
+// returned file is positioned at its beginning.
+func (gw *Gateway) spoolVerified(r *http.Request, body io.Reader) (*os.File, error) {
+	expected, err := contentMD5(r)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := ioutil.TempFile(gw.TempDir, "libreva-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the spool file: %v", err)
+	}
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(spool, hash), body)
+	if err == nil && !bytes.Equal(hash.Sum(nil), expected) {
+		err = errBadDigest
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+		return nil, err
+	}
+	return spool, nil
+}
+
+// contentMD5 decodes the Content-MD5 header of a request; nil is returned if the header is missing.
+func contentMD5(r *http.Request) ([]byte, error) {
+	value := r.Header.Get("Content-MD5")
+	if value == "" {
+		return nil, nil
+	}
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != md5.Size {
+		return nil, errInvalidDigest
+	}
+	return sum, nil
+}
+
+// requestBody returns the (decoded) body of an upload request along with its size; -1 is returned if the size is unknown.
+func requestBody(r *http.Request) (io.Reader, int64) {
+	if !isAWSChunked(r) {
+		return r.Body, r.ContentLength
+	}
+
+	size := int64(-1)
+	if value, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+		size = value
+	}
+	return newChunkedReader(r.Body), size
+}
+
+// objectETag returns the MD5 checksum of a resource if available, as clients might compare it to the data; otherwise, its ETag is used.
+func objectETag(info *storage.ResourceInfo) string {
+	if info.Checksum != nil && info.Checksum.Type == storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5 && info.Checksum.Sum != "" {
+		return `"` + info.Checksum.Sum + `"`
+	}
+	if strings.HasPrefix(info.Etag, `"`) {
+		return info.Etag
+	}
+	return `"` + info.Etag + `"`
+}
+
+func modTime(ts *types.Timestamp) time.Time {
+	return time.Unix(int64(ts.GetSeconds()), int64(ts.GetNanos())).UTC()
+}
+
+// formatTime formats a timestamp the way S3 does (ISO 8601 with milliseconds).
+func formatTime(ts *types.Timestamp) string {
+	return modTime(ts).Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,186 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revas3
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	rpc "github.com/cs3org/go-cs3apis/cs3/rpc/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/net"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// apiError is an error reported to S3 clients using one of the standard S3 error codes.
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (err *apiError) Error() string {
+	return err.Code + ": " + err.Message
+}
+
+var (
+	errAccessDenied            = &apiError{"AccessDenied", "Access denied.", http.StatusForbidden}
+	errBadDigest               = &apiError{"BadDigest", "The Content-MD5 you specified did not match what was received.", http.StatusBadRequest}
+	errBucketAlreadyOwnedByYou = &apiError{"BucketAlreadyOwnedByYou", "The bucket already exists.", http.StatusConflict}
+	errEntityTooLarge          = &apiError{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed size.", http.StatusBadRequest}
+	errInvalidArgument         = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidBucketName       = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errInvalidDigest           = &apiError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	errInvalidKey              = &apiError{"InvalidArgument", "The object key can't be mapped to a path.", http.StatusBadRequest}
+	errInvalidPart             = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder        = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errMalformedXML            = &apiError{"MalformedXML", "The XML provided was not well-formed.", http.StatusBadRequest}
+	errIncompleteBody          = &apiError{"IncompleteBody", "The request body is malformed or incomplete.", http.StatusBadRequest}
+	errMethodNotAllowed        = &apiError{"MethodNotAllowed", "The method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errNoSuchBucket            = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey               = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload            = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented          = &apiError{"NotImplemented", "The requested functionality is not implemented.", http.StatusNotImplemented}
+)
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []objectEntry  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type objectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// writeXML writes an XML response with the given status code.
+func writeXML(w http.ResponseWriter, statusCode int, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(data)
+	return nil
+}
+
+// writeError reports an error to the client; errors other than S3 errors are mapped to the closest S3 error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		apiErr = &apiError{"InternalError", err.Error(), http.StatusInternalServerError}
+
+		var rpcErr *net.RPCError
+		if errors.Is(err, fs.ErrPermission) || (errors.As(err, &rpcErr) && rpcErr.Code == rpc.Code_CODE_PERMISSION_DENIED) {
+			apiErr = errAccessDenied
+		}
+	}
+
+	// Responses to HEAD requests don't have a body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(apiErr.StatusCode)
+		return
+	}
+	_ = writeXML(w, apiErr.StatusCode, &errorResponse{Code: apiErr.Code, Message: apiErr.Message, Resource: r.URL.Path})
+}
+
+// notFoundAs replaces errors signaling a missing resource by the given S3 error.
+func notFoundAs(err error, notFoundErr *apiError) error {
+	var rpcErr *net.RPCError
+	if errors.Is(err, fs.ErrNotExist) || (errors.As(err, &rpcErr) && rpcErr.Code == rpc.Code_CODE_NOT_FOUND) {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revasync
+
+import (
+	"fmt"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// OperationType specifies what needs to be done to synchronize a single path.
+type OperationType int
+
+const (
+	// OperationUpload uploads a local file, replacing the remote one if it exists.
+	OperationUpload OperationType = iota
+	// OperationDownload downloads a remote file, replacing the local one if it exists.
+	OperationDownload
+	// OperationMakeLocalDir creates a local directory.
+	OperationMakeLocalDir
+	// OperationMakeRemoteDir creates a remote directory.
+	OperationMakeRemoteDir
+	// OperationMoveLocal renames a local file that has been renamed remotely.
+	OperationMoveLocal
+	// OperationMoveRemote renames a remote file that has been renamed locally.
+	OperationMoveRemote
+	// OperationRemoveLocal deletes a local file or directory that has been deleted remotely.
+	OperationRemoveLocal
+	// OperationRemoveRemote deletes a remote file or directory that has been deleted locally.
+	OperationRemoveRemote
+	// OperationConflict resolves a file that has been modified on both sides in ModeTwoWay; the local version is kept as a conflict copy.
+	OperationConflict
+
+	operationKeep
+)
+
+// String returns a textual representation of the operation type.
+func (opType OperationType) String() string {
+	switch opType {
+	case OperationUpload:
+		return "upload"
+	case OperationDownload:
+		return "download"
+	case OperationMakeLocalDir:
+		return "mkdir-local"
+	case OperationMakeRemoteDir:
+		return "mkdir-remote"
+	case OperationMoveLocal:
+		return "move-local"
+	case OperationMoveRemote:
+		return "move-remote"
+	case OperationRemoveLocal:
+		return "remove-local"
+	case OperationRemoveRemote:
+		return "remove-remote"
+	case OperationConflict:
+		return "conflict"
+	default:
+		return "keep"
+	}
+}
+
+// Operation describes a single step of a synchronization.
+// All paths are relative to the synchronized directories and use forward slashes.
+type Operation struct {
+	Type OperationType
+	Path string
+	// Target is the new path for moves and the name of the conflict copy for conflicts.
+	Target string
+
+	local  *localEntry
+	remote *storage.ResourceInfo
+}
+
+// String returns a textual representation of the operation.
+func (op *Operation) String() string {
+	if op.Target != "" {
+		return fmt.Sprintf("%v %v -> %v", op.Type, op.Path, op.Target)
+	}
+	return fmt.Sprintf("%v %v", op.Type, op.Path)
+}
+
+// OperationResult holds the outcome of a single operation.
+type OperationResult struct {
+	Operation Operation
+	Err       error
+}
+
+// Result holds the outcome of a synchronization.
+type Result struct {
+	Operations []OperationResult
+}
+
+// Failed returns all operations that failed.
+func (result *Result) Failed() []OperationResult {
+	failed := make([]OperationResult, 0)
+	for _, opResult := range result.Operations {
+		if opResult.Err != nil {
+			failed = append(failed, opResult)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,107 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revasync
+
+import (
+	"fmt"
+	"io"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/pkg/action"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// Remote provides access to the remote side of a synchronization.
+// NewRemote creates a remote that operates on a Reva session; other implementations are mainly useful for testing.
+type Remote interface {
+	// ListAll retrieves all files and directories contained in the provided path, including all subdirectories.
+	ListAll(path string) ([]*storage.ResourceInfo, error)
+
+	// Download streams the data of the provided file to the given writer.
+	Download(info *storage.ResourceInfo, w io.Writer) error
+	// Upload uploads data from the provided reader to the target and returns information about the uploaded file.
+	Upload(data io.Reader, size int64, target string) (*storage.ResourceInfo, error)
+
+	// MakePath creates the entire directory tree specified by the given path.
+	MakePath(path string) error
+	// Move moves the specified source to a new location; the target directory must exist.
+	Move(source string, target string) error
+	// Remove deletes the specified resource.
+	Remove(path string) error
+}
+
+type sessionRemote struct {
+	enumFilesAction *action.EnumFilesAction
+	fileOpsAction   *action.FileOperationsAction
+	uploadAction    *action.UploadAction
+	downloadAction  *action.DownloadAction
+}
+
+func (remote *sessionRemote) ListAll(path string) ([]*storage.ResourceInfo, error) {
+	return remote.enumFilesAction.ListAll(path, true)
+}
+
+func (remote *sessionRemote) Download(info *storage.ResourceInfo, w io.Writer) error {
+	_, err := remote.downloadAction.DownloadTo(info, w)
+	return err
+}
+
+func (remote *sessionRemote) Upload(data io.Reader, size int64, target string) (*storage.ResourceInfo, error) {
+	return remote.uploadAction.Upload(data, size, target)
+}
+
+func (remote *sessionRemote) MakePath(path string) error {
+	return remote.fileOpsAction.MakePath(path)
+}
+
+func (remote *sessionRemote) Move(source string, target string) error {
+	return remote.fileOpsAction.Move(source, target)
+}
+
+func (remote *sessionRemote) Remove(path string) error {
+	return remote.fileOpsAction.Remove(path)
+}
+
+// NewRemote creates a new remote that uses the provided session to access Reva.
+func NewRemote(session *reva.Session) (Remote, error) {
+	remote := &sessionRemote{}
+
+	var err error
+	if remote.enumFilesAction, err = action.NewEnumFilesAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the remote: %v", err)
+	}
+	if remote.fileOpsAction, err = action.NewFileOperationsAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the remote: %v", err)
+	}
+	if remote.uploadAction, err = action.NewUploadAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the remote: %v", err)
+	}
+	if remote.downloadAction, err = action.NewDownloadAction(session); err != nil {
+		return nil, fmt.Errorf("unable to create the remote: %v", err)
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revasync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+)
+
+// DefaultStateFileName is the name of the state database if no other location has been specified; it is stored in the local directory.
+const DefaultStateFileName = ".libreva-sync.json"
+
+const stateVersion = 1
+
+// stateEntry stores what both sides looked like after the last successful synchronization of a single path.
+type stateEntry struct {
+	IsDir bool `json:"dir,omitempty"`
+
+	LocalSize  int64 `json:"localSize"`
+	LocalMtime int64 `json:"localMtime"`
+
+	RemoteSize   uint64 `json:"remoteSize"`
+	RemoteMtime  uint64 `json:"remoteMtime"`
+	RemoteETag   string `json:"etag,omitempty"`
+	RemoteID     string `json:"id,omitempty"`
+	ChecksumType int32  `json:"checksumType,omitempty"`
+	Checksum     string `json:"checksum,omitempty"`
+}
+
+func (entry *stateEntry) checksumType() storage.ResourceChecksumType {
+	return storage.ResourceChecksumType(entry.ChecksumType)
+}
+
+// stateDB persists the state of all synchronized paths (relative to the synchronized directories).
+type stateDB struct {
+	Version int                    `json:"version"`
+	Entries map[string]*stateEntry `json:"entries"`
+
+	file string
+}
+
+func (db *stateDB) save() error {
+	data, err := json.MarshalIndent(db, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to encode the sync state: %v", err)
+	}
+
+	// Write the state to a temporary file first, so that a crash never leaves a corrupted state behind
+	tmpFile, err := ioutil.TempFile(filepath.Dir(db.file), filepath.Base(db.file)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create the sync state file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to write the sync state file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("unable to write the sync state file: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), db.file); err != nil {
+		return fmt.Errorf("unable to replace the sync state file: %v", err)
+	}
+
+	return nil
+}
+
+func loadStateDB(file string) (*stateDB, error) {
+	db := &stateDB{
+		Version: stateVersion,
+		Entries: make(map[string]*stateEntry),
+		file:    file,
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		// No state yet, so this is the first synchronization
+		return db, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read the sync state file '%v': %v", file, err)
+	}
+
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("unable to decode the sync state file '%v': %v", file, err)
+	}
+	if db.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported sync state version %v", db.Version)
+	}
+	if db.Entries == nil {
+		db.Entries = make(map[string]*stateEntry)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,806 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+// Package revasync keeps a local directory and a remote Reva directory in sync.
+package revasync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	p "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
+	"github.com/Daniel-WWU-IT/libreva/pkg/reva"
+)
+
+// Mode specifies in which direction changes are synchronized.
+type Mode int
+
+const (
+	// ModeTwoWay propagates changes in both directions; files modified on both sides result in a conflict copy.
+	ModeTwoWay Mode = iota
+	// ModePush makes the remote directory mirror the local one.
+	ModePush
+	// ModePull makes the local directory mirror the remote one.
+	ModePull
+)
+
+// ignoredPrefix is used for all files the syncer creates in the local directory (the state database and temporary download files).
+const ignoredPrefix = ".libreva-sync"
+
+const conflictTimeFormat = "2006-01-02 150405"
+
+type localEntry struct {
+	isDir bool
+	size  int64
+	mtime time.Time
+}
+
+// Syncer synchronizes a local directory with a remote directory.
+// Files are compared by their size, modification time, ETag and checksum; a state database keeps track of
+// the last synchronized state, so that deletions and renames can be distinguished from new files.
+type Syncer struct {
+	remote    Remote
+	localDir  string
+	remoteDir string
+	now       func() time.Time
+
+	// Mode specifies in which direction changes are synchronized.
+	Mode Mode
+	// StateFile is the location of the state database; it defaults to DefaultStateFileName in the local directory.
+	StateFile string
+}
+
+// Plan determines which operations are necessary to synchronize both directories without actually performing them.
+func (syncer *Syncer) Plan() ([]Operation, error) {
+	db, err := loadStateDB(syncer.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := syncer.plan(db)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]Operation, 0, len(ops))
+	for _, op := range ops {
+		if op.Type != operationKeep {
+			plan = append(plan, *op)
+		}
+	}
+	return plan, nil
+}
+
+// Sync synchronizes both directories.
+// Failed operations don't stop the synchronization; they are reported in the result and retried during the next synchronization.
+func (syncer *Syncer) Sync() (*Result, error) {
+	if err := syncer.remote.MakePath(syncer.remoteDir); err != nil {
+		return nil, fmt.Errorf("unable to create the remote directory '%v': %v", syncer.remoteDir, err)
+	}
+	if err := os.MkdirAll(syncer.localDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create the local directory '%v': %v", syncer.localDir, err)
+	}
+
+	db, err := loadStateDB(syncer.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := syncer.plan(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Operations: make([]OperationResult, 0, len(ops))}
+	for _, op := range ops {
+		err := syncer.execute(op, db)
+		if op.Type != operationKeep {
+			result.Operations = append(result.Operations, OperationResult{Operation: *op, Err: err})
+		}
+	}
+
+	if err := db.save(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (syncer *Syncer) plan(db *stateDB) ([]*Operation, error) {
+	local, err := syncer.scanLocal()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := syncer.scanRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]*stateEntry, len(db.Entries))
+	for path, entry := range db.Entries {
+		state[path] = entry
+	}
+
+	ops := make([]*Operation, 0)
+	if syncer.Mode != ModePush {
+		ops = append(ops, syncer.detectRemoteRenames(local, remote, state)...)
+	}
+	if syncer.Mode != ModePull {
+		ops = append(ops, syncer.detectLocalRenames(local, remote, state)...)
+	}
+
+	paths := make(map[string]bool, len(local)+len(remote)+len(state))
+	for path := range local {
+		paths[path] = true
+	}
+	for path := range remote {
+		paths[path] = true
+	}
+	for path := range state {
+		paths[path] = true
+	}
+
+	now := syncer.now()
+	for path := range paths {
+		op := &Operation{Path: path, local: local[path], remote: remote[path]}
+		op.Type = syncer.decide(path, op.local, op.remote, state[path])
+		if op.Type == OperationConflict {
+			op.Target = ConflictName(path, now)
+		}
+		ops = append(ops, op)
+	}
+
+	keepRequiredDirs(ops)
+	sortOperations(ops)
+	return ops, nil
+}
+
+func (syncer *Syncer) decide(path string, local *localEntry, remote *storage.ResourceInfo, state *stateEntry) OperationType {
+	if local == nil && remote == nil {
+		return operationKeep
+	}
+
+	switch syncer.Mode {
+	case ModePush:
+		// The local side always wins; the remote side is never pulled and no conflict copies are created
+		if local == nil {
+			return OperationRemoveRemote
+		} else if remote == nil || local.isDir != isDir(remote) {
+			return selectOperation(local.isDir, OperationMakeRemoteDir, OperationUpload)
+		} else if local.isDir || syncer.isUnchanged(path, local, remote, state) {
+			return operationKeep
+		}
+		return OperationUpload
+
+	case ModePull:
+		// The remote side always wins; the local side is never pushed and no conflict copies are created
+		if remote == nil {
+			return OperationRemoveLocal
+		} else if local == nil || local.isDir != isDir(remote) {
+			return selectOperation(isDir(remote), OperationMakeLocalDir, OperationDownload)
+		} else if local.isDir || syncer.isUnchanged(path, local, remote, state) {
+			return operationKeep
+		}
+		return OperationDownload
+	}
+
+	if local == nil {
+		if state == nil || syncer.remoteChanged(remote, state) {
+			return selectOperation(isDir(remote), OperationMakeLocalDir, OperationDownload)
+		}
+		return OperationRemoveRemote
+	} else if remote == nil {
+		if state == nil || syncer.localChanged(path, local, state) {
+			return selectOperation(local.isDir, OperationMakeRemoteDir, OperationUpload)
+		}
+		return OperationRemoveLocal
+	} else if local.isDir != isDir(remote) {
+		return OperationConflict
+	} else if local.isDir {
+		return operationKeep
+	}
+
+	localChanged := syncer.localChanged(path, local, state)
+	remoteChanged := syncer.remoteChanged(remote, state)
+	switch {
+	case localChanged && remoteChanged:
+		// Both sides might have been changed in the same way (or this is the first synchronization)
+		if syncer.sameContent(path, local, remote) || syncer.sameRemoteContent(path, local, remote) {
+			return operationKeep
+		}
+		return OperationConflict
+
+	case localChanged:
+		return OperationUpload
+
+	case remoteChanged:
+		return OperationDownload
+	}
+	return operationKeep
+}
+
+func (syncer *Syncer) isUnchanged(path string, local *localEntry, remote *storage.ResourceInfo, state *stateEntry) bool {
+	if !syncer.localChanged(path, local, state) && !syncer.remoteChanged(remote, state) {
+		return true
+	}
+	return syncer.sameContent(path, local, remote)
+}
+
+func (syncer *Syncer) localChanged(path string, local *localEntry, state *stateEntry) bool {
+	if state == nil || local.isDir != state.IsDir {
+		return true
+	} else if local.isDir {
+		return false
+	}
+
+	if local.size != state.LocalSize {
+		return true
+	} else if local.mtime.UnixNano() == state.LocalMtime {
+		return false
+	}
+
+	// The file has only been touched if its contents still match the stored checksum
+	if state.Checksum != "" {
+		checksum, err := syncer.localChecksum(path, state.checksumType())
+		return err != nil || !strings.EqualFold(checksum, state.Checksum)
+	}
+	return true
+}
+
+func (syncer *Syncer) remoteChanged(remote *storage.ResourceInfo, state *stateEntry) bool {
+	if state == nil || isDir(remote) != state.IsDir {
+		return true
+	} else if isDir(remote) {
+		return false
+	}
+
+	if state.Checksum != "" && remote.Checksum != nil && int32(remote.Checksum.Type) == state.ChecksumType && remote.Checksum.Sum != "" {
+		return !strings.EqualFold(remote.Checksum.Sum, state.Checksum)
+	}
+	if state.RemoteETag != "" && remote.Etag != "" {
+		return remote.Etag != state.RemoteETag
+	}
+	return remote.Size != state.RemoteSize || remote.GetMtime().GetSeconds() != state.RemoteMtime
+}
+
+func (syncer *Syncer) sameContent(path string, local *localEntry, remote *storage.ResourceInfo) bool {
+	if local.size != int64(remote.Size) {
+		return false
+	}
+
+	if remote.Checksum != nil && remote.Checksum.Sum != "" {
+		if checksum, err := syncer.localChecksum(path, remote.Checksum.Type); err == nil && checksum != "" {
+			return strings.EqualFold(checksum, remote.Checksum.Sum)
+		}
+	}
+
+	// Without a checksum, the contents can't be compared; matching modification times aren't reliable enough
+	return false
+}
+
+func (syncer *Syncer) sameRemoteContent(path string, local *localEntry, remote *storage.ResourceInfo) bool {
+	if local.size != int64(remote.Size) || (remote.Checksum != nil && remote.Checksum.Sum != "") {
+		return false
+	}
+
+	// The remote file comes without a usable checksum, so compute it from its contents instead of declaring a conflict
+	hash, err := crypto.NewChecksumHash(storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5)
+	if err != nil {
+		return false
+	}
+	if err := syncer.remote.Download(remote, hash); err != nil {
+		return false
+	}
+
+	checksum, err := syncer.localChecksum(path, storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5)
+	return err == nil && strings.EqualFold(checksum, fmt.Sprintf("%x", hash.Sum(nil)))
+}
+
+func (syncer *Syncer) localChecksum(path string, checksumType storage.ResourceChecksumType) (string, error) {
+	file, err := os.Open(syncer.localPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return crypto.ComputeChecksum(checksumType, file)
+}
+
+func (syncer *Syncer) detectRemoteRenames(local map[string]*localEntry, remote map[string]*storage.ResourceInfo, state map[string]*stateEntry) []*Operation {
+	// A remote file that has been renamed keeps its resource ID
+	remoteIDs := make(map[string]string, len(remote))
+	for path, info := range remote {
+		if state[path] == nil && local[path] == nil && !isDir(info) {
+			if id := resourceID(info); id != "" {
+				remoteIDs[id] = path
+			}
+		}
+	}
+
+	ops := make([]*Operation, 0)
+	for _, path := range statePaths(state) {
+		entry := state[path]
+		if entry.IsDir || entry.RemoteID == "" || remote[path] != nil || local[path] == nil || syncer.localChanged(path, local[path], entry) {
+			continue
+		}
+
+		if target, ok := remoteIDs[entry.RemoteID]; ok {
+			ops = append(ops, &Operation{Type: OperationMoveLocal, Path: path, Target: target, local: local[path], remote: remote[target]})
+
+			local[target] = local[path]
+			state[target] = entry
+			delete(local, path)
+			delete(state, path)
+			delete(remoteIDs, entry.RemoteID)
+		}
+	}
+	return ops
+}
+
+func (syncer *Syncer) detectLocalRenames(local map[string]*localEntry, remote map[string]*storage.ResourceInfo, state map[string]*stateEntry) []*Operation {
+	// A local file that has been renamed keeps its size and modification time
+	candidates := make([]string, 0)
+	for path, entry := range local {
+		if state[path] == nil && remote[path] == nil && !entry.isDir {
+			candidates = append(candidates, path)
+		}
+	}
+	sort.Strings(candidates)
+
+	ops := make([]*Operation, 0)
+	for _, path := range statePaths(state) {
+		entry := state[path]
+		if entry.IsDir || local[path] != nil || remote[path] == nil || syncer.remoteChanged(remote[path], entry) {
+			continue
+		}
+
+		for i, target := range candidates {
+			if local[target].size != entry.LocalSize || local[target].mtime.UnixNano() != entry.LocalMtime {
+				continue
+			}
+			if entry.Checksum != "" {
+				if checksum, err := syncer.localChecksum(target, entry.checksumType()); err != nil || !strings.EqualFold(checksum, entry.Checksum) {
+					continue
+				}
+			}
+
+			info := *remote[path]
+			info.Path = syncer.remotePath(target)
+			ops = append(ops, &Operation{Type: OperationMoveRemote, Path: path, Target: target, local: local[target], remote: &info})
+
+			remote[target] = &info
+			state[target] = entry
+			delete(remote, path)
+			delete(state, path)
+			candidates = append(candidates[:i], candidates[i+1:]...)
+			break
+		}
+	}
+	return ops
+}
+
+func (syncer *Syncer) execute(op *Operation, db *stateDB) error {
+	if err := syncer.removeReplaced(op); err != nil {
+		return err
+	}
+
+	switch op.Type {
+	case OperationUpload:
+		return syncer.upload(op.Path, db)
+
+	case OperationDownload:
+		return syncer.download(op.Path, op.remote, db)
+
+	case OperationMakeLocalDir:
+		if err := os.MkdirAll(syncer.localPath(op.Path), 0755); err != nil {
+			return fmt.Errorf("unable to create local directory '%v': %v", op.Path, err)
+		}
+		db.Entries[op.Path] = &stateEntry{IsDir: true}
+
+	case OperationMakeRemoteDir:
+		if err := syncer.remote.MakePath(syncer.remotePath(op.Path)); err != nil {
+			return fmt.Errorf("unable to create remote directory '%v': %v", op.Path, err)
+		}
+		db.Entries[op.Path] = &stateEntry{IsDir: true}
+
+	case OperationMoveLocal:
+		if err := os.MkdirAll(filepath.Dir(syncer.localPath(op.Target)), 0755); err != nil {
+			return fmt.Errorf("unable to create local directory for '%v': %v", op.Target, err)
+		}
+		if err := os.Rename(syncer.localPath(op.Path), syncer.localPath(op.Target)); err != nil {
+			return fmt.Errorf("unable to move local file '%v' to '%v': %v", op.Path, op.Target, err)
+		}
+		db.Entries[op.Target] = db.Entries[op.Path]
+		delete(db.Entries, op.Path)
+
+	case OperationMoveRemote:
+		if err := syncer.remote.MakePath(syncer.remotePath(p.Dir(op.Target))); err != nil {
+			return fmt.Errorf("unable to create remote directory for '%v': %v", op.Target, err)
+		}
+		if err := syncer.remote.Move(syncer.remotePath(op.Path), syncer.remotePath(op.Target)); err != nil {
+			return fmt.Errorf("unable to move remote file '%v' to '%v': %v", op.Path, op.Target, err)
+		}
+		db.Entries[op.Target] = db.Entries[op.Path]
+		delete(db.Entries, op.Path)
+
+	case OperationRemoveLocal:
+		if err := os.Remove(syncer.localPath(op.Path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove local file '%v': %v", op.Path, err)
+		}
+		delete(db.Entries, op.Path)
+
+	case OperationRemoveRemote:
+		if err := syncer.remote.Remove(syncer.remotePath(op.Path)); err != nil {
+			return fmt.Errorf("unable to remove remote file '%v': %v", op.Path, err)
+		}
+		delete(db.Entries, op.Path)
+
+	case OperationConflict:
+		return syncer.resolveConflict(op, db)
+
+	default:
+		if op.local == nil || op.remote == nil {
+			delete(db.Entries, op.Path)
+		} else {
+			db.Entries[op.Path] = newStateEntry(op.local, op.remote)
+		}
+	}
+
+	return nil
+}
+
+func (syncer *Syncer) upload(path string, db *stateDB) error {
+	file, err := os.Open(syncer.localPath(path))
+	if err != nil {
+		return fmt.Errorf("unable to open local file '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	local, err := statLocal(file.Name())
+	if err != nil {
+		return err
+	}
+
+	info, err := syncer.remote.Upload(file, local.size, syncer.remotePath(path))
+	if err != nil {
+		return fmt.Errorf("unable to upload '%v': %v", path, err)
+	}
+
+	db.Entries[path] = newStateEntry(local, info)
+	return nil
+}
+
+func (syncer *Syncer) download(path string, info *storage.ResourceInfo, db *stateDB) error {
+	target := syncer.localPath(path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("unable to create local directory for '%v': %v", path, err)
+	}
+
+	// Download to a temporary file first, so that an interrupted download never leaves a partial file behind
+	tmpFile, err := ioutil.TempFile(filepath.Dir(target), ignoredPrefix+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file for '%v': %v", path, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := syncer.remote.Download(info, tmpFile); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to download '%v': %v", path, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("unable to write local file '%v': %v", path, err)
+	}
+
+	if mtime := info.GetMtime(); mtime != nil {
+		modTime := time.Unix(int64(mtime.Seconds), int64(mtime.Nanos))
+		_ = os.Chtimes(tmpFile.Name(), modTime, modTime)
+	}
+	if err := os.Rename(tmpFile.Name(), target); err != nil {
+		return fmt.Errorf("unable to replace local file '%v': %v", path, err)
+	}
+
+	local, err := statLocal(target)
+	if err != nil {
+		return err
+	}
+	db.Entries[path] = newStateEntry(local, info)
+	return nil
+}
+
+func (syncer *Syncer) removeReplaced(op *Operation) error {
+	if !replacesType(op) {
+		return nil
+	}
+
+	// A file that replaces a directory (or vice versa) requires the old entry to be removed first; the contents of a directory have already been removed at this point
+	switch op.Type {
+	case OperationUpload, OperationMakeRemoteDir:
+		if err := syncer.remote.Remove(syncer.remotePath(op.Path)); err != nil {
+			return fmt.Errorf("unable to remove remote file '%v': %v", op.Path, err)
+		}
+
+	case OperationDownload, OperationMakeLocalDir:
+		if err := os.Remove(syncer.localPath(op.Path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove local file '%v': %v", op.Path, err)
+		}
+	}
+	return nil
+}
+
+func (syncer *Syncer) resolveConflict(op *Operation, db *stateDB) error {
+	if op.local.isDir || isDir(op.remote) {
+		return fmt.Errorf("'%v' is a file on one side and a directory on the other side", op.Path)
+	}
+
+	// Keep the local version as a conflict copy, replace it by the remote version and upload the conflict copy as well
+	if err := os.Rename(syncer.localPath(op.Path), syncer.localPath(op.Target)); err != nil {
+		return fmt.Errorf("unable to create conflict copy of '%v': %v", op.Path, err)
+	}
+	if err := syncer.download(op.Path, op.remote, db); err != nil {
+		return err
+	}
+	return syncer.upload(op.Target, db)
+}
+
+func (syncer *Syncer) scanLocal() (map[string]*localEntry, error) {
+	entries := make(map[string]*localEntry)
+	stateFile, _ := filepath.Abs(syncer.StateFile)
+
+	err := filepath.Walk(syncer.localDir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == syncer.localDir {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+
+		if path == syncer.localDir {
+			return nil
+		}
+
+		if absPath, _ := filepath.Abs(path); strings.HasPrefix(info.Name(), ignoredPrefix) || absPath == stateFile {
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(syncer.localDir, path)
+		if err != nil {
+			return err
+		}
+		entries[filepath.ToSlash(rel)] = &localEntry{isDir: info.IsDir(), size: info.Size(), mtime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan the local directory '%v': %v", syncer.localDir, err)
+	}
+
+	return entries, nil
+}
+
+func (syncer *Syncer) scanRemote() (map[string]*storage.ResourceInfo, error) {
+	infos, err := syncer.remote.ListAll(syncer.remoteDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan the remote directory '%v': %v", syncer.remoteDir, err)
+	}
+
+	prefix := strings.TrimSuffix(syncer.remoteDir, "/") + "/"
+	entries := make(map[string]*storage.ResourceInfo, len(infos))
+	for _, info := range infos {
+		if info.Type != storage.ResourceType_RESOURCE_TYPE_FILE && info.Type != storage.ResourceType_RESOURCE_TYPE_CONTAINER {
+			continue
+		}
+
+		if rel := strings.TrimPrefix(info.Path, prefix); rel != info.Path && rel != "" {
+			entries[rel] = info
+		}
+	}
+
+	return entries, nil
+}
+
+func (syncer *Syncer) localPath(path string) string {
+	return filepath.Join(syncer.localDir, filepath.FromSlash(path))
+}
+
+func (syncer *Syncer) remotePath(path string) string {
+	return p.Join(syncer.remoteDir, path)
+}
+
+// ConflictName returns the name of the conflict copy of the given file, e.g. "file (conflict 2020-01-02 150405).ext".
+func ConflictName(path string, t time.Time) string {
+	dir, name := p.Split(path)
+	ext := p.Ext(name)
+	if ext == name { // Files like ".profile" have no extension
+		ext = ""
+	}
+
+	return dir + fmt.Sprintf("%v (conflict %v)%v", strings.TrimSuffix(name, ext), t.Format(conflictTimeFormat), ext)
+}
+
+// keepRequiredDirs makes sure that directories are not removed if anything inside them still needs to exist.
+func keepRequiredDirs(ops []*Operation) {
+	localDirs := make(map[string]bool)
+	remoteDirs := make(map[string]bool)
+	addParents := func(dirs map[string]bool, path string) {
+		for dir := p.Dir(path); dir != "." && dir != "/"; dir = p.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	for _, op := range ops {
+		path := op.Path
+		if op.Target != "" {
+			path = op.Target
+		}
+
+		if op.Type != OperationRemoveLocal && (op.local != nil || op.Type == OperationDownload || op.Type == OperationMakeLocalDir) {
+			addParents(localDirs, path)
+		}
+		if op.Type != OperationRemoveRemote && (op.remote != nil || op.Type == OperationUpload || op.Type == OperationMakeRemoteDir) {
+			addParents(remoteDirs, path)
+		}
+	}
+
+	for _, op := range ops {
+		if op.Type == OperationRemoveLocal && op.local.isDir && localDirs[op.Path] {
+			op.Type = OperationMakeRemoteDir
+		} else if op.Type == OperationRemoveRemote && isDir(op.remote) && remoteDirs[op.Path] {
+			op.Type = OperationMakeLocalDir
+		}
+	}
+}
+
+// sortOperations brings all operations into an order that can be executed safely: Directories are created first and
+// moves are performed before any data is transferred; removals come last, deepest paths first.
+func sortOperations(ops []*Operation) {
+	phase := func(op *Operation) int {
+		switch op.Type {
+		case OperationMakeLocalDir, OperationMakeRemoteDir:
+			return 0
+		case OperationMoveLocal, OperationMoveRemote:
+			return 1
+		case OperationRemoveLocal, OperationRemoveRemote:
+			return 3
+		case OperationUpload, OperationDownload:
+			// A file replacing a directory must wait until the contents of the directory have been removed
+			if replacesType(op) {
+				return 3
+			}
+			return 2
+		default:
+			return 2
+		}
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		if phaseI, phaseJ := phase(ops[i]), phase(ops[j]); phaseI != phaseJ {
+			return phaseI < phaseJ
+		} else if phaseI == 3 {
+			return ops[i].Path > ops[j].Path
+		}
+		return ops[i].Path < ops[j].Path
+	})
+}
+
+func replacesType(op *Operation) bool {
+	return op.local != nil && op.remote != nil && op.local.isDir != isDir(op.remote)
+}
+
+func statLocal(path string) (*localEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat local file '%v': %v", path, err)
+	}
+	return &localEntry{isDir: info.IsDir(), size: info.Size(), mtime: info.ModTime()}, nil
+}
+
+func newStateEntry(local *localEntry, remote *storage.ResourceInfo) *stateEntry {
+	entry := &stateEntry{
+		IsDir:       local.isDir,
+		LocalSize:   local.size,
+		LocalMtime:  local.mtime.UnixNano(),
+		RemoteSize:  remote.Size,
+		RemoteMtime: remote.GetMtime().GetSeconds(),
+		RemoteETag:  remote.Etag,
+		RemoteID:    resourceID(remote),
+	}
+	if remote.Checksum != nil {
+		entry.ChecksumType = int32(remote.Checksum.Type)
+		entry.Checksum = remote.Checksum.Sum
+	}
+	return entry
+}
+
+func isDir(info *storage.ResourceInfo) bool {
+	return info.Type == storage.ResourceType_RESOURCE_TYPE_CONTAINER
+}
+
+func resourceID(info *storage.ResourceInfo) string {
+	if info.Id == nil || info.Id.OpaqueId == "" {
+		return ""
+	}
+	return info.Id.StorageId + ":" + info.Id.OpaqueId
+}
+
+func statePaths(state map[string]*stateEntry) []string {
+	paths := make([]string, 0, len(state))
+	for path := range state {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func selectOperation(dir bool, dirOp OperationType, fileOp OperationType) OperationType {
+	if dir {
+		return dirOp
+	}
+	return fileOp
+}
+
+// NewSyncer creates a new syncer that synchronizes the local directory with the remote directory using the provided session.
+func NewSyncer(session *reva.Session, localDir string, remoteDir string) (*Syncer, error) {
+	remote, err := NewRemote(session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the Syncer: %v", err)
+	}
+	return NewSyncerWithRemote(remote, localDir, remoteDir)
+}
+
+// NewSyncerWithRemote creates a new syncer that synchronizes the local directory with the remote directory using the provided remote.
+func NewSyncerWithRemote(remote Remote, localDir string, remoteDir string) (*Syncer, error) {
+	if remote == nil {
+		return nil, fmt.Errorf("unable to create the Syncer: no remote provided")
+	}
+	if localDir == "" || remoteDir == "" {
+		return nil, fmt.Errorf("unable to create the Syncer: no directories provided")
+	}
+
+	syncer := &Syncer{
+		remote:    remote,
+		localDir:  filepath.Clean(localDir),
+		remoteDir: p.Clean(remoteDir),
+		now:       time.Now,
+		Mode:      ModeTwoWay,
+	}
+	syncer.StateFile = filepath.Join(syncer.localDir, DefaultStateFileName)
+	return syncer, nil
+}
+
+// MustNewSyncer creates a new syncer and panics on failure.
+func MustNewSyncer(session *reva.Session, localDir string, remoteDir string) *Syncer {
+	syncer, err := NewSyncer(session, localDir, remoteDir)
+	if err != nil {
+		panic(err)
+	}
+	return syncer
+}
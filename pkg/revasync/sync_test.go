@@ -0,0 +1,431 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2020 Daniel Mueller
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package revasync_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	p "path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	storage "github.com/cs3org/go-cs3apis/cs3/storage/provider/v1beta1"
+	types "github.com/cs3org/go-cs3apis/cs3/types/v1beta1"
+
+	"github.com/Daniel-WWU-IT/libreva/internal/common/crypto"
+	testintl "github.com/Daniel-WWU-IT/libreva/internal/testing"
+	"github.com/Daniel-WWU-IT/libreva/pkg/revasync"
+)
+
+// memoryRemote keeps all remote files in memory; resources keep their IDs when being moved, just like in Reva.
+type memoryRemote struct {
+	infos  map[string]*storage.ResourceInfo
+	data   map[string][]byte
+	nextID int
+}
+
+func (remote *memoryRemote) ListAll(path string) ([]*storage.ResourceInfo, error) {
+	infos := make([]*storage.ResourceInfo, 0)
+	for _, info := range remote.infos {
+		if strings.HasPrefix(info.Path, path+"/") {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (remote *memoryRemote) Download(info *storage.ResourceInfo, w io.Writer) error {
+	data, ok := remote.data[info.Path]
+	if !ok {
+		return fmt.Errorf("'%v' not found", info.Path)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (remote *memoryRemote) Upload(data io.Reader, size int64, target string) (*storage.ResourceInfo, error) {
+	content, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	remote.write(target, content, time.Now())
+	return remote.infos[target], nil
+}
+
+func (remote *memoryRemote) MakePath(path string) error {
+	for dir := path; dir != "/"; dir = p.Dir(dir) {
+		if _, ok := remote.infos[dir]; !ok {
+			remote.infos[dir] = &storage.ResourceInfo{Type: storage.ResourceType_RESOURCE_TYPE_CONTAINER, Path: dir, Id: remote.newID()}
+		}
+	}
+	return nil
+}
+
+func (remote *memoryRemote) Move(source string, target string) error {
+	for path, info := range remote.infos {
+		if path == source || strings.HasPrefix(path, source+"/") {
+			newPath := target + strings.TrimPrefix(path, source)
+			info.Path = newPath
+			remote.infos[newPath] = info
+			delete(remote.infos, path)
+
+			if data, ok := remote.data[path]; ok {
+				remote.data[newPath] = data
+				delete(remote.data, path)
+			}
+		}
+	}
+	return nil
+}
+
+func (remote *memoryRemote) Remove(path string) error {
+	for existingPath := range remote.infos {
+		if existingPath == path || strings.HasPrefix(existingPath, path+"/") {
+			delete(remote.infos, existingPath)
+			delete(remote.data, existingPath)
+		}
+	}
+	return nil
+}
+
+func (remote *memoryRemote) write(path string, data []byte, mtime time.Time) {
+	_ = remote.MakePath(p.Dir(path))
+
+	checksum, _ := crypto.ComputeMD5Checksum(bytes.NewReader(data))
+	info, ok := remote.infos[path]
+	if !ok {
+		info = &storage.ResourceInfo{Type: storage.ResourceType_RESOURCE_TYPE_FILE, Path: path, Id: remote.newID()}
+		remote.infos[path] = info
+	}
+	info.Size = uint64(len(data))
+	info.Mtime = &types.Timestamp{Seconds: uint64(mtime.Unix())}
+	info.Etag = fmt.Sprintf("%v-%v", info.Id.OpaqueId, mtime.UnixNano())
+	info.Checksum = &storage.ResourceChecksum{Type: storage.ResourceChecksumType_RESOURCE_CHECKSUM_TYPE_MD5, Sum: checksum}
+	remote.data[path] = data
+}
+
+func (remote *memoryRemote) newID() *storage.ResourceId {
+	remote.nextID++
+	return &storage.ResourceId{StorageId: "memory", OpaqueId: fmt.Sprint(remote.nextID)}
+}
+
+func newMemoryRemote() *memoryRemote {
+	return &memoryRemote{
+		infos: make(map[string]*storage.ResourceInfo),
+		data:  make(map[string][]byte),
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	localDir, err := ioutil.TempDir("", "libreva-sync")
+	if err != nil {
+		t.Fatalf(testintl.FormatTestError("ioutil.TempDir", err, "", "libreva-sync"))
+	}
+	defer os.RemoveAll(localDir)
+
+	remote := newMemoryRemote()
+	writeLocal := func(path string, data string, age time.Duration) {
+		file := filepath.Join(localDir, filepath.FromSlash(path))
+		_ = os.MkdirAll(filepath.Dir(file), 0755)
+		_ = ioutil.WriteFile(file, []byte(data), 0644)
+		mtime := time.Now().Add(-age)
+		_ = os.Chtimes(file, mtime, mtime)
+	}
+	readLocal := func(path string) string {
+		data, err := ioutil.ReadFile(filepath.Join(localDir, filepath.FromSlash(path)))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	readRemote := func(path string) string {
+		if data, ok := remote.data[p.Join("/home/sync", path)]; ok {
+			return string(data)
+		}
+		return "<missing>"
+	}
+
+	tests := []struct {
+		name    string
+		mode    revasync.Mode
+		prepare func()
+		ops     []string
+		files   map[string]string
+	}{
+		{
+			"initial",
+			revasync.ModeTwoWay,
+			func() {
+				writeLocal("a.txt", "local a", time.Hour)
+				writeLocal("sub/b.txt", "local b", time.Hour)
+				remote.write("/home/sync/c.txt", []byte("remote c"), time.Now().Add(-time.Hour))
+			},
+			[]string{"download c.txt", "mkdir-remote sub", "upload a.txt", "upload sub/b.txt"},
+			map[string]string{"a.txt": "local a", "sub/b.txt": "local b", "c.txt": "remote c"},
+		},
+		{
+			"unchanged",
+			revasync.ModeTwoWay,
+			func() {
+				// Touching a file without changing its contents is detected by its checksum
+				writeLocal("a.txt", "local a", time.Minute)
+			},
+			[]string{},
+			map[string]string{"a.txt": "local a", "sub/b.txt": "local b", "c.txt": "remote c"},
+		},
+		{
+			"modified",
+			revasync.ModeTwoWay,
+			func() {
+				writeLocal("a.txt", "local a v2", 0)
+				remote.write("/home/sync/c.txt", []byte("remote c v2"), time.Now())
+			},
+			[]string{"download c.txt", "upload a.txt"},
+			map[string]string{"a.txt": "local a v2", "sub/b.txt": "local b", "c.txt": "remote c v2"},
+		},
+		{
+			"renamed",
+			revasync.ModeTwoWay,
+			func() {
+				_ = os.Rename(filepath.Join(localDir, "a.txt"), filepath.Join(localDir, "sub", "a.txt"))
+				_ = remote.Move("/home/sync/c.txt", "/home/sync/d.txt")
+			},
+			[]string{"move-local c.txt -> d.txt", "move-remote a.txt -> sub/a.txt"},
+			map[string]string{"sub/a.txt": "local a v2", "sub/b.txt": "local b", "d.txt": "remote c v2", "a.txt": "<missing>", "c.txt": "<missing>"},
+		},
+		{
+			"deleted",
+			revasync.ModeTwoWay,
+			func() {
+				_ = os.Remove(filepath.Join(localDir, "sub", "b.txt"))
+				_ = remote.Remove("/home/sync/d.txt")
+			},
+			[]string{"remove-local d.txt", "remove-remote sub/b.txt"},
+			map[string]string{"sub/a.txt": "local a v2", "sub/b.txt": "<missing>", "d.txt": "<missing>"},
+		},
+		{
+			"conflict",
+			revasync.ModeTwoWay,
+			func() {
+				writeLocal("sub/a.txt", "local a v3", 0)
+				remote.write("/home/sync/sub/a.txt", []byte("remote a v3"), time.Now())
+			},
+			[]string{"conflict sub/a.txt -> sub/a (conflict *).txt"},
+			map[string]string{"sub/a.txt": "remote a v3", "sub/a (conflict *).txt": "local a v3"},
+		},
+		{
+			"push",
+			revasync.ModePush,
+			func() {
+				remote.write("/home/sync/sub/e.txt", []byte("remote e"), time.Now())
+				remote.write("/home/sync/sub/a.txt", []byte("remote a v4"), time.Now())
+			},
+			[]string{"remove-remote sub/e.txt", "upload sub/a.txt"},
+			map[string]string{"sub/a.txt": "remote a v3", "sub/e.txt": "<missing>"},
+		},
+		{
+			"pull",
+			revasync.ModePull,
+			func() {
+				writeLocal("f.txt", "local f", 0)
+				remote.write("/home/sync/g/h.txt", []byte("remote h"), time.Now())
+			},
+			[]string{"download g/h.txt", "mkdir-local g", "remove-local f.txt"},
+			map[string]string{"f.txt": "<missing>", "g/h.txt": "remote h"},
+		},
+		{
+			"push replaces types",
+			revasync.ModePush,
+			func() {
+				writeLocal("t/x.txt", "local x", 0)
+				writeLocal("u", "local u", 0)
+				remote.write("/home/sync/t", []byte("remote t"), time.Now())
+				remote.write("/home/sync/u/y.txt", []byte("remote y"), time.Now())
+			},
+			[]string{"mkdir-remote t", "remove-remote u/y.txt", "upload t/x.txt", "upload u"},
+			map[string]string{"t/x.txt": "local x", "u": "local u", "u/y.txt": "<missing>"},
+		},
+		{
+			"pull replaces types",
+			revasync.ModePull,
+			func() {
+				_ = remote.Remove("/home/sync/t")
+				remote.write("/home/sync/t", []byte("remote t"), time.Now())
+				_ = remote.Remove("/home/sync/u")
+				remote.write("/home/sync/u/z.txt", []byte("remote z"), time.Now())
+			},
+			[]string{"download t", "download u/z.txt", "mkdir-local u", "remove-local t/x.txt"},
+			map[string]string{"t": "remote t", "t/x.txt": "<missing>", "u/z.txt": "remote z"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.prepare()
+
+			syncer, err := revasync.NewSyncerWithRemote(remote, localDir, "/home/sync")
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("NewSyncerWithRemote", err, remote, localDir, "/home/sync"))
+			}
+			syncer.Mode = test.mode
+
+			result, err := syncer.Sync()
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("Syncer.Sync", err))
+			}
+			if failed := result.Failed(); len(failed) > 0 {
+				t.Errorf(testintl.FormatTestError("Syncer.Sync", failed[0].Err))
+			}
+
+			ops := make([]string, 0, len(result.Operations))
+			for _, opResult := range result.Operations {
+				ops = append(ops, conflictPattern(opResult.Operation.String()))
+			}
+			sort.Strings(ops)
+			if !reflect.DeepEqual(ops, test.ops) {
+				t.Errorf(testintl.FormatTestResult("Syncer.Sync", test.ops, ops))
+			}
+
+			for path, data := range test.files {
+				if strings.Contains(path, "*") {
+					matches, _ := filepath.Glob(filepath.Join(localDir, filepath.FromSlash(path)))
+					if len(matches) != 1 {
+						t.Errorf(testintl.FormatTestResult("Syncer.Sync", path, matches))
+						continue
+					}
+					path, _ = filepath.Rel(localDir, matches[0])
+					path = filepath.ToSlash(path)
+				}
+
+				if local := readLocal(path); local != data {
+					t.Errorf(testintl.FormatTestResult("Syncer.Sync", data, local, "local:"+path))
+				}
+				if remote := readRemote(path); remote != data {
+					t.Errorf(testintl.FormatTestResult("Syncer.Sync", data, remote, "remote:"+path))
+				}
+			}
+
+			// A second synchronization must not find anything to do
+			if plan, err := syncer.Plan(); err != nil || len(plan) != 0 {
+				t.Errorf(testintl.FormatTestResult("Syncer.Plan", []revasync.Operation{}, plan))
+			}
+		})
+	}
+}
+
+func TestSyncerFirstSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum bool
+		local    string
+		remote   string
+		ops      []string
+	}{
+		{"IdenticalWithChecksum", true, "same data", "same data", []string{}},
+		{"IdenticalWithoutChecksum", false, "same data", "same data", []string{}},
+		{"DifferentWithChecksum", true, "local data", "other data", []string{"conflict a.txt -> a (conflict *).txt"}},
+		{"DifferentWithoutChecksum", false, "local data", "other data", []string{"conflict a.txt -> a (conflict *).txt"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			localDir, err := ioutil.TempDir("", "libreva-sync")
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("ioutil.TempDir", err, "", "libreva-sync"))
+			}
+			defer os.RemoveAll(localDir)
+
+			// Both sides have different modification times and no state has been recorded yet
+			_ = ioutil.WriteFile(filepath.Join(localDir, "a.txt"), []byte(test.local), 0644)
+			remote := newMemoryRemote()
+			remote.write("/home/sync/a.txt", []byte(test.remote), time.Now().Add(-time.Hour))
+			if !test.checksum {
+				remote.infos["/home/sync/a.txt"].Checksum = nil
+			}
+
+			syncer, err := revasync.NewSyncerWithRemote(remote, localDir, "/home/sync")
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("NewSyncerWithRemote", err, remote, localDir, "/home/sync"))
+			}
+
+			result, err := syncer.Sync()
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("Syncer.Sync", err))
+			}
+			ops := make([]string, 0, len(result.Operations))
+			for _, opResult := range result.Operations {
+				ops = append(ops, conflictPattern(opResult.Operation.String()))
+			}
+			if !reflect.DeepEqual(ops, test.ops) {
+				t.Errorf(testintl.FormatTestResult("Syncer.Sync", test.ops, ops))
+			}
+
+			// The state must have been recorded, so a remote modification is no conflict anymore
+			remote.write("/home/sync/a.txt", []byte("remote v2"), time.Now())
+			plan, err := syncer.Plan()
+			if err != nil {
+				t.Fatalf(testintl.FormatTestError("Syncer.Plan", err))
+			}
+			if want := "download a.txt"; len(plan) != 1 || plan[0].String() != want {
+				t.Errorf(testintl.FormatTestResult("Syncer.Plan", want, plan))
+			}
+		})
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	date := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"file.txt", "file (conflict 2020-01-02 150405).txt"},
+		{"dir/archive.tar.gz", "dir/archive.tar (conflict 2020-01-02 150405).gz"},
+		{"dir/.profile", "dir/.profile (conflict 2020-01-02 150405)"},
+		{"README", "README (conflict 2020-01-02 150405)"},
+	}
+
+	for _, test := range tests {
+		if got := revasync.ConflictName(test.path, date); got != test.want {
+			t.Errorf(testintl.FormatTestResult("ConflictName", test.want, got, test.path, date))
+		}
+	}
+}
+
+func conflictPattern(s string) string {
+	if i := strings.Index(s, "(conflict "); i != -1 {
+		if j := strings.Index(s[i:], ")"); j != -1 {
+			return s[:i] + "(conflict *" + s[i+j:]
+		}
+	}
+	return s
+}